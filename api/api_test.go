@@ -0,0 +1,148 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"todo-cli/api"
+	"todo-cli/db"
+	"todo-cli/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testServer serves the API on an in-memory store of its own
+type testServer struct {
+	t      *testing.T
+	router *gin.Engine
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("SECRET_KEY", "test secret")
+	store, err := db.Open("memory://" + t.Name() + "/" + primitive.NewObjectID().Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testServer{t: t, router: api.NewRouter(store.Stores())}
+}
+
+// do sends a request below /todo-app/api/v1 with the token and the JSON of
+// body, if any, and decodes the response into out, if given. header holds
+// further header names and values.
+func (s *testServer) do(method, path, token string, body, out interface{}, header ...string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, "/todo-app/api/v1"+path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if out != nil && rec.Code < 300 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			s.t.Fatalf("%s %s returned %s: %v", method, path, rec.Body, err)
+		}
+	}
+	return rec
+}
+
+// jsonBody decodes the body of a response, whatever its status
+func jsonBody(rec *httptest.ResponseRecorder, out interface{}) error {
+	return json.Unmarshal(rec.Body.Bytes(), out)
+}
+
+// expect fails the test unless the response has the status
+func (s *testServer) expect(rec *httptest.ResponseRecorder, status int) {
+	s.t.Helper()
+	if rec.Code != status {
+		s.t.Fatalf("got status %d, want %d: %s", rec.Code, status, rec.Body)
+	}
+}
+
+// tokens are what logging in hands out
+type tokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// login registers a user and logs them in
+func (s *testServer) login(username string) tokens {
+	s.t.Helper()
+	s.expect(s.do("POST", "/user/register", "", map[string]string{"username": username, "password": "secret", "email": username + "@example.com"}, nil), http.StatusCreated)
+	var pair tokens
+	s.expect(s.do("POST", "/user/login", "", map[string]string{"username": username, "password": "secret"}, &pair), http.StatusOK)
+	return pair
+}
+
+// create adds a todo with the title and returns it
+func (s *testServer) create(token, title string) models.Todo {
+	s.t.Helper()
+	var todo models.Todo
+	s.expect(s.do("POST", "/todos/", token, map[string]string{"title": title}, &todo), http.StatusOK)
+	return todo
+}
+
+func TestTodoRoutes(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.login("alice")
+	todo := s.create(alice.Token, "write report")
+
+	var got models.Todo
+	s.expect(s.do("GET", "/todos/"+todo.ID.Hex(), alice.Token, nil, &got), http.StatusOK)
+	if got.Title != "write report" {
+		t.Errorf("GET returned %q", got.Title)
+	}
+	s.expect(s.do("PUT", "/todos/"+todo.ID.Hex(), alice.Token, map[string]interface{}{"completed": true}, &got), http.StatusOK)
+	if !got.Completed {
+		t.Errorf("PUT did not complete the todo")
+	}
+
+	// Other users do not see the todo
+	bob := s.login("bob")
+	s.expect(s.do("GET", "/todos/"+todo.ID.Hex(), bob.Token, nil, nil), http.StatusNotFound)
+	s.expect(s.do("DELETE", "/todos/"+todo.ID.Hex(), bob.Token, nil, nil), http.StatusNotFound)
+
+	s.expect(s.do("DELETE", "/todos/"+todo.ID.Hex(), alice.Token, nil, nil), http.StatusOK)
+	s.expect(s.do("GET", "/todos/"+todo.ID.Hex(), alice.Token, nil, nil), http.StatusNotFound)
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.login("alice")
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{"no token", ""},
+		{"no bearer", alice.Token},
+		{"garbage", "Bearer not-a-jwt"},
+		{"refresh token", "Bearer " + alice.RefreshToken},
+	}
+	for _, tt := range tests {
+		rec := s.do("GET", "/todos/", "", nil, nil, "Authorization", tt.header)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got status %d, want 401", tt.name, rec.Code)
+		}
+	}
+
+	s.expect(s.do("GET", "/todos/", alice.Token, nil, nil), http.StatusOK)
+	// The session ends with the logout even though the token has not expired
+	s.expect(s.do("POST", "/user/logout", alice.Token, nil, nil), http.StatusOK)
+	s.expect(s.do("GET", "/todos/", alice.Token, nil, nil), http.StatusUnauthorized)
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"todo-cli/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// archivedFromQuery reads archived=true|false|all into a TodoFilter.Archived value
+func archivedFromQuery(c *gin.Context) (string, error) {
+	switch archived := c.Query("archived"); archived {
+	case "", "false":
+		return "", nil
+	case "true":
+		return services.ArchivedOnly, nil
+	case "all":
+		return services.ArchivedAll, nil
+	default:
+		return "", fmt.Errorf("invalid archived %q, expected true, false or all", archived)
+	}
+}
+
+// archiveCompleted serves POST /todos/archive-completed, archiving the
+// completed todos of the user. With older_than_days=n only the ones
+// completed at least n days ago are archived.
+func (h *handler) archiveCompleted(c *gin.Context) {
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	var olderThan time.Duration
+	if value := c.Query("older_than_days"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid older_than_days %q, expected a number of days", value)})
+			return
+		}
+		olderThan = time.Duration(days) * 24 * time.Hour
+	}
+
+	var archived int
+	err := h.todos.Undoable(objUserID, "archive completed todos", func(todos *services.TodoService) (err error) {
+		archived, err = todos.ArchiveCompleted(objUserID, olderThan)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"archived": archived})
+}
@@ -0,0 +1,45 @@
+package api_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestArchiveCompleted(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.login("alice")
+	report := s.create(alice.Token, "report")
+	s.create(alice.Token, "taxes")
+	s.expect(s.do("PUT", "/todos/"+report.ID.Hex(), alice.Token, map[string]interface{}{"completed": true}, nil), http.StatusOK)
+
+	var result struct {
+		Archived int `json:"archived"`
+	}
+	s.expect(s.do("POST", "/todos/archive-completed?older_than_days=soon", alice.Token, nil, nil), http.StatusBadRequest)
+	// report was completed just now
+	s.expect(s.do("POST", "/todos/archive-completed?older_than_days=1", alice.Token, nil, &result), http.StatusOK)
+	if result.Archived != 0 {
+		t.Errorf("archiving todos completed a day ago archived %d", result.Archived)
+	}
+	s.expect(s.do("POST", "/todos/archive-completed", alice.Token, nil, &result), http.StatusOK)
+	if result.Archived != 1 {
+		t.Errorf("archiving the completed todos archived %d, want 1", result.Archived)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"taxes"}},
+		{"?archived=false", []string{"taxes"}},
+		{"?archived=true", []string{"report"}},
+		{"?archived=all", []string{"report", "taxes"}},
+	}
+	for _, tt := range tests {
+		if got := s.listed(alice.Token, tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GET /todos/%s listed %v, want %v", tt.query, got, tt.want)
+		}
+	}
+	s.expect(s.do("GET", "/todos/?archived=yes", alice.Token, nil, nil), http.StatusBadRequest)
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"todo-cli/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// bulkTodos applies a list of create, update, delete and complete operations
+// and reports the outcome of each, with 207 when any of them failed. Atomic
+// requests run as one transaction, see TodoService.Bulk.
+func (h *handler) bulkTodos(c *gin.Context) {
+	var body struct {
+		Atomic     bool `json:"atomic"`
+		Operations []struct {
+			Op      string          `json:"op"`
+			ID      string          `json:"id"`
+			Version *int64          `json:"version"`
+			Todo    json.RawMessage `json:"todo"`
+		} `json:"operations"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	if len(body.Operations) == 0 || len(body.Operations) > services.MaxBulkOperations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("expected between 1 and %d operations", services.MaxBulkOperations)})
+		return
+	}
+
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	// Malformed operations reject the whole request before anything is applied
+	ops := make([]services.BulkOperation, len(body.Operations))
+	invalid := map[string]string{}
+	for i, item := range body.Operations {
+		ops[i] = services.BulkOperation{Op: item.Op, ID: item.ID, Version: item.Version}
+		switch item.Op {
+		case services.BulkCreate:
+			var newTodo todoRequest
+			if err := json.Unmarshal(item.Todo, &newTodo); err != nil {
+				invalid[strconv.Itoa(i)] = "invalid todo"
+				continue
+			}
+			if err := validate.Struct(&newTodo); err != nil {
+				var fields []string
+				for _, vErr := range err.(validator.ValidationErrors) {
+					fields = append(fields, vErr.Field()+": "+vErr.Tag()) // e.g. "Title: required"
+				}
+				invalid[strconv.Itoa(i)] = strings.Join(fields, ", ")
+				continue
+			}
+			ops[i].Todo = newTodo.todo(objUserID)
+		case services.BulkUpdate:
+			if item.ID == "" || json.Unmarshal(item.Todo, &ops[i].Update) != nil {
+				invalid[strconv.Itoa(i)] = "update needs an id and a todo with the fields to change"
+				continue
+			}
+			ops[i].Update.UpdatedAt = time.Now()
+			if item.Version != nil {
+				ops[i].Update.Version = item.Version
+			}
+		case services.BulkDelete, services.BulkComplete:
+			if item.ID == "" {
+				invalid[strconv.Itoa(i)] = item.Op + " needs an id"
+			}
+		default:
+			invalid[strconv.Itoa(i)] = fmt.Sprintf("unknown op %q, expected create, update, delete or complete", item.Op)
+		}
+	}
+	if len(invalid) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"errors": invalid})
+		return
+	}
+
+	var results []services.BulkResult
+	err := h.todos.Undoable(objUserID, "bulk change", func(todos *services.TodoService) (err error) {
+		results, err = todos.Bulk(objUserID, ops, body.Atomic)
+		return err
+	})
+	if errors.Is(err, services.ErrNoTransactions) {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "atomic bulk requests need a storage backend with transactions"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Status == services.BulkFailed {
+			failed++
+		}
+	}
+	status := http.StatusOK
+	if failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, gin.H{"results": results, "failed": failed})
+}
@@ -0,0 +1,90 @@
+package api_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"todo-cli/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// bulkResponse is the body of POST /todos/bulk
+type bulkResponse struct {
+	Results []services.BulkResult `json:"results"`
+	Failed  int                   `json:"failed"`
+}
+
+func (r bulkResponse) statuses() []string {
+	var got []string
+	for _, result := range r.Results {
+		got = append(got, result.Status)
+	}
+	return got
+}
+
+func TestBulk(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.login("alice")
+	report := s.create(alice.Token, "report")
+	taxes := s.create(alice.Token, "taxes")
+	missing := primitive.NewObjectID().Hex()
+
+	// Malformed operations turn the whole request away
+	var invalid struct {
+		Errors map[string]string `json:"errors"`
+	}
+	rec := s.do("POST", "/todos/bulk", alice.Token, map[string]interface{}{"operations": []map[string]interface{}{
+		{"op": "complete", "id": report.ID.Hex()},
+		{"op": "complete"},
+		{"op": "archive", "id": report.ID.Hex()},
+		{"op": "create", "todo": map[string]string{}},
+	}}, nil)
+	s.expect(rec, http.StatusBadRequest)
+	if err := jsonBody(rec, &invalid); err != nil || len(invalid.Errors) != 3 || invalid.Errors["0"] != "" {
+		t.Errorf("the malformed request reported %v, %v, want errors for operations 1 to 3", invalid.Errors, err)
+	}
+
+	// An atomic request that fails changes nothing
+	var result bulkResponse
+	s.expect(s.do("POST", "/todos/bulk", alice.Token, map[string]interface{}{"atomic": true, "operations": []map[string]interface{}{
+		{"op": "complete", "id": report.ID.Hex()},
+		{"op": "delete", "id": missing},
+		{"op": "delete", "id": taxes.ID.Hex()},
+	}}, &result), http.StatusMultiStatus)
+	if want := []string{services.BulkRolledBack, services.BulkFailed, services.BulkSkipped}; !reflect.DeepEqual(result.statuses(), want) || result.Failed != 1 {
+		t.Errorf("the atomic request reported %v with %d failed, want %v", result.statuses(), result.Failed, want)
+	}
+	if got := s.listed(alice.Token, "?completed=false"); !reflect.DeepEqual(got, []string{"report", "taxes"}) {
+		t.Errorf("after the failed atomic request %v are open, want report and taxes", got)
+	}
+
+	// Without atomic every operation stands on its own
+	s.expect(s.do("POST", "/todos/bulk", alice.Token, map[string]interface{}{"operations": []map[string]interface{}{
+		{"op": "complete", "id": report.ID.Hex()},
+		{"op": "delete", "id": missing},
+		{"op": "create", "todo": map[string]string{"title": "groceries"}},
+	}}, &result), http.StatusMultiStatus)
+	if want := []string{services.BulkOK, services.BulkFailed, services.BulkOK}; !reflect.DeepEqual(result.statuses(), want) {
+		t.Errorf("the request reported %v, want %v", result.statuses(), want)
+	}
+	if got := s.listed(alice.Token, "?completed=false"); !reflect.DeepEqual(got, []string{"taxes", "groceries"}) {
+		t.Errorf("after the request %v are open, want taxes and groceries", got)
+	}
+
+	// The whole request is undone at once
+	s.expect(s.do("POST", "/todos/bulk", alice.Token, map[string]interface{}{"atomic": true, "operations": []map[string]interface{}{
+		{"op": "delete", "id": taxes.ID.Hex()},
+		{"op": "update", "id": report.ID.Hex(), "todo": map[string]string{"title": "quarterly report"}},
+	}}, &result), http.StatusOK)
+	if got := s.listed(alice.Token, ""); !reflect.DeepEqual(got, []string{"quarterly report", "groceries"}) {
+		t.Errorf("after the atomic request %v are listed", got)
+	}
+	if op := s.replay("/todos/undo", alice.Token); op != "bulk change" {
+		t.Errorf("undo replayed %q, want bulk change", op)
+	}
+	if got := s.listed(alice.Token, ""); !reflect.DeepEqual(got, []string{"report", "taxes", "groceries"}) {
+		t.Errorf("after undoing the atomic request %v are listed", got)
+	}
+}
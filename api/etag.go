@@ -0,0 +1,58 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"todo-cli/models"
+	"todo-cli/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setTodoETag sends the version of a todo as the ETag of the response
+func setTodoETag(c *gin.Context, todo models.Todo) {
+	c.Header("ETag", fmt.Sprintf(`"%d"`, todo.Version))
+}
+
+// ifMatchVersion returns the version of the todo an If-Match header asks
+// for, nil without one or with *. When the header is malformed the error
+// response is already written and ok is false.
+func ifMatchVersion(c *gin.Context) (version *int64, ok bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return nil, true
+	}
+	// If-Match compares strongly (RFC 9110 13.1.1), so a weak ETag never
+	// matches
+	if strings.HasPrefix(header, "W/") {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "If-Match needs a strong ETag, e.g. \"3\", weak ones never match"})
+		return nil, false
+	}
+	tag := header
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "If-Match takes a single ETag, e.g. \"3\""})
+		return nil, false
+	}
+	n, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "If-Match takes a single ETag, e.g. \"3\""})
+		return nil, false
+	}
+	return &n, true
+}
+
+// versionConflict writes the 412 response when err is a version mismatch
+// and reports whether it was one
+func versionConflict(c *gin.Context, err error) bool {
+	var mismatch *services.VersionMismatchError
+	if !errors.As(err, &mismatch) {
+		return false
+	}
+	c.Header("ETag", fmt.Sprintf(`"%d"`, mismatch.Current))
+	c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error(), "version": mismatch.Current})
+	return true
+}
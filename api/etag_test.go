@@ -0,0 +1,60 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+
+	"todo-cli/models"
+)
+
+func TestIfMatch(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.login("alice")
+	todo := s.create(alice.Token, "report")
+	path := "/todos/" + todo.ID.Hex()
+
+	rec := s.do("GET", path, alice.Token, nil, nil)
+	s.expect(rec, http.StatusOK)
+	if etag := rec.Header().Get("ETag"); etag != `"1"` {
+		t.Fatalf("GET sent the ETag %s, want \"1\"", etag)
+	}
+
+	rename := map[string]string{"title": "quarterly report"}
+	tests := []struct {
+		ifMatch string
+		status  int
+		etag    string
+	}{
+		{`"1"`, http.StatusOK, `"2"`},
+		// The todo changed since version 1
+		{`"1"`, http.StatusPreconditionFailed, `"2"`},
+		{`W/"2"`, http.StatusPreconditionFailed, ""},
+		{`2`, http.StatusBadRequest, ""},
+		{`"2", "3"`, http.StatusBadRequest, ""},
+		{`*`, http.StatusOK, `"3"`},
+		{``, http.StatusOK, `"4"`},
+	}
+	for _, tt := range tests {
+		rec := s.do("PUT", path, alice.Token, rename, nil, "If-Match", tt.ifMatch)
+		if rec.Code != tt.status || rec.Header().Get("ETag") != tt.etag {
+			t.Errorf("PUT with If-Match %s got status %d and ETag %s, want %d and %s", tt.ifMatch, rec.Code, rec.Header().Get("ETag"), tt.status, tt.etag)
+		}
+	}
+
+	// A version in the body is checked like If-Match
+	var conflict struct {
+		Version int64 `json:"version"`
+	}
+	rec = s.do("PUT", path, alice.Token, map[string]interface{}{"title": "report", "version": 3}, nil)
+	if err := jsonBody(rec, &conflict); err != nil || rec.Code != http.StatusPreconditionFailed || conflict.Version != 4 {
+		t.Errorf("PUT at version 3 got status %d with version %d, want 412 with 4", rec.Code, conflict.Version)
+	}
+
+	s.expect(s.do("DELETE", path, alice.Token, nil, nil, "If-Match", `"3"`), http.StatusPreconditionFailed)
+	s.expect(s.do("DELETE", path, alice.Token, nil, nil, "If-Match", `"4"`), http.StatusOK)
+	var trash []models.Todo
+	s.expect(s.do("GET", "/trash/", alice.Token, nil, &trash), http.StatusOK)
+	if len(trash) != 1 || trash[0].Title != "quarterly report" {
+		t.Errorf("the trash holds %d todos, want the deleted one", len(trash))
+	}
+}
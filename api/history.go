@@ -0,0 +1,29 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"todo-cli/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getTodoHistory lists the changes made to a todo, oldest first
+func (h *handler) getTodoHistory(c *gin.Context) {
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	events, err := h.todos.GetHistory(c.Param("id"), objUserID)
+	if errors.Is(err, services.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
@@ -0,0 +1,39 @@
+package api_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"todo-cli/models"
+)
+
+func TestTodoHistory(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.login("alice")
+	todo := s.create(alice.Token, "report")
+	s.expect(s.do("PUT", "/todos/"+todo.ID.Hex(), alice.Token, map[string]interface{}{"title": "quarterly report"}, nil), http.StatusOK)
+	s.expect(s.do("PUT", "/todos/"+todo.ID.Hex(), alice.Token, map[string]interface{}{"completed": true}, nil), http.StatusOK)
+	s.expect(s.do("DELETE", "/todos/"+todo.ID.Hex(), alice.Token, nil, nil), http.StatusOK)
+
+	// The history is kept while the todo is in the trash
+	var events []models.TodoEvent
+	s.expect(s.do("GET", "/todos/"+todo.ID.Hex()+"/history", alice.Token, nil, &events), http.StatusOK)
+	var actions []string
+	for _, event := range events {
+		actions = append(actions, event.Action)
+		if event.Actor != "alice" {
+			t.Errorf("the %s event names %q as the actor, want alice", event.Action, event.Actor)
+		}
+	}
+	want := []string{models.ActionCreated, models.ActionUpdated, models.ActionCompleted, models.ActionDeleted}
+	if !reflect.DeepEqual(actions, want) {
+		t.Fatalf("the history holds %v, want %v", actions, want)
+	}
+	if changes := events[1].Changes; len(changes) != 1 || changes[0].Field != "title" || changes[0].Before != "report" || changes[0].After != "quarterly report" {
+		t.Errorf("the update recorded %+v, want the title change", changes)
+	}
+
+	bob := s.login("bob")
+	s.expect(s.do("GET", "/todos/"+todo.ID.Hex()+"/history", bob.Token, nil, nil), http.StatusNotFound)
+}
@@ -2,21 +2,23 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"strings"
 	"time"
 
-	"todo-cli/db"
+	"todo-cli/models"
+	"todo-cli/services"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
-// AuthMiddleware verifies the JWT token for protected routes
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware verifies the JWT token or personal access token for protected routes
+func AuthMiddleware(tokens services.TokenStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.Request.Header.Get("Authorization")
 		if authHeader == "" {
@@ -25,44 +27,90 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		tokenString := strings.Split(authHeader, "Bearer ")[1]
-		var jwtSecret = []byte(os.Getenv("SECRET_KEY"))
-
-		// Parse the token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Validate the signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method")
-			}
-			return jwtSecret, nil
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Authorization header format"})
 			c.Abort()
 			return
 		}
 
-		// Optionally check if the token is in the MongoDB (e.g., for logout)
-		collection := db.GetCollection("go-todo-db", "tokens")
+		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		var storedToken bson.M
-		err = collection.FindOne(ctx, bson.M{"token": tokenString}).Decode(&storedToken)
+		// Scripts authenticate with personal access tokens, limited to their scopes
+		if services.IsAccessToken(tokenString) {
+			accessToken, err := services.AccessTokenOf(ctx, tokens, tokenString)
+			if errors.Is(err, services.ErrAccessTokenExpired) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
+				c.Abort()
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+				c.Abort()
+				return
+			}
+			if err := services.TouchAccessToken(ctx, tokens, accessToken); err != nil {
+				log.Printf("Failed to record the use of access token %s: %v", accessToken.ID.Hex(), err)
+			}
+			c.Set("userID", accessToken.UserID.Hex())
+			c.Set("accessToken", accessToken)
+			c.Next()
+			return
+		}
+
+		// Parse the token, clients refresh it once it expired
+		userID, sessionID, err := services.SessionOf(tokenString, false)
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors == jwt.ValidationErrorExpired {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
+			c.Abort()
+			return
+		}
 		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+
+		// Check the session is still open (it is removed on logout)
+		session, err := tokens.FindToken(ctx, sessionID)
+		if err != nil || session.UserID != userID {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token not found"})
 			c.Abort()
 			return
 		}
+		if err := services.TouchSession(ctx, tokens, session, c.ClientIP()); err != nil {
+			log.Printf("Failed to record the use of session %s: %v", sessionID, err)
+		}
+		c.Set("sessionID", sessionID)
 
 		// Allow the request to proceed
 		c.Next()
 	}
 }
 
+// RequireScope turns away requests made with a personal access token that
+// was not granted scope. Sessions opened by logging in may do anything.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if value, ok := c.Get("accessToken"); ok && !value.(models.AccessToken).Allows(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Token lacks the %s scope", scope)})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 // ExtractUserIDFromJWT extracts user_id from the JWT claims
 func ExtractUserIDFromJWT(c *gin.Context) {
+	// Personal access tokens are no JWTs, AuthMiddleware knows their user already
+	if _, ok := c.Get("accessToken"); ok {
+		c.Next()
+		return
+	}
+
 	var jwtSecret = []byte(os.Getenv("SECRET_KEY")) // Secret key used to sign the JWT
 
 	// Extract the token from the Authorization header
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"todo-cli/models"
+	"todo-cli/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+func ProjectRoutes(router *gin.RouterGroup, h *handler, tokens services.TokenStore) {
+	protected := router.Group("/projects")
+	protected.Use(AuthMiddleware(tokens))
+	{
+		protected.GET("/", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosRead), h.getAllProjects)
+		protected.GET("/:id", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosRead), h.getProject)
+		protected.POST("/", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosWrite), h.createProject)
+		protected.PUT("/:id", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosWrite), h.updateProject)
+		protected.DELETE("/:id", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosWrite), h.deleteProject)
+	}
+}
+
+func (h *handler) getAllProjects(c *gin.Context) {
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	projects, err := h.projects.GetProjects(objUserID, c.Query("archived") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, projects)
+}
+
+func (h *handler) getProject(c *gin.Context) {
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	project, err := h.projects.GetProjectByID(c.Param("id"), objUserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+	c.JSON(http.StatusOK, project)
+}
+
+func (h *handler) createProject(c *gin.Context) {
+	var newProject struct {
+		Name string `json:"name" validate:"required,min=1,max=100"`
+	}
+	if err := c.ShouldBindJSON(&newProject); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	// Validate the project struct
+	if err := validate.Struct(&newProject); err != nil {
+		// Return validation errors
+		validationErrors := err.(validator.ValidationErrors)
+		errors := make(map[string]string)
+		for _, vErr := range validationErrors {
+			errors[vErr.Field()] = vErr.Tag()
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"errors": errors})
+		return
+	}
+
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	project, err := h.projects.CreateProject(objUserID, newProject.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, project)
+}
+
+func (h *handler) updateProject(c *gin.Context) {
+	var update models.ProjectUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	update.UpdatedAt = time.Now()
+
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	project, err := h.projects.UpdateProject(c.Param("id"), objUserID, update)
+	if errors.Is(err, services.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, project)
+}
+
+// deleteProject moves the todos of the project to the Inbox, or deletes them
+// along with it with ?todos=delete
+func (h *handler) deleteProject(c *gin.Context) {
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	var cascade bool
+	switch c.DefaultQuery("todos", "inbox") {
+	case "inbox":
+	case "delete":
+		cascade = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "todos must be inbox or delete"})
+		return
+	}
+
+	err := h.todos.Undoable(objUserID, "delete project", func(todos *services.TodoService) error {
+		return todos.DeleteProject(c.Param("id"), objUserID, cascade)
+	})
+	if errors.Is(err, services.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Project deleted"})
+}
@@ -0,0 +1,38 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRefresh(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.login("alice")
+
+	s.expect(s.do("POST", "/user/refresh", "", map[string]string{}, nil), http.StatusBadRequest)
+	s.expect(s.do("POST", "/user/refresh", "", map[string]string{"refresh_token": "guessed"}, nil), http.StatusUnauthorized)
+
+	var first tokens
+	s.expect(s.do("POST", "/user/refresh", "", map[string]string{"refresh_token": alice.RefreshToken}, &first), http.StatusOK)
+	if first.Token == "" || first.RefreshToken == "" || first.RefreshToken == alice.RefreshToken {
+		t.Fatalf("refreshing handed out %+v, want a new pair of tokens", first)
+	}
+	s.expect(s.do("GET", "/todos/", first.Token, nil, nil), http.StatusOK)
+	var other tokens
+	s.expect(s.do("POST", "/user/login", "", map[string]string{"username": "alice", "password": "secret"}, &other), http.StatusOK)
+
+	// Replaying the refresh token traded in ends the session for everyone
+	// holding its tokens
+	var reused struct {
+		Error string `json:"error"`
+	}
+	rec := s.do("POST", "/user/refresh", "", map[string]string{"refresh_token": alice.RefreshToken}, nil)
+	if err := jsonBody(rec, &reused); err != nil || rec.Code != http.StatusUnauthorized || reused.Error == "" {
+		t.Fatalf("reusing a refresh token got status %d, %q, want 401", rec.Code, reused.Error)
+	}
+	s.expect(s.do("GET", "/todos/", first.Token, nil, nil), http.StatusUnauthorized)
+	s.expect(s.do("POST", "/user/refresh", "", map[string]string{"refresh_token": first.RefreshToken}, nil), http.StatusUnauthorized)
+
+	// Other sessions of the user stay open
+	s.expect(s.do("GET", "/todos/", other.Token, nil, nil), http.StatusOK)
+}
@@ -1,12 +1,15 @@
 package api
 
 import (
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
-	"todo-cli/db"
 	"todo-cli/models"
 	"todo-cli/services"
 
@@ -20,44 +23,66 @@ import (
 // Initialize a validator instance
 var validate *validator.Validate
 
-func AuthRoutes(router *gin.RouterGroup) {
+// handler holds the services the route handlers are served from
+type handler struct {
+	todos    *services.TodoService
+	projects *services.ProjectService
+	views    *services.ViewService
+	users    *services.UserService
+}
+
+func newHandler(stores services.Stores) *handler {
+	return &handler{
+		todos:    services.NewTodoService(stores),
+		projects: services.NewProjectService(stores),
+		views:    services.NewViewService(stores),
+		users:    services.NewUserService(stores.Users, stores.Tokens),
+	}
+}
+
+func AuthRoutes(router *gin.RouterGroup, h *handler) {
 	userRoutes := router.Group("/user")
-	userRoutes.POST("/register", register)
-	userRoutes.POST("/login", login)
-	userRoutes.POST("/logout", logout)
-	userRoutes.GET("/details/:id", getUserDetails)
+	userRoutes.POST("/register", h.register)
+	userRoutes.POST("/login", h.login)
+	userRoutes.POST("/refresh", h.refresh)
+	userRoutes.POST("/logout", h.logout)
+	userRoutes.GET("/details/:id", h.getUserDetails)
 }
 
-func TodoRoutes(router *gin.RouterGroup) {
+func TodoRoutes(router *gin.RouterGroup, h *handler, tokens services.TokenStore) {
 	protected := router.Group("/todos")
-	protected.Use(AuthMiddleware())
+	protected.Use(AuthMiddleware(tokens))
 	{
-		protected.GET("/", ExtractUserIDFromJWT, getAllTodos)
-		protected.GET("/:id", ExtractUserIDFromJWT, getTodo)
-		protected.PUT("/:id", ExtractUserIDFromJWT, updateTodo)
-		protected.POST("/", ExtractUserIDFromJWT, createTodo)
-		protected.DELETE("/:id", ExtractUserIDFromJWT, deleteTodo)
+		protected.GET("/", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosRead), h.getAllTodos)
+		protected.GET("/search", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosRead), h.searchTodos)
+		protected.POST("/archive-completed", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosWrite), h.archiveCompleted)
+		protected.POST("/bulk", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosWrite), h.bulkTodos)
+		protected.POST("/undo", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosWrite), h.undo)
+		protected.POST("/redo", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosWrite), h.redo)
+		protected.GET("/:id", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosRead), h.getTodo)
+		protected.PUT("/:id", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosWrite), h.updateTodo)
+		protected.POST("/", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosWrite), h.createTodo)
+		protected.DELETE("/:id", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosWrite), h.deleteTodo)
+		protected.GET("/:id/history", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosRead), h.getTodoHistory)
+		protected.POST("/:id/move", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosWrite), h.moveTodo)
+		protected.POST("/:id/tags", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosWrite), h.addTodoTags)
+		protected.DELETE("/:id/tags/:tag", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosWrite), h.removeTodoTag)
 	}
 
 }
 
-func StartServer() {
+// NewRouter builds the Gin engine serving the API on top of the given stores
+func NewRouter(stores services.Stores) *gin.Engine {
 	validate = validator.New()
+	h := newHandler(stores)
 
-	// Get the environment variables
-	port := os.Getenv("PORT")
-	uri := os.Getenv("MONGODB_URI")
-	if port == "" {
-		port = "8080" // Default port if not set
-	}
-
-	db.ConnectMongoDB(uri)
 	r := gin.Default()
 
 	corsConfig := cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000"}, // Replace with your allowed origins
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders:     []string{"Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Content-Type", "Authorization", "If-Match"},
+		ExposeHeaders:    []string{"ETag"},
 		AllowCredentials: true,
 	})
 
@@ -67,15 +92,42 @@ func StartServer() {
 
 	// grouping all routes with api/v1
 	{
-		AuthRoutes(v1)
-		TodoRoutes(v1)
+		AuthRoutes(v1, h)
+		TodoRoutes(v1, h, stores.Tokens)
+		TagRoutes(v1, h, stores.Tokens)
+		ProjectRoutes(v1, h, stores.Tokens)
+		ViewRoutes(v1, h, stores.Tokens)
+		TrashRoutes(v1, h, stores.Tokens)
+		SessionRoutes(v1, h, stores.Tokens)
+		AccessTokenRoutes(v1, h, stores.Tokens)
+	}
+
+	return r
+}
+
+// StartServer serves the API on top of the given stores until the process exits
+func StartServer(stores services.Stores) error {
+	// Get the environment variables
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080" // Default port if not set
 	}
 
 	// Start the server on port 8080
-	r.Run(":" + port)
+	ln, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return err
+	}
+	return Serve(ln, stores)
 }
 
-func register(c *gin.Context) {
+// Serve serves the API on an already bound listener, e.g. one on a random
+// port opened by an integration test with net.Listen("tcp", "127.0.0.1:0")
+func Serve(ln net.Listener, stores services.Stores) error {
+	return http.Serve(ln, NewRouter(stores))
+}
+
+func (h *handler) register(c *gin.Context) {
 	var user struct {
 		Username string `bson:"username" json:"username" validate:"required,min=3,max=32"`
 		Email    string `bson:"email" json:"email" validate:"required,email"`
@@ -98,7 +150,7 @@ func register(c *gin.Context) {
 		return
 	}
 
-	_, err := services.RegisterUser(user.Username, user.Password, user.Email)
+	_, err := h.users.RegisterUser(user.Username, user.Password, user.Email)
 	if err != nil {
 		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
@@ -107,7 +159,7 @@ func register(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"message": "User registered"})
 }
 
-func login(c *gin.Context) {
+func (h *handler) login(c *gin.Context) {
 	var user struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
@@ -117,39 +169,64 @@ func login(c *gin.Context) {
 		return
 	}
 
-	token, err := services.AuthenticateUser(user.Username, user.Password)
+	tokens, err := h.users.AuthenticateUser(user.Username, user.Password, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	c.JSON(http.StatusOK, tokens)
 }
 
-func logout(c *gin.Context) {
+// refresh trades a refresh token for a new pair of tokens
+func (h *handler) refresh(c *gin.Context) {
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_token is required"})
+		return
+	}
+
+	tokens, err := h.users.RefreshSession(body.RefreshToken, c.ClientIP())
+	if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (h *handler) logout(c *gin.Context) {
 	token := c.Request.Header.Get("Authorization")
-	token = strings.Split(token, "Bearer ")[1]
+	if !strings.HasPrefix(token, "Bearer ") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No token provided"})
+		return
+	}
 
-	err := services.LogoutUser(token)
+	err := h.users.LogoutUser(strings.TrimPrefix(token, "Bearer "))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Logout failed"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Logout failed"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
 }
 
-func getUserDetails(c *gin.Context) {
+func (h *handler) getUserDetails(c *gin.Context) {
 	idStr := c.Param("id")
-	userDetails, err := services.GetUserDetails(idStr) // Get userDetails from service layer
+	userDetails, err := h.users.GetUserDetails(idStr) // Get userDetails from service layer
 	if err != nil {
-		c.JSON(http.StatusBadRequest, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 	c.JSON(http.StatusOK, userDetails)
 }
 
-func getAllTodos(c *gin.Context) {
+func (h *handler) getAllTodos(c *gin.Context) {
 	// Get the userID from the context
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -170,11 +247,36 @@ func getAllTodos(c *gin.Context) {
 		return
 	}
 
-	todos, _ := services.GetTodos(objUserID) // Get todos from service layer
+	filter, err := todoFilterFromQuery(c)
+	var syntaxErr *services.FilterSyntaxError
+	if errors.As(err, &syntaxErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid filter: " + err.Error(), "column": syntaxErr.Column})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := pageRequestFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	todos, err := h.todos.GetTodos(objUserID, filter, page) // Get todos from service layer
+	if errors.Is(err, services.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	c.JSON(http.StatusOK, todos)
 }
 
-func getTodo(c *gin.Context) {
+func (h *handler) getTodo(c *gin.Context) {
 	// Get the userID from the context
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -196,17 +298,41 @@ func getTodo(c *gin.Context) {
 	}
 
 	idStr := c.Param("id")
-	todos, err2 := services.GetTodoByID(idStr, objUserID) // Get todos from service layer
+	todos, err2 := h.todos.GetTodoByID(idStr, objUserID) // Get todos from service layer
 	if err2 != nil {
-		c.JSON(http.StatusBadRequest, err2)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
 		return
 	}
+	setTodoETag(c, todos)
 	c.JSON(http.StatusOK, todos)
 }
-func createTodo(c *gin.Context) {
-	var newTodo struct {
-		Title string `bson:"title" json:"title" validate:"required,min=1,max=100"`
-	}
+
+// todoRequest is the body of a request creating a todo
+type todoRequest struct {
+	Title     string              `bson:"title" json:"title" validate:"required,min=1,max=100"`
+	Notes     string              `json:"notes" validate:"max=20000"`
+	Priority  models.Priority     `json:"priority"`
+	Tags      []string            `json:"tags"`
+	ProjectID *primitive.ObjectID `json:"project_id"`
+	ParentID  *primitive.ObjectID `json:"parent_id"`
+	StartAt   *time.Time          `json:"start_at"`
+	DueAt     *time.Time          `json:"due_at"`
+	Repeat    string              `json:"repeat"`
+	RepeatTZ  string              `json:"repeat_tz"`
+}
+
+// todo returns the new todo of the user the request describes
+func (r todoRequest) todo(userID primitive.ObjectID) models.Todo {
+	todo := models.Todo{Title: r.Title, Notes: r.Notes, Priority: r.Priority, Tags: r.Tags, ProjectID: r.ProjectID, ParentID: r.ParentID, StartAt: r.StartAt, DueAt: r.DueAt, Repeat: r.Repeat, RepeatTZ: r.RepeatTZ}
+	todo.ID = primitive.NewObjectID()
+	todo.CreatedAt = time.Now()
+	todo.UpdatedAt = time.Now()
+	todo.UserID = userID
+	return todo
+}
+
+func (h *handler) createTodo(c *gin.Context) {
+	var newTodo todoRequest
 	if err := c.ShouldBindJSON(&newTodo); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
 		return
@@ -243,21 +369,22 @@ func createTodo(c *gin.Context) {
 		return
 	}
 
-	todoToAdd := models.Todo{Title: newTodo.Title}
-	todoToAdd.ID = primitive.NewObjectID()
-	todoToAdd.CreatedAt = time.Now()
-	todoToAdd.UpdatedAt = time.Now()
-	todoToAdd.UserID = objUserID
+	todoToAdd := newTodo.todo(objUserID)
 
-	result, err := services.AddTodo(todoToAdd)
+	var result models.Todo
+	err = h.todos.Undoable(objUserID, "create todo", func(todos *services.TodoService) (err error) {
+		result, err = todos.AddTodo(todoToAdd)
+		return err
+	})
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	setTodoETag(c, result)
 	c.JSON(http.StatusOK, result)
 }
 
-func updateTodo(c *gin.Context) {
+func (h *handler) updateTodo(c *gin.Context) {
 	var newTodo models.TodoUpdate
 	idStr := c.Param("id")
 	if err := c.ShouldBindJSON(&newTodo); err != nil {
@@ -286,15 +413,36 @@ func updateTodo(c *gin.Context) {
 		return
 	}
 
-	result, err := services.UpdateTodo(idStr, objUserID, newTodo)
+	// If-Match takes precedence over a version in the body
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+	if version != nil {
+		newTodo.Version = version
+	}
+
+	var result models.Todo
+	err = h.todos.Undoable(objUserID, "update todo", func(todos *services.TodoService) (err error) {
+		result, err = todos.UpdateTodo(idStr, objUserID, newTodo)
+		return err
+	})
+	if errors.Is(err, services.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
+		return
+	}
+	if versionConflict(c, err) {
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	setTodoETag(c, result)
 	c.JSON(http.StatusOK, result)
 }
 
-func deleteTodo(c *gin.Context) {
+func (h *handler) deleteTodo(c *gin.Context) {
 	idStr := c.Param("id")
 
 	// Get the userID from the context
@@ -317,10 +465,161 @@ func deleteTodo(c *gin.Context) {
 		return
 	}
 
-	_, err2 := services.DeleteTodo(idStr, objUserID)
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	err2 := h.todos.Undoable(objUserID, "delete todo", func(todos *services.TodoService) error {
+		return todos.DeleteTodo(idStr, objUserID, version)
+	})
+	if versionConflict(c, err2) {
+		return
+	}
 	if err2 != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Todo deleted"})
+	c.JSON(http.StatusOK, gin.H{"message": "Todo moved to the trash"})
+}
+
+func (h *handler) moveTodo(c *gin.Context) {
+	var move struct {
+		Before string `json:"before"`
+		After  string `json:"after"`
+	}
+	if err := c.ShouldBindJSON(&move); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	var result models.Todo
+	err := h.todos.Undoable(objUserID, "move todo", func(todos *services.TodoService) (err error) {
+		result, err = todos.MoveTodo(c.Param("id"), objUserID, move.Before, move.After)
+		return err
+	})
+	if errors.Is(err, services.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// userIDFromContext returns the ID of the user ExtractUserIDFromJWT stored in
+// the context. When it is missing or malformed the error response is already
+// written and ok is false.
+func userIDFromContext(c *gin.Context) (primitive.ObjectID, bool) {
+	userIDStr := c.GetString("userID")
+	if userIDStr == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return primitive.NilObjectID, false
+	}
+
+	// Convert the string userID to a primitive.ObjectID
+	objUserID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID format"})
+		return primitive.NilObjectID, false
+	}
+	return objUserID, true
+}
+
+// todoFilterFromQuery reads the GET /todos filters from the query string:
+// due=overdue|today, tz, an IANA zone name or UTC offset such as +05:30
+// that "today" is evaluated in, any number of tag=name and project, a
+// project ID or inbox, archived=true|all to list archived todos, and filter, an expression read by
+// services.ParseFilterExpr such as "tag:work AND NOT done"
+func todoFilterFromQuery(c *gin.Context) (services.TodoFilter, error) {
+	filter := services.TodoFilter{Due: c.Query("due"), Tags: c.QueryArray("tag")}
+	switch project := c.Query("project"); project {
+	case "":
+	case "inbox":
+		filter.Inbox = true
+	default:
+		projectID, err := primitive.ObjectIDFromHex(project)
+		if err != nil {
+			return filter, fmt.Errorf("invalid project %q", project)
+		}
+		filter.Project = &projectID
+	}
+
+	switch filter.Due {
+	case "", services.DueOverdue, services.DueToday:
+	default:
+		return filter, fmt.Errorf("invalid due filter %q, expected overdue or today", filter.Due)
+	}
+
+	if tz := c.Query("tz"); tz != "" {
+		loc, err := services.ParseLocation(tz)
+		if err != nil {
+			return filter, err
+		}
+		filter.Location = loc
+	}
+
+	if completed := c.Query("completed"); completed != "" {
+		value, err := strconv.ParseBool(completed)
+		if err != nil {
+			return filter, fmt.Errorf("invalid completed %q, expected true or false", completed)
+		}
+		filter.Completed = &value
+	}
+	for param, bound := range map[string]**time.Time{
+		"created_after":  &filter.CreatedAfter,
+		"created_before": &filter.CreatedBefore,
+		"updated_after":  &filter.UpdatedAfter,
+		"updated_before": &filter.UpdatedBefore,
+	} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s %q, expected an RFC 3339 timestamp", param, value)
+		}
+		*bound = &t
+	}
+
+	archived, err := archivedFromQuery(c)
+	if err != nil {
+		return filter, err
+	}
+	filter.Archived = archived
+
+	if expr := c.Query("filter"); strings.TrimSpace(expr) != "" {
+		parsed, err := services.ParseFilterExpr(expr)
+		if err != nil {
+			return filter, err
+		}
+		filter.Expr = parsed
+	}
+	return filter, nil
+}
+
+// pageRequestFromQuery reads the paging of GET /todos from the query string:
+// sort, a comma separated list of fields with - for descending order, limit
+// and the cursor returned as next_cursor by the previous page
+func pageRequestFromQuery(c *gin.Context) (services.PageRequest, error) {
+	order, err := services.ParseTodoSort(c.Query("sort"))
+	if err != nil {
+		return services.PageRequest{}, err
+	}
+	page := services.PageRequest{Sort: order, Cursor: c.Query("cursor")}
+	if limit := c.Query("limit"); limit != "" {
+		page.Limit, err = strconv.Atoi(limit)
+		if err != nil || page.Limit < 1 || page.Limit > services.MaxPageSize {
+			return page, fmt.Errorf("invalid limit %q, expected a number from 1 to %d", limit, services.MaxPageSize)
+		}
+	}
+	return page, nil
 }
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"todo-cli/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// searchTodos serves GET /todos/search?q=words&limit=n&archived=true|all
+func (h *handler) searchTodos(c *gin.Context) {
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > services.MaxSearchLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid limit %q, expected a number from 1 to %d", value, services.MaxSearchLimit)})
+			return
+		}
+	}
+
+	archived, err := archivedFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results, err := h.todos.SearchTodos(objUserID, c.Query("q"), limit, archived)
+	if errors.Is(err, services.ErrEmptySearch) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"todo-cli/models"
+	"todo-cli/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionRoutes lists and revokes the sessions opened by logging in
+func SessionRoutes(router *gin.RouterGroup, h *handler, tokens services.TokenStore) {
+	protected := router.Group("/user/sessions")
+	protected.Use(AuthMiddleware(tokens))
+	{
+		protected.GET("/", ExtractUserIDFromJWT, RequireScope(models.ScopeAdmin), h.listSessions)
+		protected.DELETE("/", ExtractUserIDFromJWT, RequireScope(models.ScopeAdmin), h.revokeAllSessions)
+		protected.DELETE("/:id", ExtractUserIDFromJWT, RequireScope(models.ScopeAdmin), h.revokeSession)
+	}
+}
+
+func (h *handler) listSessions(c *gin.Context) {
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.users.ListSessions(objUserID, c.GetString("sessionID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+func (h *handler) revokeSession(c *gin.Context) {
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	err := h.users.RevokeSession(objUserID, c.Param("id"))
+	if errors.Is(err, services.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked", "current": c.Param("id") == c.GetString("sessionID")})
+}
+
+// revokeAllSessions logs the user out everywhere, this session included
+func (h *handler) revokeAllSessions(c *gin.Context) {
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.users.RevokeAllSessions(objUserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out everywhere"})
+}
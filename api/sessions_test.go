@@ -0,0 +1,55 @@
+package api_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"todo-cli/models"
+)
+
+func TestSessions(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.login("alice")
+	var phone tokens
+	s.expect(s.do("POST", "/user/login", "", map[string]string{"username": "alice", "password": "secret"}, &phone, "User-Agent", "todo-cli (phone; android/arm64)"), http.StatusOK)
+	var third tokens
+	s.expect(s.do("POST", "/user/login", "", map[string]string{"username": "alice", "password": "secret"}, &third), http.StatusOK)
+
+	var list struct {
+		Sessions []models.Token `json:"sessions"`
+	}
+	rec := s.do("GET", "/user/sessions/", phone.Token, nil, &list)
+	s.expect(rec, http.StatusOK)
+	if len(list.Sessions) != 3 {
+		t.Fatalf("alice has %d sessions, want 3", len(list.Sessions))
+	}
+	if strings.Contains(rec.Body.String(), "hash") {
+		t.Errorf("the sessions are listed with their refresh token hashes: %s", rec.Body)
+	}
+	var current models.Token
+	for _, session := range list.Sessions {
+		if session.Current {
+			current = session
+		}
+	}
+	if current.UserAgent != "todo-cli (phone; android/arm64)" || current.IP == "" {
+		t.Errorf("the current session is %+v, want the one of the phone", current)
+	}
+
+	// Others cannot revoke the session
+	bob := s.login("bob")
+	s.expect(s.do("DELETE", "/user/sessions/"+current.ID, bob.Token, nil, nil), http.StatusNotFound)
+	s.expect(s.do("GET", "/todos/", phone.Token, nil, nil), http.StatusOK)
+
+	s.expect(s.do("DELETE", "/user/sessions/"+current.ID, alice.Token, nil, nil), http.StatusOK)
+	s.expect(s.do("GET", "/todos/", phone.Token, nil, nil), http.StatusUnauthorized)
+	s.expect(s.do("POST", "/user/refresh", "", map[string]string{"refresh_token": phone.RefreshToken}, nil), http.StatusUnauthorized)
+	s.expect(s.do("GET", "/todos/", alice.Token, nil, nil), http.StatusOK)
+
+	s.expect(s.do("DELETE", "/user/sessions/", alice.Token, nil, nil), http.StatusOK)
+	for _, session := range []tokens{alice, third} {
+		s.expect(s.do("GET", "/todos/", session.Token, nil, nil), http.StatusUnauthorized)
+	}
+	s.expect(s.do("GET", "/todos/", bob.Token, nil, nil), http.StatusOK)
+}
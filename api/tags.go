@@ -0,0 +1,131 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"todo-cli/models"
+	"todo-cli/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TagRoutes(router *gin.RouterGroup, h *handler, tokens services.TokenStore) {
+	protected := router.Group("/tags")
+	protected.Use(AuthMiddleware(tokens))
+	{
+		protected.GET("/", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosRead), h.listTags)
+		protected.PUT("/:tag", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosWrite), h.renameTag)
+		protected.DELETE("/:tag", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosWrite), h.deleteTag)
+	}
+}
+
+func (h *handler) listTags(c *gin.Context) {
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	tags, err := h.todos.ListTags(objUserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tags)
+}
+
+func (h *handler) renameTag(c *gin.Context) {
+	var rename struct {
+		Name string `json:"name" validate:"required"`
+	}
+	if err := c.ShouldBindJSON(&rename); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	var changed int
+	err := h.todos.Undoable(objUserID, "rename tag", func(todos *services.TodoService) (err error) {
+		changed, err = todos.RenameTag(objUserID, c.Param("tag"), rename.Name)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Tag renamed", "todos": changed})
+}
+
+func (h *handler) deleteTag(c *gin.Context) {
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	var changed int
+	err := h.todos.Undoable(objUserID, "delete tag", func(todos *services.TodoService) (err error) {
+		changed, err = todos.DeleteTag(objUserID, c.Param("tag"))
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Tag deleted", "todos": changed})
+}
+
+func (h *handler) addTodoTags(c *gin.Context) {
+	var body struct {
+		Tags []string `json:"tags"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	var result models.Todo
+	err := h.todos.Undoable(objUserID, "tag todo", func(todos *services.TodoService) (err error) {
+		result, err = todos.AddTags(c.Param("id"), objUserID, body.Tags)
+		return err
+	})
+	if errors.Is(err, services.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *handler) removeTodoTag(c *gin.Context) {
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	var result models.Todo
+	err := h.todos.Undoable(objUserID, "untag todo", func(todos *services.TodoService) (err error) {
+		result, err = todos.RemoveTags(c.Param("id"), objUserID, []string{c.Param("tag")})
+		return err
+	})
+	if errors.Is(err, services.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"todo-cli/models"
+	"todo-cli/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessTokenRoutes creates, lists and revokes personal access tokens
+func AccessTokenRoutes(router *gin.RouterGroup, h *handler, tokens services.TokenStore) {
+	protected := router.Group("/user/tokens")
+	protected.Use(AuthMiddleware(tokens))
+	{
+		protected.GET("/", ExtractUserIDFromJWT, RequireScope(models.ScopeAdmin), h.listAccessTokens)
+		protected.POST("/", ExtractUserIDFromJWT, RequireScope(models.ScopeAdmin), h.createAccessToken)
+		protected.DELETE("/:id", ExtractUserIDFromJWT, RequireScope(models.ScopeAdmin), h.revokeAccessToken)
+	}
+}
+
+// createAccessToken answers with the token itself, which is never shown again
+func (h *handler) createAccessToken(c *gin.Context) {
+	var body struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	token, err := h.users.CreateAccessToken(objUserID, body.Name, body.Scopes, body.ExpiresAt)
+	var tokenErr *services.AccessTokenError
+	if errors.As(err, &tokenErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": tokenErr.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, token)
+}
+
+func (h *handler) listAccessTokens(c *gin.Context) {
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.users.ListAccessTokens(objUserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+func (h *handler) revokeAccessToken(c *gin.Context) {
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	err := h.users.RevokeAccessToken(objUserID, c.Param("id"))
+	if errors.Is(err, services.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
@@ -0,0 +1,90 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"todo-cli/models"
+	"todo-cli/services"
+)
+
+// createToken creates a personal access token with the scopes for the session
+func (s *testServer) createToken(session, name string, scopes ...string) services.NewAccessToken {
+	s.t.Helper()
+	var token services.NewAccessToken
+	s.expect(s.do("POST", "/user/tokens/", session, map[string]interface{}{"name": name, "scopes": scopes}, &token), http.StatusCreated)
+	return token
+}
+
+func TestRequireScope(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.login("alice")
+	todo := s.create(alice.Token, "report")
+	bearers := map[string]string{
+		"session":              alice.Token,
+		models.ScopeTodosRead:  s.createToken(alice.Token, "dashboard", models.ScopeTodosRead).Token,
+		models.ScopeTodosWrite: s.createToken(alice.Token, "sync", models.ScopeTodosWrite).Token,
+		models.ScopeAdmin:      s.createToken(alice.Token, "backup", models.ScopeAdmin).Token,
+	}
+
+	rename := map[string]string{"title": "quarterly report"}
+	tests := []struct {
+		name         string
+		method, path string
+		body         interface{}
+		status       map[string]int // by bearer
+	}{
+		{"list", "GET", "/todos/", nil, map[string]int{"session": 200, models.ScopeTodosRead: 200, models.ScopeTodosWrite: 200, models.ScopeAdmin: 200}},
+		{"trash", "GET", "/trash/", nil, map[string]int{"session": 200, models.ScopeTodosRead: 200, models.ScopeTodosWrite: 200, models.ScopeAdmin: 200}},
+		{"update", "PUT", "/todos/" + todo.ID.Hex(), rename, map[string]int{"session": 200, models.ScopeTodosRead: 403, models.ScopeTodosWrite: 200, models.ScopeAdmin: 200}},
+		{"undo", "POST", "/todos/undo", nil, map[string]int{models.ScopeTodosRead: 403}},
+		{"sessions", "GET", "/user/sessions/", nil, map[string]int{"session": 200, models.ScopeTodosRead: 403, models.ScopeTodosWrite: 403, models.ScopeAdmin: 200}},
+		{"tokens", "GET", "/user/tokens/", nil, map[string]int{"session": 200, models.ScopeTodosRead: 403, models.ScopeTodosWrite: 403, models.ScopeAdmin: 200}},
+	}
+	for _, tt := range tests {
+		for bearer, status := range tt.status {
+			if rec := s.do(tt.method, tt.path, bearers[bearer], tt.body, nil); rec.Code != status {
+				t.Errorf("%s with %s got status %d, want %d: %s", tt.name, bearer, rec.Code, status, rec.Body)
+			}
+		}
+	}
+
+	// A token acts for the user who created it
+	var got models.Todo
+	s.expect(s.do("GET", "/todos/"+todo.ID.Hex(), bearers[models.ScopeTodosRead], nil, &got), http.StatusOK)
+	bob := s.login("bob")
+	s.expect(s.do("GET", "/todos/"+todo.ID.Hex(), bob.Token, nil, nil), http.StatusNotFound)
+}
+
+func TestAccessTokens(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.login("alice")
+
+	for _, body := range []map[string]interface{}{
+		{"name": "", "scopes": []string{models.ScopeTodosRead}},
+		{"name": "sync", "scopes": []string{}},
+		{"name": "sync", "scopes": []string{"todos:delete"}},
+		{"name": "sync", "scopes": []string{models.ScopeTodosRead}, "expires_at": time.Now().Add(-time.Hour)},
+	} {
+		if rec := s.do("POST", "/user/tokens/", alice.Token, body, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("creating the token %v got status %d, want 400", body, rec.Code)
+		}
+	}
+
+	token := s.createToken(alice.Token, "sync", models.ScopeTodosWrite)
+	s.expect(s.do("GET", "/todos/", token.Token, nil, nil), http.StatusOK)
+
+	var list struct {
+		Tokens []models.AccessToken `json:"tokens"`
+	}
+	s.expect(s.do("GET", "/user/tokens/", alice.Token, nil, &list), http.StatusOK)
+	if len(list.Tokens) != 1 || list.Tokens[0].Name != "sync" || list.Tokens[0].LastUsedAt == nil {
+		t.Errorf("alice has the tokens %+v, want sync marked as used", list.Tokens)
+	}
+
+	bob := s.login("bob")
+	s.expect(s.do("DELETE", "/user/tokens/"+token.ID.Hex(), bob.Token, nil, nil), http.StatusNotFound)
+	s.expect(s.do("DELETE", "/user/tokens/"+token.ID.Hex(), alice.Token, nil, nil), http.StatusOK)
+	s.expect(s.do("GET", "/todos/", token.Token, nil, nil), http.StatusUnauthorized)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"todo-cli/models"
+	"todo-cli/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TrashRoutes(router *gin.RouterGroup, h *handler, tokens services.TokenStore) {
+	protected := router.Group("/trash")
+	protected.Use(AuthMiddleware(tokens))
+	{
+		protected.GET("/", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosRead), h.getTrash)
+		protected.POST("/:id/restore", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosWrite), h.restoreTodo)
+		protected.DELETE("/", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosWrite), h.emptyTrash)
+	}
+}
+
+func (h *handler) getTrash(c *gin.Context) {
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	todos, err := h.todos.GetTrash(objUserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, todos)
+}
+
+func (h *handler) restoreTodo(c *gin.Context) {
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	var todo models.Todo
+	err := h.todos.Undoable(objUserID, "restore todo", func(todos *services.TodoService) (err error) {
+		todo, err = todos.RestoreTodo(c.Param("id"), objUserID)
+		return err
+	})
+	if errors.Is(err, services.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found in the trash"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, todo)
+}
+
+// emptyTrash deletes every todo in the trash of the user for good
+func (h *handler) emptyTrash(c *gin.Context) {
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	deleted, err := h.todos.EmptyTrash(objUserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Trash emptied", "deleted": deleted})
+}
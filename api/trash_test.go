@@ -0,0 +1,69 @@
+package api_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"todo-cli/models"
+	"todo-cli/services"
+)
+
+// listed returns the titles GET /todos lists with the query string
+func (s *testServer) listed(token, query string) []string {
+	s.t.Helper()
+	var page services.TodoPage
+	s.expect(s.do("GET", "/todos/"+query, token, nil, &page), http.StatusOK)
+	var titles []string
+	for _, todo := range page.Todos {
+		titles = append(titles, todo.Title)
+	}
+	return titles
+}
+
+func TestTrash(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.login("alice")
+	report := s.create(alice.Token, "report")
+	taxes := s.create(alice.Token, "taxes")
+	s.create(alice.Token, "groceries")
+
+	for _, todo := range []models.Todo{report, taxes} {
+		s.expect(s.do("DELETE", "/todos/"+todo.ID.Hex(), alice.Token, nil, nil), http.StatusOK)
+	}
+	if got := s.listed(alice.Token, ""); !reflect.DeepEqual(got, []string{"groceries"}) {
+		t.Errorf("after deleting two todos %v are listed", got)
+	}
+	var trash []models.Todo
+	s.expect(s.do("GET", "/trash/", alice.Token, nil, &trash), http.StatusOK)
+	if len(trash) != 2 || trash[0].DeletedAt == nil || trash[1].DeletedAt == nil {
+		t.Fatalf("the trash holds %d todos, want report and taxes marked deleted", len(trash))
+	}
+
+	// Others can neither see nor restore the todos
+	bob := s.login("bob")
+	s.expect(s.do("GET", "/trash/", bob.Token, nil, &trash), http.StatusOK)
+	if len(trash) != 0 {
+		t.Errorf("bob sees %d todos in the trash", len(trash))
+	}
+	s.expect(s.do("POST", "/trash/"+report.ID.Hex()+"/restore", bob.Token, nil, nil), http.StatusNotFound)
+
+	var restored models.Todo
+	s.expect(s.do("POST", "/trash/"+report.ID.Hex()+"/restore", alice.Token, nil, &restored), http.StatusOK)
+	if restored.DeletedAt != nil {
+		t.Errorf("the restored todo is still marked deleted")
+	}
+	s.expect(s.do("POST", "/trash/"+report.ID.Hex()+"/restore", alice.Token, nil, nil), http.StatusNotFound)
+
+	var emptied struct {
+		Deleted int `json:"deleted"`
+	}
+	s.expect(s.do("DELETE", "/trash/", alice.Token, nil, &emptied), http.StatusOK)
+	if emptied.Deleted != 1 {
+		t.Errorf("emptying the trash deleted %d todos, want 1", emptied.Deleted)
+	}
+	s.expect(s.do("POST", "/trash/"+taxes.ID.Hex()+"/restore", alice.Token, nil, nil), http.StatusNotFound)
+	if got := s.listed(alice.Token, ""); !reflect.DeepEqual(got, []string{"report", "groceries"}) {
+		t.Errorf("after restoring report %v are listed", got)
+	}
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"todo-cli/models"
+	"todo-cli/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// undo reverts the last operation of the user on their todos
+func (h *handler) undo(c *gin.Context) {
+	h.replay(c, "Undone", h.todos.Undo)
+}
+
+// redo applies the last undone operation of the user again
+func (h *handler) redo(c *gin.Context) {
+	h.replay(c, "Redone", h.todos.Redo)
+}
+
+func (h *handler) replay(c *gin.Context, done string, replay func(primitive.ObjectID) (models.Operation, error)) {
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	op, err := replay(objUserID)
+	var conflict *services.UndoConflictError
+	switch {
+	case errors.Is(err, services.ErrNothingToUndo), errors.Is(err, services.ErrNothingToRedo):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.As(err, &conflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "todo_id": conflict.TodoID})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": done + ": " + op.Name, "operation": op})
+	}
+}
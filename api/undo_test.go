@@ -0,0 +1,57 @@
+package api_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"todo-cli/models"
+)
+
+// replay undoes or redoes the last operation and returns its name
+func (s *testServer) replay(path, token string) string {
+	s.t.Helper()
+	var result struct {
+		Operation models.Operation `json:"operation"`
+	}
+	s.expect(s.do("POST", path, token, nil, &result), http.StatusOK)
+	return result.Operation.Name
+}
+
+func TestUndoRedo(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.login("alice")
+	bob := s.login("bob")
+	s.expect(s.do("POST", "/todos/undo", alice.Token, nil, nil), http.StatusNotFound)
+
+	report := s.create(alice.Token, "report")
+	s.create(alice.Token, "taxes")
+	s.expect(s.do("PUT", "/todos/"+report.ID.Hex(), alice.Token, map[string]interface{}{"title": "quarterly report"}, nil), http.StatusOK)
+	s.expect(s.do("DELETE", "/todos/"+report.ID.Hex(), alice.Token, nil, nil), http.StatusOK)
+
+	// Every user undoes their own operations
+	s.expect(s.do("POST", "/todos/undo", bob.Token, nil, nil), http.StatusNotFound)
+
+	steps := []struct {
+		path, op string
+		want     []string
+	}{
+		{"/todos/undo", "delete todo", []string{"quarterly report", "taxes"}},
+		{"/todos/undo", "update todo", []string{"report", "taxes"}},
+		{"/todos/undo", "create todo", []string{"report"}},
+		{"/todos/redo", "create todo", []string{"report", "taxes"}},
+		{"/todos/redo", "update todo", []string{"quarterly report", "taxes"}},
+	}
+	for _, step := range steps {
+		if op := s.replay(step.path, alice.Token); op != step.op {
+			t.Fatalf("POST %s replayed %q, want %q", step.path, op, step.op)
+		}
+		if got := s.listed(alice.Token, ""); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("after POST %s of %s %v are listed, want %v", step.path, step.op, got, step.want)
+		}
+	}
+
+	// A new change drops what was left to redo
+	s.create(alice.Token, "groceries")
+	s.expect(s.do("POST", "/todos/redo", alice.Token, nil, nil), http.StatusNotFound)
+}
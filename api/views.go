@@ -0,0 +1,178 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"todo-cli/models"
+	"todo-cli/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+func ViewRoutes(router *gin.RouterGroup, h *handler, tokens services.TokenStore) {
+	protected := router.Group("/views")
+	protected.Use(AuthMiddleware(tokens))
+	{
+		protected.GET("/", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosRead), h.getAllViews)
+		protected.GET("/:id", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosRead), h.getView)
+		protected.GET("/:id/todos", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosRead), h.runView)
+		protected.POST("/", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosWrite), h.createView)
+		protected.PUT("/:id", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosWrite), h.updateView)
+		protected.DELETE("/:id", ExtractUserIDFromJWT, RequireScope(models.ScopeTodosWrite), h.deleteView)
+	}
+}
+
+// viewError responds with the status matching an error of the view service
+func viewError(c *gin.Context, err error) {
+	var syntaxErr *services.FilterSyntaxError
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "View not found"})
+	case errors.Is(err, services.ErrBuiltInView):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrViewExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.As(err, &syntaxErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "column": syntaxErr.Column})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
+
+func (h *handler) getAllViews(c *gin.Context) {
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	views, err := h.views.GetViews(objUserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, views)
+}
+
+func (h *handler) getView(c *gin.Context) {
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	view, err := h.views.GetViewByID(c.Param("id"), objUserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "View not found"})
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+// runView serves GET /views/:id/todos, one page of the todos the view lists.
+// It takes the tz, sort, limit and cursor parameters of GET /todos, the sort
+// of the view applies unless one is given.
+func (h *handler) runView(c *gin.Context) {
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	var loc *time.Location
+	if tz := c.Query("tz"); tz != "" {
+		var err error
+		if loc, err = services.ParseLocation(tz); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	page, err := pageRequestFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if c.Query("sort") == "" {
+		page.Sort = nil
+	}
+
+	todos, err := h.views.RunView(c.Param("id"), objUserID, loc, page)
+	if err != nil {
+		viewError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, todos)
+}
+
+func (h *handler) createView(c *gin.Context) {
+	var newView struct {
+		Name   string `json:"name" validate:"required,min=1,max=100"`
+		Filter string `json:"filter" validate:"max=1000"`
+		Sort   string `json:"sort"`
+	}
+	if err := c.ShouldBindJSON(&newView); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	// Validate the view struct
+	if err := validate.Struct(&newView); err != nil {
+		// Return validation errors
+		validationErrors := err.(validator.ValidationErrors)
+		errors := make(map[string]string)
+		for _, vErr := range validationErrors {
+			errors[vErr.Field()] = vErr.Tag()
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"errors": errors})
+		return
+	}
+
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	view, err := h.views.CreateView(objUserID, newView.Name, newView.Filter, newView.Sort)
+	if err != nil {
+		viewError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, view)
+}
+
+func (h *handler) updateView(c *gin.Context) {
+	var update models.SavedViewUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	if err := validate.Struct(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	update.UpdatedAt = time.Now()
+
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	view, err := h.views.UpdateView(c.Param("id"), objUserID, update)
+	if err != nil {
+		viewError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+func (h *handler) deleteView(c *gin.Context) {
+	objUserID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.views.DeleteView(c.Param("id"), objUserID); err != nil {
+		viewError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "View deleted"})
+}
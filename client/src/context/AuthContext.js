@@ -1,10 +1,16 @@
-import React, { createContext, useState, useEffect } from "react";
+import React, { createContext, useState, useEffect, useRef } from "react";
+import axios from "axios";
 
 const AuthContext = createContext();
 
+const REFRESH_PATH = "/user/refresh";
+
 export const AuthProvider = ({ children }) => {
   const [token, setToken] = useState(localStorage.getItem("token"));
   const [user, setUser] = useState(null);
+  // Requests failing at the same time share a single refresh, a refresh
+  // token can only be used once
+  const refreshing = useRef(null);
 
   useEffect(() => {
     if (token) {
@@ -13,17 +19,65 @@ export const AuthProvider = ({ children }) => {
     }
   }, [token]);
 
-  const login = (newToken) => {
+  const login = (newToken, refreshToken) => {
     localStorage.setItem("token", newToken);
+    if (refreshToken) {
+      localStorage.setItem("refreshToken", refreshToken);
+    }
     setToken(newToken);
   };
 
   const logout = () => {
     localStorage.removeItem("token");
+    localStorage.removeItem("refreshToken");
     setToken(null);
     setUser(null);
   };
 
+  // Renew the access token when a request is turned down with 401 and send
+  // the request again, logging out once the session cannot be refreshed
+  useEffect(() => {
+    const refresh = async () => {
+      const response = await axios.post(
+        process.env.REACT_APP_TODO_SERVER_PATH + REFRESH_PATH,
+        { refresh_token: localStorage.getItem("refreshToken") }
+      );
+      login(response.data.token, response.data.refresh_token);
+      return response.data.token;
+    };
+
+    const interceptor = axios.interceptors.response.use(
+      (response) => response,
+      async (error) => {
+        const request = error.config;
+        if (
+          error.response?.status !== 401 ||
+          !request?.headers?.Authorization ||
+          request.url.endsWith(REFRESH_PATH) ||
+          request.retried ||
+          !localStorage.getItem("refreshToken")
+        ) {
+          return Promise.reject(error);
+        }
+        request.retried = true;
+        try {
+          refreshing.current = refreshing.current ?? refresh();
+          const newToken = await refreshing.current;
+          request.headers.Authorization = `Bearer ${newToken}`;
+          return axios(request);
+        } catch (refreshError) {
+          logout();
+          return Promise.reject(error);
+        } finally {
+          refreshing.current = null;
+        }
+      }
+    );
+    return () => axios.interceptors.response.eject(interceptor);
+    // login and logout only touch state setters and localStorage
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, []);
+
   return (
     <AuthContext.Provider value={{ token, user, login, logout }}>
       {children}
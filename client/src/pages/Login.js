@@ -24,7 +24,7 @@ const Login = () => {
           password,
         }
       );
-      login(response.data.token);
+      login(response.data.token, response.data.refresh_token);
       navigate("/todos");
     } catch (error) {
       setError(error.response.data?.error ?? "Something went wrong");
@@ -26,7 +26,7 @@ const TodoList = () => {
             },
           }
         );
-        setTodos(response.data);
+        setTodos(response.data.todos);
       } catch (error) {
         console.error("Error fetching todos:", error);
       }
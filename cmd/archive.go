@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Group command: `todo archive`
+var archiveCmd = &cobra.Command{
+	Use:   "archive",
+	Short: "Archive completed todos and browse the archive",
+}
+
+func init() {
+	archiveCompletedCmd.Flags().Int("older-than", 0, "only archive todos completed at least this many days ago")
+	archiveCmd.AddCommand(archiveCompletedCmd)
+
+	archiveLsCmd.Flags().String("sort", "-archived_at", "comma separated fields to sort by, - for descending")
+	archiveLsCmd.Flags().Int("limit", 0, "number of todos per page, or of search results")
+	archiveLsCmd.Flags().Int("page", 0, "only fetch this page, counted from 1")
+	archiveLsCmd.Flags().Bool("json", false, "print the raw JSON response")
+	archiveCmd.AddCommand(archiveLsCmd)
+
+	archiveCmd.AddCommand(archiveRestoreCmd)
+
+	todoCmd.AddCommand(archiveCmd)
+}
+
+var archiveCompletedCmd = &cobra.Command{
+	Use:   "completed",
+	Short: "Archive the completed todos, hiding them from todo get",
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+
+		// Create a new Resty Client
+		restyClient := apiClient()
+		request := restyClient.R().SetHeader("Authorization", "Bearer "+token)
+		if days, _ := cmd.Flags().GetInt("older-than"); days > 0 {
+			request.SetQueryParam("older_than_days", strconv.Itoa(days))
+		}
+		resp, err := request.Post(TODO_SERVER_PATH + "/todos/archive-completed")
+		if err != nil {
+			fmt.Println("Error:", err)
+		} else {
+			fmt.Println("Response:", resp.String())
+		}
+	},
+}
+
+var archiveLsCmd = &cobra.Command{
+	Use:   "ls [words...]",
+	Short: "List the archived todos, or search them for the given words",
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+		raw, _ := cmd.Flags().GetBool("json")
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		if len(args) > 0 {
+			request := apiClient().R().
+				SetHeader("Authorization", "Bearer "+token).
+				SetQueryParam("q", strings.Join(args, " ")).
+				SetQueryParam("archived", "true")
+			if limit > 0 {
+				request.SetQueryParam("limit", strconv.Itoa(limit))
+			}
+			resp, err := request.Get(TODO_SERVER_PATH + "/todos/search")
+			if err != nil {
+				fmt.Println("Error searching todos:", err)
+				return
+			}
+			if raw || resp.IsError() {
+				fmt.Println(string(resp.Body()))
+				return
+			}
+			var found struct {
+				Results []searchResult `json:"results"`
+			}
+			if err := json.Unmarshal(resp.Body(), &found); err != nil {
+				fmt.Println(string(resp.Body()))
+				return
+			}
+			printSearchResults(found.Results)
+			return
+		}
+
+		query := url.Values{}
+		query.Set("archived", "true")
+		if sort, _ := cmd.Flags().GetString("sort"); sort != "" {
+			query.Set("sort", sort)
+		}
+		page, _ := cmd.Flags().GetInt("page")
+		todos, err := fetchTodoPages(token, "/todos", query, limit, page)
+		if err != nil {
+			fmt.Println("Error fetching todos:", err)
+			return
+		}
+		if raw {
+			body, _ := json.Marshal(todos)
+			fmt.Println(string(body))
+			return
+		}
+		if err := printTodoTree(todos.Todos); err != nil {
+			fmt.Println("Error reading todos:", err)
+		}
+		if page > 0 && todos.NextCursor != "" {
+			fmt.Printf("More todos on --page %d\n", page+1)
+		}
+	},
+}
+
+var archiveRestoreCmd = &cobra.Command{
+	Use:   "restore [id]...",
+	Short: "Take todos out of the archive",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+
+		// Create a new Resty Client
+		restyClient := apiClient()
+		for _, id := range args {
+			resp, err := restyClient.R().
+				SetHeader("Authorization", "Bearer "+token).
+				SetHeader("Content-Type", "application/json").
+				SetBody(map[string]interface{}{"archived": false}).
+				Put(fmt.Sprintf(TODO_SERVER_PATH+"/todos/%s", id))
+			if err != nil {
+				fmt.Println("Error:", err)
+				continue
+			}
+			if resp.IsError() {
+				fmt.Printf("Error restoring %s: %s\n", id, resp.String())
+				continue
+			}
+			fmt.Println("TODO restored:", resp.String())
+		}
+	},
+}
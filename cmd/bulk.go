@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+
+	"todo-cli/services"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	doneTodoCmd.Flags().Bool("json", false, "print the raw JSON response")
+	todoCmd.AddCommand(doneTodoCmd)
+}
+
+// bulkOperation is one operation of POST /todos/bulk
+type bulkOperation struct {
+	Op string `json:"op"`
+	ID string `json:"id,omitempty"`
+}
+
+// bulkResult is the outcome of one operation of POST /todos/bulk
+type bulkResult struct {
+	Op     string `json:"op"`
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Todo   *struct {
+		Title string `json:"title"`
+	} `json:"todo"`
+}
+
+// postBulk sends operations to POST /todos/bulk, as many requests as the
+// server limit needs, and prints the outcome of each, or the raw responses
+// with raw set
+func postBulk(token string, ops []bulkOperation, raw bool) {
+	for len(ops) > services.MaxBulkOperations {
+		postBulk(token, ops[:services.MaxBulkOperations], raw)
+		ops = ops[services.MaxBulkOperations:]
+	}
+
+	var result struct {
+		Results []bulkResult `json:"results"`
+		Failed  int          `json:"failed"`
+		Error   string       `json:"error"`
+	}
+	resp, err := apiClient().R().
+		SetHeader("Authorization", "Bearer "+token).
+		SetHeader("Content-Type", "application/json").
+		SetBody(map[string]interface{}{"operations": ops}).
+		Post(TODO_SERVER_PATH + "/todos/bulk")
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if raw || json.Unmarshal(resp.Body(), &result) != nil || result.Results == nil {
+		fmt.Println(resp.String())
+		return
+	}
+
+	for _, r := range result.Results {
+		switch {
+		case r.Status != "ok":
+			fmt.Printf("%s  %s: %s\n", r.ID, r.Status, r.Error)
+		case r.Todo != nil:
+			fmt.Printf("%s  %s: %s\n", r.ID, r.Op, r.Todo.Title)
+		default:
+			fmt.Printf("%s  %s\n", r.ID, r.Op)
+		}
+	}
+	if result.Failed > 0 {
+		fmt.Printf("%d of %d failed\n", result.Failed, len(result.Results))
+	}
+}
+
+var doneTodoCmd = &cobra.Command{
+	Use:   "done [id]...",
+	Short: "Complete one or more todos in a single request",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+
+		ops := make([]bulkOperation, len(args))
+		for i, id := range args {
+			ops[i] = bulkOperation{Op: "complete", ID: id}
+		}
+		raw, _ := cmd.Flags().GetBool("json")
+		postBulk(token, ops, raw)
+	},
+}
+
+// matchingTodos lists the todos matching a --where expression. Subtasks
+// whose parent matches as well are left out, deleting the parent takes them
+// along.
+func matchingTodos(token, where string) ([]treeTodo, error) {
+	query := url.Values{}
+	query.Set("filter", where)
+	query.Set("tz", localOffset())
+	page, err := fetchTodoPages(token, "/todos", query, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	todos := make([]treeTodo, len(page.Todos))
+	matched := map[string]bool{}
+	for i, raw := range page.Todos {
+		if err := json.Unmarshal(raw, &todos[i]); err != nil {
+			return nil, err
+		}
+		matched[todos[i].ID] = true
+	}
+	var roots []treeTodo
+	for _, todo := range todos {
+		if !matched[todo.ParentID] {
+			roots = append(roots, todo)
+		}
+	}
+	return roots, nil
+}
+
+// deleteTodos moves the given todos and the ones matching --where to the
+// trash in a single request, asking first for --where unless --yes is set
+func deleteTodos(cmd *cobra.Command, token string, ids []string) {
+	if where, _ := cmd.Flags().GetString("where"); where != "" {
+		if err := checkWhere(where); err != nil {
+			log.Fatal(err)
+		}
+		todos, err := matchingTodos(token, where)
+		if err != nil {
+			log.Fatalf("Error fetching todos: %v", err)
+		}
+		if len(todos) == 0 && len(ids) == 0 {
+			fmt.Println("No todos match.")
+			return
+		}
+		if yes, _ := cmd.Flags().GetBool("yes"); !yes {
+			for _, todo := range todos {
+				fmt.Printf("  %s  %s\n", todo.ID, todo.Title)
+			}
+			fmt.Printf("Move %d todos to the trash? [y/N] ", len(todos)+len(ids))
+			answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+				fmt.Println("Nothing deleted.")
+				return
+			}
+		}
+		for _, todo := range todos {
+			ids = append(ids, todo.ID)
+		}
+	}
+
+	ops := make([]bulkOperation, len(ids))
+	for i, id := range ids {
+		ops[i] = bulkOperation{Op: "delete", ID: id}
+	}
+	postBulk(token, ops, false)
+}
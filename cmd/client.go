@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// renewed maps the access tokens refreshed during this run to their
+// successors, so requests built with an old one go out with the new one
+var renewed = map[string]string{}
+
+// userAgent names the CLI and the machine it runs on, the server shows it
+// in the list of sessions
+func userAgent() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown host"
+	}
+	return fmt.Sprintf("todo-cli (%s; %s/%s)", host, runtime.GOOS, runtime.GOARCH)
+}
+
+// errNoServer is returned by requests when there is no server to send them to
+var errNoServer = errors.New("TODO_SERVER_PATH is not set, nor is a context selected, see `todo-cli context`")
+
+// apiClient returns a client for the API that refreshes the session and
+// tries once more when a request is turned down with 401
+func apiClient() *resty.Client {
+	return resty.New().
+		SetHeader("User-Agent", userAgent()).
+		OnBeforeRequest(func(_ *resty.Client, req *resty.Request) error {
+			if TODO_SERVER_PATH == "" {
+				return errNoServer
+			}
+			auth := req.Header.Get("Authorization")
+			if token, ok := renewed[strings.TrimPrefix(auth, "Bearer ")]; ok && strings.HasPrefix(auth, "Bearer ") {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			return nil
+		}).
+		SetRetryCount(1).
+		AddRetryCondition(func(resp *resty.Response, err error) bool {
+			if err != nil || resp.StatusCode() != http.StatusUnauthorized {
+				return false
+			}
+			auth := resp.Request.Header.Get("Authorization")
+			if !strings.HasPrefix(auth, "Bearer ") {
+				return false
+			}
+			creds, err := loadCredentials()
+			if err != nil {
+				return false
+			}
+			// Loading the credentials may have refreshed them already, or
+			// another run of the CLI did
+			if token := strings.TrimPrefix(auth, "Bearer "); token != creds.Token {
+				renewed[token] = creds.Token
+				return true
+			}
+			_, err = refreshCredentials(creds)
+			return err == nil
+		})
+}
+
+// refreshCredentials trades the refresh token of the credentials for new
+// tokens and saves them
+func refreshCredentials(creds credentials) (credentials, error) {
+	if creds.RefreshToken == "" {
+		return creds, errLoginExpired
+	}
+	server := creds.Server
+	if server == "" {
+		server = TODO_SERVER_PATH
+	}
+	if server == "" {
+		return creds, errNoServer
+	}
+	var result struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	resp, err := resty.New().R().
+		SetHeader("User-Agent", userAgent()).
+		SetHeader("Content-Type", "application/json").
+		SetBody(map[string]string{"refresh_token": creds.RefreshToken}).
+		Post(server + "/user/refresh")
+	if err != nil {
+		return creds, err
+	}
+	if resp.StatusCode() != http.StatusOK || json.Unmarshal(resp.Body(), &result) != nil {
+		return creds, errLoginExpired
+	}
+
+	fresh, err := newCredentials(creds.Server, creds.Username, result.Token, result.RefreshToken)
+	if err != nil {
+		return creds, err
+	}
+	if err := saveCredentials(fresh); err != nil {
+		return creds, err
+	}
+	renewed[creds.Token] = fresh.Token
+	return fresh, nil
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"todo-cli/api"
+	"todo-cli/db"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/go-resty/resty/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// startServer serves the API on an in-memory store of its own and points
+// the requests at it
+func startServer(t *testing.T) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("SECRET_KEY", "test secret")
+	store, err := db.Open("memory://" + t.Name() + "/" + primitive.NewObjectID().Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(api.NewRouter(store.Stores()))
+	t.Cleanup(server.Close)
+	TODO_SERVER_PATH = server.URL + "/todo-app/api/v1"
+}
+
+func TestAPIClientRefreshes(t *testing.T) {
+	configure(t, "")
+	t.Setenv("TODO_TOKEN", "")
+	startServer(t)
+
+	var login struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	body := map[string]string{"username": "alice", "password": "secret", "email": "alice@example.com"}
+	if resp, err := resty.New().R().SetBody(body).Post(TODO_SERVER_PATH + "/user/register"); err != nil || resp.StatusCode() != http.StatusCreated {
+		t.Fatalf("register returned %v, %v", resp, err)
+	}
+	if resp, err := resty.New().R().SetBody(body).SetResult(&login).Post(TODO_SERVER_PATH + "/user/login"); err != nil || resp.StatusCode() != http.StatusOK {
+		t.Fatalf("login returned %v, %v", resp, err)
+	}
+
+	// The access token of the session expired before the CLI noticed
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(login.Token, claims); err != nil {
+		t.Fatal(err)
+	}
+	claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds := credentials{Server: TODO_SERVER_PATH, UserID: claims["user_id"].(string), Username: "alice", Token: expired, RefreshToken: login.RefreshToken}
+	if err := saveCredentials(creds); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := apiClient().R().SetHeader("Authorization", "Bearer "+expired).Get(TODO_SERVER_PATH + "/todos/")
+	if err != nil || resp.StatusCode() != http.StatusOK {
+		t.Fatalf("the request with the expired token returned %v, %v, want 200 after refreshing", resp.Status(), err)
+	}
+	fresh, err := loadCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh.Token == expired || fresh.RefreshToken == login.RefreshToken {
+		t.Errorf("the refreshed tokens were not saved")
+	}
+
+	// Requests built with the old token go out with the new one
+	resp, err = apiClient().R().SetHeader("Authorization", "Bearer "+expired).Get(TODO_SERVER_PATH + "/todos/")
+	if err != nil || resp.StatusCode() != http.StatusOK || resp.Request.Attempt != 1 {
+		t.Errorf("the next request with the expired token returned %v, %v after %d attempts, want 200 at once", resp.Status(), err, resp.Request.Attempt)
+	}
+}
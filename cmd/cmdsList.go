@@ -1,12 +1,14 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/url"
+	"strings"
+	"time"
 
-	"todo-cli/db"
-
-	"github.com/go-resty/resty/v2"
 	"github.com/spf13/cobra"
 )
 
@@ -14,12 +16,6 @@ import (
 var todoCmd = &cobra.Command{
 	Use:   "todo",
 	Short: "Commands related to todos",
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		// Ensure user_id flag is set for todo commands
-		if userID == "" {
-			log.Fatalf("The --user_id flag is required for this command.")
-		}
-	},
 }
 
 // Group command: `userCmd`
@@ -28,9 +24,6 @@ var userCmd = &cobra.Command{
 	Short: "Commands related to users",
 }
 
-// Declare userID at the package level
-var userID string
-
 func init() {
 
 	// add the groups of comnads
@@ -39,74 +32,107 @@ func init() {
 
 	userCmd.AddCommand(registerCmd) // Add register command
 	userCmd.AddCommand(loginCmd)    // Add login command
-
-	// Define the --user_id flag as a persistent flag foronly logout cmd in user group
-	logoutCmd.Flags().String("user_id", "", "User ID to get the token for")
-	logoutCmd.MarkFlagRequired("user_id")
 	userCmd.AddCommand(logoutCmd)
-
-	// Define the --user_id flag as a persistent flag foronly logout cmd in user group
-	userDetailsCmd.Flags().String("user_id", "", "User ID to get the token for")
-	userDetailsCmd.MarkFlagRequired("user_id")
 	userCmd.AddCommand(userDetailsCmd)
 
 	// Register the getToken command
 	userCmd.AddCommand(getTokenCmd)
 
-	// Define the --user_id flag
-	getTokenCmd.Flags().String("user_id", "", "User ID to get the token for")
-	getTokenCmd.MarkFlagRequired("user_id")
-
-	// Define the --user_id flag as a persistent flag for the `todoCmd` group
-	todoCmd.PersistentFlags().StringVar(&userID, "user_id", "", "User ID to perform actions on todos")
-	todoCmd.MarkPersistentFlagRequired("user_id")
 	var title string
 	var completed bool
 	createTodoCmd.Flags().StringVar(&title, "title", "", "title")
+	createTodoCmd.Flags().String("notes", "", "longer description in Markdown")
 	createTodoCmd.Flags().BoolVar(&completed, "completed", false, "completed")
+	createTodoCmd.Flags().String("due", "", "due date, e.g. 2024-10-31, \"2024-10-31 17:00\" or tomorrow")
+	createTodoCmd.Flags().String("start", "", "start date, same formats as --due")
+	createTodoCmd.Flags().String("priority", "", "none, low, medium, high or urgent")
+	createTodoCmd.Flags().StringSlice("tag", nil, "tag to label the todo with, can be repeated")
+	createTodoCmd.Flags().String("project", "", "project name or ID to add the todo to, defaults to the project of the context")
+	createTodoCmd.Flags().String("parent", "", "ID of the todo to add this one to as a subtask")
+	createTodoCmd.Flags().String("repeat", "", "repeat the todo, e.g. daily, \"every monday\", \"every 2 weeks\", \"every 15th\" or an RRULE")
 	createTodoCmd.MarkFlagRequired("title")
 	todoCmd.AddCommand(createTodoCmd)
+	getTodoCmd.Flags().Bool("json", false, "print the raw JSON response")
 	todoCmd.AddCommand(getTodoCmd)
 
 	updateTodoCmd.Flags().StringVar(&title, "title", "", "title")
+	updateTodoCmd.Flags().String("notes", "", "longer description in Markdown, none clears it")
 	updateTodoCmd.Flags().BoolVar(&completed, "completed", false, "completed")
+	updateTodoCmd.Flags().String("due", "", "due date, none clears it")
+	updateTodoCmd.Flags().String("start", "", "start date, none clears it")
+	updateTodoCmd.Flags().String("priority", "", "none, low, medium, high or urgent")
+	updateTodoCmd.Flags().String("project", "", "project name or ID to move the todo to, inbox removes it from its project")
+	updateTodoCmd.Flags().String("parent", "", "ID of the todo to make this one a subtask of, none makes it a top level todo")
+	updateTodoCmd.Flags().String("repeat", "", "repeat the todo, same formats as for create, none stops it repeating")
+	updateTodoCmd.Flags().Bool("force", false, "update the todo even if it changed since it was fetched")
+	updateTodoCmd.Flags().Int64("version", 0, "only update the todo while it is at this version, by default the one getOne last showed")
 	todoCmd.AddCommand(updateTodoCmd)
+	deleteTodoCmd.Flags().String("where", "", "delete the todos matching this filter expression, see todo get --where")
+	deleteTodoCmd.Flags().BoolP("yes", "y", false, "do not ask for confirmation with --where")
 	todoCmd.AddCommand(deleteTodoCmd)
+
+	moveTodoCmd.Flags().String("before", "", "ID of the todo to move in front of")
+	moveTodoCmd.Flags().String("after", "", "ID of the todo to move behind")
+	todoCmd.AddCommand(moveTodoCmd)
+
+	getAllTodoCmd.Flags().String("due", "", "only show todos that are overdue or due today")
+	getAllTodoCmd.Flags().StringSlice("tag", nil, "only show todos carrying this tag, can be repeated")
+	getAllTodoCmd.Flags().String("project", "", "only show todos of this project name or ID, or of the inbox")
+	getAllTodoCmd.Flags().Bool("completed", false, "only show completed todos, --completed=false shows open ones")
+	getAllTodoCmd.Flags().String("created-after", "", "only show todos created on or after this date")
+	getAllTodoCmd.Flags().String("created-before", "", "only show todos created before this date")
+	getAllTodoCmd.Flags().String("updated-after", "", "only show todos updated on or after this date")
+	getAllTodoCmd.Flags().String("updated-before", "", "only show todos updated before this date")
+	getAllTodoCmd.Flags().String("where", "", whereHelp)
+	getAllTodoCmd.Flags().String("sort", "", "comma separated fields to sort by, - for descending, e.g. -priority,due_at")
+	getAllTodoCmd.Flags().Int("limit", 0, "number of todos per page, all pages are fetched unless --page is given")
+	getAllTodoCmd.Flags().Int("page", 0, "only fetch this page, counted from 1")
+	getAllTodoCmd.Flags().Bool("json", false, "print the raw JSON response instead of a tree")
 	todoCmd.AddCommand(getAllTodoCmd)
 }
 
-// GetTokenForUser retrieves the token for a given user_id from the command flags
+// GetTokenForUser returns the token saved by `user login` and points the
+// requests at the server that issued it
 func GetTokenForUser(cmd *cobra.Command) (string, error) {
-	// Get the user_id from the command flag
-	userID, err := cmd.Flags().GetString("user_id")
-	if err != nil {
-		log.Fatalf("Error reading user_id flag: %v", err)
-	}
-
-	// Fetch the token from MongoDB using the user_id
-	token, err := db.GetTokenByUserID(userID)
+	creds, err := GetTokenDetails(cmd)
 	if err != nil {
-		log.Fatalf("Error retrieving token for user_id %s: %v", userID, err)
+		return "", err
 	}
-
-	return token, nil
+	return creds.Token, nil
 }
 
-// GetTokenForUser retrieves the token for a given user_id from the command flags
-func GetTokenDetails(cmd *cobra.Command) (db.TokenData, error) {
-	// Get the user_id from the command flag
-	userID, err := cmd.Flags().GetString("user_id")
+// GetTokenDetails returns the credentials saved by `user login` and points
+// the requests at the server that issued them
+func GetTokenDetails(cmd *cobra.Command) (credentials, error) {
+	creds, err := loadCredentials()
 	if err != nil {
-		log.Fatalf("Error reading user_id flag: %v", err)
+		return creds, err
 	}
-
-	// Fetch the token from MongoDB using the user_id
-	token, err := db.GetTokenDetailsByUserID(userID)
-	if err != nil {
-		log.Fatalf("Error retrieving token for user_id %s: %v", userID, err)
+	if creds.Server != "" {
+		TODO_SERVER_PATH = creds.Server
 	}
+	return creds, nil
+}
 
-	return token, nil
+// setDateFields copies the --start and --due flags into a todo request body.
+// With clearable set, "none" sends a null to remove the date.
+func setDateFields(cmd *cobra.Command, requestBody map[string]interface{}, clearable bool) error {
+	for flag, field := range map[string]string{"start": "start_at", "due": "due_at"} {
+		if !cmd.Flags().Changed(flag) {
+			continue
+		}
+		value, _ := cmd.Flags().GetString(flag)
+		if clearable && value == "none" {
+			requestBody[field] = nil
+			continue
+		}
+		t, err := parseDateFlag(value, flag == "due")
+		if err != nil {
+			return fmt.Errorf("--%s: %v", flag, err)
+		}
+		requestBody[field] = t.Format(time.RFC3339)
+	}
+	return nil
 }
 
 var registerCmd = &cobra.Command{
@@ -114,7 +140,7 @@ var registerCmd = &cobra.Command{
 	Short: "Register a new user",
 	Args:  cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
-		restyClient := resty.New()
+		restyClient := apiClient()
 		username := args[0]
 		password := args[1]
 
@@ -140,7 +166,7 @@ var loginCmd = &cobra.Command{
 	Short: "Login and get a JWT token",
 	Args:  cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
-		restyClient := resty.New()
+		restyClient := apiClient()
 		username := args[0]
 		password := args[1]
 
@@ -153,11 +179,26 @@ var loginCmd = &cobra.Command{
 			return
 		}
 
-		if resp.StatusCode() == 200 {
-			fmt.Printf("Logged in! ")
-		} else {
+		if resp.StatusCode() != 200 {
 			fmt.Println("Login failed:", resp.String())
+			return
+		}
+
+		var result struct {
+			Token        string `json:"token"`
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := json.Unmarshal(resp.Body(), &result); err != nil {
+			log.Fatalf("Unexpected login response: %s", resp.String())
+		}
+		creds, err := newCredentials(TODO_SERVER_PATH, username, result.Token, result.RefreshToken)
+		if err != nil {
+			log.Fatal(err)
 		}
+		if err := saveCredentials(creds); err != nil {
+			log.Fatalf("Error saving credentials: %v", err)
+		}
+		fmt.Printf("Logged in as %s.\n", username)
 	},
 }
 
@@ -170,11 +211,8 @@ var userDetailsCmd = &cobra.Command{
 			log.Fatalf("Failed to get user token: %v", err)
 		}
 
-		if err != nil {
-			log.Fatalf("Error reading user_id flag: %v", err)
-		}
 		// Create a new Resty Client
-		restyClient := resty.New()
+		restyClient := apiClient()
 
 		apiURL := fmt.Sprintf("/user/details/%s", tokenDetails.UserID)
 
@@ -196,24 +234,36 @@ var logoutCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		// Use the reusable function to get the token
 		token, err := GetTokenForUser(cmd)
+		if errors.Is(err, errNotLoggedIn) {
+			log.Fatal(err)
+		}
+		// An expired token only needs to be forgotten locally
 		if err != nil {
-			log.Fatalf("Failed to get token: %v", err)
+			if rmErr := removeCredentials(); rmErr != nil {
+				log.Fatalf("Error removing credentials: %v", rmErr)
+			}
+			fmt.Println("Logged out successfully.")
+			return
 		}
 
 		// Create a new Resty Client
-		restyClient := resty.New()
+		restyClient := apiClient()
 
 		resp, err := restyClient.R().
 			SetHeader("Authorization", "Bearer "+token).
 			Post(TODO_SERVER_PATH + "/user/logout")
 
+		// The local credentials go either way, the token may already be revoked
+		if rmErr := removeCredentials(); rmErr != nil {
+			log.Fatalf("Error removing credentials: %v", rmErr)
+		}
 		if err != nil {
 			fmt.Println("Error:", err)
 			return
 		}
 
-		if err != nil || resp.StatusCode() != 200 {
-			fmt.Println("Error logging out:", err)
+		if resp.StatusCode() != 200 {
+			fmt.Println("Error logging out:", resp.String())
 			return
 		}
 		fmt.Println("Logged out successfully.")
@@ -241,9 +291,40 @@ var createTodoCmd = &cobra.Command{
 			"title":     title,
 			"completed": completed,
 		}
+		if err := setDateFields(cmd, requestBody, false); err != nil {
+			log.Fatal(err)
+		}
+		if err := setRepeatField(cmd, requestBody, false); err != nil {
+			log.Fatal(err)
+		}
+		if notes, _ := cmd.Flags().GetString("notes"); notes != "" {
+			requestBody["notes"] = notes
+		}
+		if cmd.Flags().Changed("priority") {
+			priority, _ := cmd.Flags().GetString("priority")
+			requestBody["priority"] = priority
+		}
+		if tags, _ := cmd.Flags().GetStringSlice("tag"); len(tags) > 0 {
+			requestBody["tags"] = tags
+		}
+		// New todos go to the project of the context unless told otherwise
+		projectName, _ := cmd.Flags().GetString("project")
+		if !cmd.Flags().Changed("project") {
+			projectName = activeContext.Project
+		}
+		if projectName != "" && projectName != "inbox" {
+			projectID, err := resolveProject(token, projectName)
+			if err != nil {
+				log.Fatal(err)
+			}
+			requestBody["project_id"] = projectID
+		}
+		if parent, _ := cmd.Flags().GetString("parent"); parent != "" {
+			requestBody["parent_id"] = parent
+		}
 
 		// Create a new Resty Client
-		restyClient := resty.New()
+		restyClient := apiClient()
 		resp, err := restyClient.R().
 			SetHeader("Authorization", "Bearer "+token). // Set the token for authorization
 			SetHeader("Content-Type", "application/json").
@@ -269,14 +350,24 @@ var getTodoCmd = &cobra.Command{
 		}
 
 		// Create a new Resty Client
-		restyClient := resty.New()
+		restyClient := apiClient()
 		resp, err := restyClient.R().
 			SetHeader("Authorization", "Bearer "+token).
 			Get(fmt.Sprintf(TODO_SERVER_PATH+"/todos/%s", args[0]))
 
 		if err != nil {
 			fmt.Println("Error:", err)
-		} else {
+			return
+		}
+		if raw, _ := cmd.Flags().GetBool("json"); raw || resp.IsError() {
+			fmt.Println("TODO details:", resp.String())
+			return
+		}
+		// A later update is checked against the todo as shown here
+		if err := rememberTodo(resp.Body()); err != nil {
+			log.Printf("Failed to remember the todo: %v", err)
+		}
+		if err := printTodoDetails(resp.Body()); err != nil {
 			fmt.Println("TODO details:", resp.String())
 		}
 	},
@@ -305,34 +396,91 @@ var updateTodoCmd = &cobra.Command{
 			completed, _ := cmd.Flags().GetBool("completed")
 			requestBody["completed"] = completed
 		}
+		if err := setDateFields(cmd, requestBody, true); err != nil {
+			log.Fatal(err)
+		}
+		if err := setRepeatField(cmd, requestBody, true); err != nil {
+			log.Fatal(err)
+		}
+		if notes, _ := cmd.Flags().GetString("notes"); notes == "none" {
+			requestBody["notes"] = ""
+		} else if notes != "" {
+			requestBody["notes"] = notes
+		}
+		if cmd.Flags().Changed("priority") {
+			priority, _ := cmd.Flags().GetString("priority")
+			requestBody["priority"] = priority
+		}
+		if projectName, _ := cmd.Flags().GetString("project"); projectName != "" {
+			projectID, err := resolveProject(token, projectName)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if projectID == "inbox" {
+				requestBody["project_id"] = nil
+			} else {
+				requestBody["project_id"] = projectID
+			}
+		}
+		if parent, _ := cmd.Flags().GetString("parent"); parent == "none" {
+			requestBody["parent_id"] = nil
+		} else if parent != "" {
+			requestBody["parent_id"] = parent
+		}
 
-		// Create a new Resty Client
-		restyClient := resty.New()
-		resp, err := restyClient.R().
-			SetHeader("Authorization", "Bearer "+token).
-			SetHeader("Content-Type", "application/json").
-			SetBody(requestBody).
-			Put(fmt.Sprintf(TODO_SERVER_PATH+"/todos/%s", args[0]))
+		// The update is based on the todo as getOne last showed it, or on
+		// --version, and fails when somebody else changed it since, unless
+		// forced
+		base, version, seen := seenVersion(args[0])
+		etag := ""
+		if cmd.Flags().Changed("version") {
+			asked, _ := cmd.Flags().GetInt64("version")
+			if !seen || asked != version {
+				base = nil
+			}
+			version, seen = asked, true
+		}
+		if seen {
+			etag = fmt.Sprintf(`"%d"`, version)
+		}
+		if force, _ := cmd.Flags().GetBool("force"); force {
+			etag = ""
+		}
+		resp, conflict, err := putTodo(token, args[0], etag, base, requestBody)
 		if err != nil {
 			fmt.Println("Error:", err)
+		} else if conflict {
+			fmt.Println("Run todo getOne to see the current todo and update it again, or update with --force to overwrite their changes.")
 		} else {
+			if !resp.IsError() {
+				if err := rememberTodo(resp.Body()); err != nil {
+					log.Printf("Failed to remember the todo: %v", err)
+				}
+			}
 			fmt.Println("TODO updated:", resp.String())
 		}
 	},
 }
 
 var deleteTodoCmd = &cobra.Command{
-	Use:   "delete [id]",
-	Short: "Delete a todo by ID",
-	Args:  cobra.ExactArgs(1),
+	Use:   "delete [id]...",
+	Short: "Delete todos by ID or by a --where filter",
 	Run: func(cmd *cobra.Command, args []string) {
 		token, err := GetTokenForUser(cmd)
 		if err != nil {
 			log.Fatalf("Failed to get token: %v", err)
 		}
+		where, _ := cmd.Flags().GetString("where")
+		if len(args) == 0 && where == "" {
+			log.Fatal("Give the IDs of the todos to delete or --where")
+		}
+		if len(args) > 1 || where != "" {
+			deleteTodos(cmd, token, args)
+			return
+		}
 
 		// Create a new Resty Client
-		restyClient := resty.New()
+		restyClient := apiClient()
 		resp, err := restyClient.R().
 			SetHeader("Authorization", "Bearer "+token).
 			Delete(fmt.Sprintf(TODO_SERVER_PATH+"/todos/%s", args[0]))
@@ -344,6 +492,37 @@ var deleteTodoCmd = &cobra.Command{
 	},
 }
 
+var moveTodoCmd = &cobra.Command{
+	Use:   "move [id]",
+	Short: "Move a todo before or after another todo",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+
+		before, _ := cmd.Flags().GetString("before")
+		after, _ := cmd.Flags().GetString("after")
+		if (before == "") == (after == "") {
+			log.Fatalf("Exactly one of --before or --after is required")
+		}
+
+		// Create a new Resty Client
+		restyClient := apiClient()
+		resp, err := restyClient.R().
+			SetHeader("Authorization", "Bearer "+token).
+			SetHeader("Content-Type", "application/json").
+			SetBody(map[string]string{"before": before, "after": after}).
+			Post(fmt.Sprintf(TODO_SERVER_PATH+"/todos/%s/move", args[0]))
+		if err != nil {
+			fmt.Println("Error:", err)
+		} else {
+			fmt.Println("TODO moved:", resp.String())
+		}
+	},
+}
+
 // getTodoCmd represents the get command
 var getAllTodoCmd = &cobra.Command{
 	Use:   "get",
@@ -354,38 +533,80 @@ var getAllTodoCmd = &cobra.Command{
 			log.Fatalf("Failed to get token: %v", err)
 		}
 
-		// Create a new Resty Client
-		restyClient := resty.New()
-		// Send GET request to the API server
-		resp, err := restyClient.R().
-			SetHeader("Authorization", "Bearer "+token). // Set the token for authorization
-			Get(TODO_SERVER_PATH + "/todos")
+		query := url.Values{}
+		if due, _ := cmd.Flags().GetString("due"); due != "" {
+			query.Set("due", due)
+			query.Set("tz", localOffset())
+		}
+		if tags, _ := cmd.Flags().GetStringSlice("tag"); len(tags) > 0 {
+			query["tag"] = tags
+		}
+		if projectName, _ := cmd.Flags().GetString("project"); projectName != "" {
+			projectID, err := resolveProject(token, projectName)
+			if err != nil {
+				log.Fatal(err)
+			}
+			query.Set("project", projectID)
+		}
+		if cmd.Flags().Changed("completed") {
+			completed, _ := cmd.Flags().GetBool("completed")
+			query.Set("completed", fmt.Sprint(completed))
+		}
+		if sort, _ := cmd.Flags().GetString("sort"); sort != "" {
+			query.Set("sort", sort)
+		}
+		for _, flag := range []string{"created-after", "created-before", "updated-after", "updated-before"} {
+			value, _ := cmd.Flags().GetString(flag)
+			if value == "" {
+				continue
+			}
+			t, err := parseDateFlag(value, false)
+			if err != nil {
+				log.Fatalf("--%s: %v", flag, err)
+			}
+			query.Set(strings.ReplaceAll(flag, "-", "_"), t.Format(time.RFC3339))
+		}
+		if where, _ := cmd.Flags().GetString("where"); where != "" {
+			if err := checkWhere(where); err != nil {
+				log.Fatal(err)
+			}
+			query.Set("filter", where)
+			query.Set("tz", localOffset())
+		}
 
+		limit, _ := cmd.Flags().GetInt("limit")
+		page, _ := cmd.Flags().GetInt("page")
+		todos, err := fetchTodoPages(token, "/todos", query, limit, page)
 		if err != nil {
 			fmt.Println("Error fetching todos:", err)
 			return
 		}
 
 		// Print the response
-		fmt.Println(string(resp.Body()))
+		if raw, _ := cmd.Flags().GetBool("json"); raw {
+			body, _ := json.Marshal(todos)
+			fmt.Println(string(body))
+			return
+		}
+		if err := printTodoTree(todos.Todos); err != nil {
+			fmt.Println("Error reading todos:", err)
+		}
+		if page > 0 && todos.NextCursor != "" {
+			fmt.Printf("More todos on --page %d\n", page+1)
+		}
 	},
 }
 
 // Define the 'getToken' command
 var getTokenCmd = &cobra.Command{
 	Use:   "getToken",
-	Short: "Get a token for a specific user",
+	Short: "Print the token saved by user login",
 	Run: func(cmd *cobra.Command, args []string) {
-		userID, err := cmd.Flags().GetString("user_id")
-		if err != nil {
-			log.Fatalf("Error reading user_id flag: %v", err)
-		}
-
-		token, err := db.GetTokenByUserID(userID)
+		creds, err := GetTokenDetails(cmd)
 		if err != nil {
 			log.Fatalf("Error retrieving token: %v", err)
 		}
 
-		fmt.Printf("Token for user %s: %s\n", userID, token)
+		fmt.Printf("Token for user %s: %s\n", creds.Username, creds.Token)
 	},
 }
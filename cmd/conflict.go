@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// conflictFields are the fields of a todo compared when an update conflicts,
+// in the order they are shown
+var conflictFields = []string{"title", "notes", "completed", "priority", "tags", "project_id", "parent_id", "start_at", "due_at", "repeat"}
+
+// fetchTodo fetches a todo as it is now, along with the ETag that makes an
+// update fail once somebody else changes it
+func fetchTodo(token, id string) (map[string]interface{}, string, error) {
+	resp, err := apiClient().R().
+		SetHeader("Authorization", "Bearer "+token).
+		Get(fmt.Sprintf(TODO_SERVER_PATH+"/todos/%s", id))
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.IsError() {
+		return nil, "", fmt.Errorf("error fetching todo: %s", resp.String())
+	}
+	var todo map[string]interface{}
+	if err := json.Unmarshal(resp.Body(), &todo); err != nil {
+		return nil, "", err
+	}
+	return todo, resp.Header().Get("ETag"), nil
+}
+
+// putTodo sends changes to PUT /todos/:id. With an etag the server only
+// applies them while the todo is still as base, otherwise the todo is
+// fetched again, the changes on both sides are printed and conflict is set.
+func putTodo(token, id, etag string, base, changes map[string]interface{}) (resp *resty.Response, conflict bool, err error) {
+	request := apiClient().R().
+		SetHeader("Authorization", "Bearer "+token).
+		SetHeader("Content-Type", "application/json").
+		SetBody(changes)
+	if etag != "" {
+		request.SetHeader("If-Match", etag)
+	}
+	resp, err = request.Put(fmt.Sprintf(TODO_SERVER_PATH+"/todos/%s", id))
+	if err != nil || resp.StatusCode() != http.StatusPreconditionFailed {
+		return resp, false, err
+	}
+
+	theirs, _, err := fetchTodo(token, id)
+	if err != nil {
+		return resp, true, err
+	}
+	fmt.Println("The todo was changed since you fetched it, nothing was saved:")
+	printConflict(base, theirs, changes)
+	return resp, true, nil
+}
+
+// printConflict shows the fields that either side changed, as they were,
+// as they are now and as you would have them. Fields both sides changed
+// differently are marked with !. Without a base, which is the case when the
+// todo as it was is not known, only your fields are shown and marked when
+// they differ from theirs.
+func printConflict(base, theirs, yours map[string]interface{}) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  FIELD\tBASE\tTHEIRS\tYOURS")
+	for _, field := range conflictFields {
+		mine, changed := yours[field]
+		if !changed {
+			mine = base[field]
+		}
+		theirsChanged := !sameValue(base[field], theirs[field])
+		wasValue := historyValue(base[field])
+		if base == nil {
+			theirsChanged, wasValue = changed, "?"
+		}
+		if !changed && !theirsChanged {
+			continue
+		}
+		mark := " "
+		if changed && theirsChanged && !sameValue(mine, theirs[field]) {
+			mark = "!"
+		}
+		fmt.Fprintf(w, "%s %s\t%s\t%s\t%s\n", mark, field, wasValue, historyValue(theirs[field]), historyValue(mine))
+	}
+	w.Flush()
+}
+
+// sameValue reports whether two field values of a todo look alike, an empty
+// string being the same as no value
+func sameValue(a, b interface{}) bool {
+	if a == "" {
+		a = nil
+	}
+	if b == "" {
+		b = nil
+	}
+	return historyValue(a) == historyValue(b)
+}
@@ -0,0 +1,260 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultContext names the context used when none is selected, talking to
+// TODO_SERVER_PATH from the environment
+const defaultContext = "default"
+
+// todoContext binds a server, the credentials saved for it and a default
+// project under a name, kept in the config file like
+//
+//	current-context: staging
+//	contexts:
+//	  staging:
+//	    server: https://staging.example.com/todo-app/api/v1
+//	    project: Work
+type todoContext struct {
+	Name    string `mapstructure:"-" yaml:"-"`
+	Server  string `mapstructure:"server" yaml:"server"`
+	Project string `mapstructure:"project" yaml:"project,omitempty"` // Project new todos go to without --project
+}
+
+// activeContext is the context selected by --context or `context use`
+var activeContext = todoContext{Name: defaultContext}
+
+// contextNames are kept simple since viper lowercases keys and splits them at dots
+var contextNames = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+func init() {
+	contextAddCmd.Flags().String("server", "", "TODO_SERVER_PATH of the server, e.g. https://todo.example.com/todo-app/api/v1")
+	contextAddCmd.Flags().String("project", "", "project new todos go to unless --project is given")
+	contextAddCmd.Flags().Bool("use", false, "switch to the new context")
+	contextAddCmd.MarkFlagRequired("server")
+	contextCmd.AddCommand(contextAddCmd)
+	contextCmd.AddCommand(contextUseCmd)
+	contextCmd.AddCommand(contextLsCmd)
+	contextCmd.AddCommand(contextRmCmd)
+	RootCmd.AddCommand(contextCmd)
+}
+
+// loadContexts returns the contexts of the config file and the current one
+func loadContexts() (map[string]todoContext, string, error) {
+	contexts := map[string]todoContext{}
+	if err := viper.UnmarshalKey("contexts", &contexts); err != nil {
+		return nil, "", fmt.Errorf("invalid contexts in %s: %v", viper.ConfigFileUsed(), err)
+	}
+	for name, context := range contexts {
+		context.Name = name
+		contexts[name] = context
+	}
+	return contexts, viper.GetString("current-context"), nil
+}
+
+// useContext selects the context named by --context, or else the current
+// one, and points the requests at its server
+func useContext() error {
+	contexts, current, err := loadContexts()
+	if err != nil {
+		return err
+	}
+	name := contextName
+	if name == "" {
+		name = current
+	}
+	if name == "" || name == defaultContext {
+		return nil
+	}
+	context, ok := contexts[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("no context %q, see `todo-cli context ls`", name)
+	}
+	activeContext = context
+	TODO_SERVER_PATH = context.Server
+	return nil
+}
+
+// configPath returns the config file contexts are written to
+func configPath() (string, error) {
+	if path := viper.ConfigFileUsed(); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".go-todo-cli.yaml"), nil
+}
+
+// saveContexts writes the contexts and the current one to the config file,
+// keeping whatever else it holds
+func saveContexts(contexts map[string]todoContext, current string) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	settings := map[string]interface{}{}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+
+	settings["contexts"] = contexts
+	if current == "" {
+		delete(settings, "current-context")
+	} else {
+		settings["current-context"] = current
+	}
+	data, err = yaml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Group command: `contextCmd`
+var contextCmd = &cobra.Command{
+	Use:   "context",
+	Short: "Switch between servers and accounts",
+}
+
+var contextAddCmd = &cobra.Command{
+	Use:   "add [name]",
+	Short: "Add a context for a server, log in to it with --context name user login",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := strings.ToLower(args[0])
+		if !contextNames.MatchString(name) || name == defaultContext {
+			log.Fatalf("Invalid context name %q, use letters, digits, - and _ (%q is taken)", args[0], defaultContext)
+		}
+		contexts, current, err := loadContexts()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, ok := contexts[name]; ok {
+			log.Fatalf("Context %q already exists, remove it first to change it", name)
+		}
+
+		server, _ := cmd.Flags().GetString("server")
+		project, _ := cmd.Flags().GetString("project")
+		contexts[name] = todoContext{Server: strings.TrimRight(server, "/"), Project: project}
+		if use, _ := cmd.Flags().GetBool("use"); use {
+			current = name
+		}
+		if err := saveContexts(contexts, current); err != nil {
+			log.Fatalf("Error saving context: %v", err)
+		}
+		fmt.Printf("Context %s added. Log in with: todo-cli --context %s user login [username] [password]\n", name, name)
+	},
+}
+
+var contextUseCmd = &cobra.Command{
+	Use:   "use [name]",
+	Short: "Switch to a context, default goes back to TODO_SERVER_PATH",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := strings.ToLower(args[0])
+		contexts, _, err := loadContexts()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, ok := contexts[name]; !ok && name != defaultContext {
+			log.Fatalf("No context %q, see todo-cli context ls", args[0])
+		}
+		current := name
+		if name == defaultContext {
+			current = ""
+		}
+		if err := saveContexts(contexts, current); err != nil {
+			log.Fatalf("Error saving context: %v", err)
+		}
+		fmt.Println("Switched to context", name)
+	},
+}
+
+var contextLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the contexts, the active one marked with *",
+	Run: func(cmd *cobra.Command, args []string) {
+		contexts, _, err := loadContexts()
+		if err != nil {
+			log.Fatal(err)
+		}
+		names := []string{defaultContext}
+		for name := range contexts {
+			names = append(names, name)
+		}
+		sort.Strings(names[1:])
+
+		all, err := loadAllCredentials()
+		if err != nil {
+			log.Fatal(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  NAME\tSERVER\tPROJECT\tUSER")
+		for _, name := range names {
+			context, ok := contexts[name]
+			if !ok {
+				context = todoContext{Server: os.Getenv("TODO_SERVER_PATH")}
+			}
+			mark := " "
+			if name == activeContext.Name {
+				mark = "*"
+			}
+			user := "-"
+			if creds, ok := all[name]; ok {
+				user = creds.Username
+			}
+			project := context.Project
+			if project == "" {
+				project = "-"
+			}
+			fmt.Fprintf(w, "%s %s\t%s\t%s\t%s\n", mark, name, context.Server, project, user)
+		}
+		w.Flush()
+	},
+}
+
+var contextRmCmd = &cobra.Command{
+	Use:   "rm [name]",
+	Short: "Remove a context and the credentials saved for it",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := strings.ToLower(args[0])
+		contexts, current, err := loadContexts()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, ok := contexts[name]; !ok {
+			log.Fatalf("No context %q, see todo-cli context ls", args[0])
+		}
+		delete(contexts, name)
+		if current == name {
+			current = ""
+		}
+		if err := saveContexts(contexts, current); err != nil {
+			log.Fatalf("Error saving context: %v", err)
+		}
+		if err := removeContextCredentials(name); err != nil {
+			log.Fatalf("Error removing credentials: %v", err)
+		}
+		fmt.Println("Context", name, "removed.")
+	},
+}
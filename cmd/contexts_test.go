@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// configure runs initConfig on a config file with the given content in a
+// fresh home directory, the way every command starts
+func configure(t *testing.T, config string) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	path := filepath.Join(home, ".go-todo-cli.yaml")
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server, name := TODO_SERVER_PATH, contextName
+	t.Cleanup(func() {
+		TODO_SERVER_PATH, contextName, cfgFile = server, name, ""
+		activeContext = todoContext{Name: defaultContext}
+		viper.Reset()
+	})
+	viper.Reset()
+	cfgFile = path
+	initConfig()
+}
+
+func TestUseContext(t *testing.T) {
+	const config = `current-context: staging
+contexts:
+  staging:
+    server: https://staging.example.com/todo-app/api/v1
+    project: Work
+  prod:
+    server: https://todo.example.com/todo-app/api/v1
+`
+	TODO_SERVER_PATH = "http://localhost:8080/todo-app/api/v1"
+	configure(t, config)
+	if activeContext.Name != "staging" || activeContext.Project != "Work" || TODO_SERVER_PATH != "https://staging.example.com/todo-app/api/v1" {
+		t.Errorf("the current context selected %+v and %s", activeContext, TODO_SERVER_PATH)
+	}
+
+	contextName = "prod"
+	configure(t, config)
+	if activeContext.Name != "prod" || TODO_SERVER_PATH != "https://todo.example.com/todo-app/api/v1" {
+		t.Errorf("--context prod selected %+v and %s", activeContext, TODO_SERVER_PATH)
+	}
+}
+
+func TestNoServer(t *testing.T) {
+	// Commands that do not talk to the server run without one
+	TODO_SERVER_PATH = ""
+	configure(t, "")
+	if activeContext.Name != defaultContext {
+		t.Errorf("without a current context %q is active", activeContext.Name)
+	}
+
+	if _, err := apiClient().R().Get(TODO_SERVER_PATH + "/todos"); !errors.Is(err, errNoServer) {
+		t.Errorf("a request without a server returned %v, want errNoServer", err)
+	}
+	if _, err := refreshCredentials(credentials{RefreshToken: "token"}); !errors.Is(err, errNoServer) {
+		t.Errorf("refreshing without a server returned %v, want errNoServer", err)
+	}
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// credentials is what `user login` keeps so later commands are authenticated,
+// one per context
+type credentials struct {
+	Server   string `json:"server"` // TODO_SERVER_PATH the token was issued by
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	Token    string `json:"token"`
+	Expires  int64  `json:"expires"` // Unix time the access token expires at
+	// RefreshToken renews the access token, see refreshCredentials
+	RefreshToken string `json:"refresh_token"`
+}
+
+// errNotLoggedIn is returned when no credentials were saved yet
+var errNotLoggedIn = errors.New("not logged in, run `todo-cli user login` first")
+
+// credentialsPath returns where the credentials are kept,
+// ~/.config/todo-cli/credentials unless XDG_CONFIG_HOME says otherwise
+func credentialsPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "todo-cli", "credentials"), nil
+}
+
+// newCredentials reads the user and expiry out of an access token issued by
+// the server. The signature is left to the server to check.
+func newCredentials(server, username, token, refreshToken string) (credentials, error) {
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+		return credentials{}, fmt.Errorf("invalid token: %v", err)
+	}
+	userID, _ := claims["user_id"].(string)
+	exp, _ := claims["exp"].(float64)
+	return credentials{Server: server, UserID: userID, Username: username, Token: token, Expires: int64(exp), RefreshToken: refreshToken}, nil
+}
+
+// loadAllCredentials reads the credentials saved for every context
+func loadAllCredentials() (map[string]credentials, error) {
+	var file struct {
+		Contexts map[string]credentials `json:"contexts"`
+		credentials
+	}
+	path, err := credentialsPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]credentials{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid credentials in %s: %v", path, err)
+	}
+	if file.Contexts == nil {
+		file.Contexts = map[string]credentials{}
+	}
+	// Saved before there were contexts
+	if file.Token != "" {
+		file.Contexts[defaultContext] = file.credentials
+	}
+	return file.Contexts, nil
+}
+
+// saveAllCredentials writes the credentials of every context, readable by
+// the current user only
+func saveAllCredentials(all map[string]credentials) error {
+	path, err := credentialsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(map[string]interface{}{"contexts": all}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of a file that already existed
+	return os.Chmod(path, 0600)
+}
+
+// errLoginExpired is returned once the session can no longer be refreshed
+var errLoginExpired = errors.New("your login expired, run `todo-cli user login` again")
+
+// loadCredentials reads the credentials of the active context, refreshing
+// the access token once it expired. A personal access token in TODO_TOKEN
+// takes their place, for scripts that cannot log in.
+func loadCredentials() (credentials, error) {
+	if token := os.Getenv("TODO_TOKEN"); token != "" {
+		return credentials{Token: token}, nil
+	}
+	all, err := loadAllCredentials()
+	if err != nil {
+		return credentials{}, err
+	}
+	creds, ok := all[activeContext.Name]
+	if !ok || creds.Token == "" {
+		return creds, errNotLoggedIn
+	}
+	if creds.Expires != 0 && time.Now().Unix() > creds.Expires {
+		return refreshCredentials(creds)
+	}
+	return creds, nil
+}
+
+// saveCredentials keeps the credentials for the active context
+func saveCredentials(creds credentials) error {
+	all, err := loadAllCredentials()
+	if err != nil {
+		return err
+	}
+	all[activeContext.Name] = creds
+	return saveAllCredentials(all)
+}
+
+// removeCredentials forgets the credentials of the active context
+func removeCredentials() error {
+	return removeContextCredentials(activeContext.Name)
+}
+
+// removeContextCredentials forgets the credentials of a context
+func removeContextCredentials(name string) error {
+	all, err := loadAllCredentials()
+	if err != nil {
+		return err
+	}
+	if _, ok := all[name]; !ok {
+		return nil
+	}
+	delete(all, name)
+	return saveAllCredentials(all)
+}
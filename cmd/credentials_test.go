@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// signedToken returns an access token for the user expiring at exp, signed
+// with a key the CLI never checks
+func signedToken(t *testing.T, userID string, exp time.Time) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": userID, "exp": exp.Unix()}).SignedString([]byte("server secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestCredentials(t *testing.T) {
+	configure(t, "")
+	t.Setenv("TODO_TOKEN", "")
+	if _, err := loadCredentials(); !errors.Is(err, errNotLoggedIn) {
+		t.Fatalf("loadCredentials before logging in returned %v, want errNotLoggedIn", err)
+	}
+
+	exp := time.Now().Add(time.Hour)
+	creds, err := newCredentials("http://localhost:8080/todo-app/api/v1", "alice", signedToken(t, "6713aace3b5297a43130c713", exp), "refresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.UserID != "6713aace3b5297a43130c713" || creds.Expires != exp.Unix() {
+		t.Errorf("newCredentials read user %q expiring at %d from the token", creds.UserID, creds.Expires)
+	}
+	if _, err := newCredentials(creds.Server, "alice", "not-a-jwt", ""); err == nil {
+		t.Errorf("newCredentials accepted a malformed token")
+	}
+
+	if err := saveCredentials(creds); err != nil {
+		t.Fatal(err)
+	}
+	path, _ := credentialsPath()
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("the credentials file is %v, %v, want readable by the user only", info.Mode().Perm(), err)
+	}
+	if loaded, err := loadCredentials(); err != nil || loaded != creds {
+		t.Errorf("loadCredentials returned %+v, %v, want what was saved", loaded, err)
+	}
+
+	// A personal access token takes the place of the login
+	t.Setenv("TODO_TOKEN", "todo_pat")
+	if loaded, err := loadCredentials(); err != nil || loaded.Token != "todo_pat" {
+		t.Errorf("with TODO_TOKEN loadCredentials returned %+v, %v", loaded, err)
+	}
+	t.Setenv("TODO_TOKEN", "")
+
+	if err := removeCredentials(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadCredentials(); !errors.Is(err, errNotLoggedIn) {
+		t.Errorf("loadCredentials after removing them returned %v, want errNotLoggedIn", err)
+	}
+}
+
+func TestLoadCredentialsBeforeContexts(t *testing.T) {
+	configure(t, "")
+	path, _ := credentialsPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	saved := `{"server": "http://localhost:8080/todo-app/api/v1", "username": "alice", "token": "token"}`
+	if err := os.WriteFile(path, []byte(saved), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := loadAllCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds := all[defaultContext]; creds.Username != "alice" || creds.Token != "token" {
+		t.Errorf("credentials saved before contexts were read as %+v for the default context", all)
+	}
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// dateLayouts are the formats accepted by the --due and --start flags,
+// anything without an explicit offset is read in the local timezone
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseDateFlag turns a --due/--start value into a timestamp. Besides the
+// dateLayouts it understands "today" and "tomorrow". A day without a time
+// means the end of that day for due dates and its start otherwise.
+func parseDateFlag(value string, endOfDay bool) (time.Time, error) {
+	now := time.Now()
+	var day time.Time
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "today":
+		day = now
+	case "tomorrow":
+		day = now.AddDate(0, 0, 1)
+	default:
+		for _, layout := range dateLayouts {
+			t, err := time.ParseInLocation(layout, value, time.Local)
+			if err != nil {
+				continue
+			}
+			if layout != "2006-01-02" {
+				return t, nil
+			}
+			day = t
+			break
+		}
+		if day.IsZero() {
+			return time.Time{}, fmt.Errorf("invalid date %q, use YYYY-MM-DD, YYYY-MM-DD HH:MM, RFC 3339, today or tomorrow", value)
+		}
+	}
+
+	y, m, d := day.Date()
+	if endOfDay {
+		return time.Date(y, m, d, 23, 59, 59, 0, time.Local), nil
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local), nil
+}
+
+// localOffset returns the local UTC offset as +hh:mm for the tz query parameter
+func localOffset() string {
+	return time.Now().Format("-07:00")
+}
+
+// localZone returns the IANA name of the local timezone, such as
+// Europe/Paris, taken from $TZ or /etc/localtime, so repeating todos keep
+// their time of day across daylight saving changes. It falls back to the
+// current offset when the name cannot be found.
+func localZone() string {
+	if name := time.Local.String(); name != "Local" {
+		return name
+	}
+	if target, err := os.Readlink("/etc/localtime"); err == nil {
+		if _, name, ok := strings.Cut(target, "zoneinfo/"); ok {
+			if _, err := time.LoadLocation(name); err == nil {
+				return name
+			}
+		}
+	}
+	return localOffset()
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// todoDetails is a todo as returned by GET /todos/:id
+type todoDetails struct {
+	ID        string     `json:"id"`
+	Title     string     `json:"title"`
+	Notes     string     `json:"notes"`
+	Completed bool       `json:"completed"`
+	Priority  string     `json:"priority"`
+	Tags      []string   `json:"tags"`
+	ProjectID string     `json:"project_id"`
+	ParentID  string     `json:"parent_id"`
+	StartAt   *time.Time `json:"start_at"`
+	DueAt     *time.Time `json:"due_at"`
+	Overdue   bool       `json:"overdue"`
+	Repeat    string     `json:"repeat"`
+	Version   int64      `json:"version"`
+	Progress  *struct {
+		Summary string `json:"summary"`
+	} `json:"progress"`
+	Children []treeTodo `json:"children"`
+}
+
+// printTodoDetails prints a single todo for reading in the terminal, with its
+// notes rendered from Markdown
+func printTodoDetails(body []byte) error {
+	var todo todoDetails
+	if err := json.Unmarshal(body, &todo); err != nil {
+		return err
+	}
+	color := useColor()
+
+	mark := "[ ]"
+	if todo.Completed {
+		mark = "[x]"
+	}
+	title := todo.Title
+	if color {
+		title = ansiBold + title + ansiReset
+	}
+	fmt.Printf("%s %s (%s)\n", mark, title, todo.ID)
+
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Printf("  %-9s %s\n", name+":", value)
+		}
+	}
+	if todo.Priority != "none" {
+		field("Priority", todo.Priority)
+	}
+	field("Tags", strings.Join(todo.Tags, ", "))
+	field("Project", todo.ProjectID)
+	field("Parent", todo.ParentID)
+	if todo.StartAt != nil {
+		field("Start", todo.StartAt.Local().Format("2006-01-02 15:04"))
+	}
+	if todo.DueAt != nil {
+		due := todo.DueAt.Local().Format("2006-01-02 15:04")
+		if todo.Overdue {
+			due += " (overdue)"
+		}
+		field("Due", due)
+	}
+	field("Repeat", todo.Repeat)
+	field("Version", strconv.FormatInt(todo.Version, 10))
+	if todo.Progress != nil {
+		field("Subtasks", todo.Progress.Summary)
+	}
+	for _, child := range todo.Children {
+		childMark := "[ ]"
+		if child.Completed {
+			childMark = "[x]"
+		}
+		fmt.Printf("    %s %s (%s)\n", childMark, child.Title, child.ID)
+	}
+
+	if strings.TrimSpace(todo.Notes) != "" {
+		fmt.Println()
+		fmt.Println(renderMarkdown(todo.Notes, color))
+	}
+	return nil
+}
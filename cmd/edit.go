@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"todo-cli/models"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	editTodoCmd.Flags().Bool("force", false, "save the edit even if the todo changed while editing")
+	todoCmd.AddCommand(editTodoCmd)
+}
+
+// editLayout is how dates are written to and read back from the front-matter
+const editLayout = "2006-01-02 15:04"
+
+// todoFrontMatter holds the fields of a todo that can be edited in the
+// front-matter of `todo edit`, the notes follow as the document body
+type todoFrontMatter struct {
+	Title     string   `yaml:"title"`
+	Completed bool     `yaml:"completed"`
+	Priority  string   `yaml:"priority"`
+	Tags      []string `yaml:"tags,flow"`
+	Start     string   `yaml:"start"`
+	Due       string   `yaml:"due"`
+	Repeat    string   `yaml:"repeat"`
+}
+
+var editTodoCmd = &cobra.Command{
+	Use:   "edit [id]",
+	Short: "Edit a todo and its notes in $EDITOR",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+
+		var todo todoDetails
+		var base map[string]interface{}
+		restyClient := apiClient()
+		resp, err := restyClient.R().
+			SetHeader("Authorization", "Bearer "+token).
+			SetResult(&todo).
+			Get(fmt.Sprintf(TODO_SERVER_PATH+"/todos/%s", args[0]))
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		if resp.IsError() {
+			log.Fatalf("Error fetching todo: %s", resp.String())
+		}
+		if err := json.Unmarshal(resp.Body(), &base); err != nil {
+			log.Fatal(err)
+		}
+		// The edit is only saved while nobody else changed the todo
+		etag := resp.Header().Get("ETag")
+		if force, _ := cmd.Flags().GetBool("force"); force {
+			etag = ""
+		}
+
+		original := frontMatterOf(todo)
+		document, err := writeTodoDocument(original, todo.Notes)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		file, err := os.CreateTemp("", "todo-"+todo.ID+"-*.md")
+		if err != nil {
+			log.Fatal(err)
+		}
+		path := file.Name()
+		_, err = file.Write(document)
+		file.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := runEditor(path); err != nil {
+			os.Remove(path)
+			log.Fatalf("Editor failed: %v", err)
+		}
+		edited, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if bytes.Equal(edited, document) {
+			os.Remove(path)
+			fmt.Println("No changes.")
+			return
+		}
+
+		// Keep the file around when the edit cannot be applied, so no work is lost
+		matter, notes, err := readTodoDocument(edited)
+		if err != nil {
+			log.Fatalf("%v (your changes are kept in %s)", err, path)
+		}
+		requestBody, err := todoChanges(original, matter, todo.Notes, notes)
+		if err != nil {
+			log.Fatalf("%v (your changes are kept in %s)", err, path)
+		}
+		if len(requestBody) == 0 {
+			os.Remove(path)
+			fmt.Println("No changes.")
+			return
+		}
+
+		resp, conflict, err := putTodo(token, todo.ID, etag, base, requestBody)
+		if err != nil {
+			log.Fatalf("Error: %v (your changes are kept in %s)", err, path)
+		}
+		if conflict {
+			log.Fatalf("Your changes are kept in %s, edit the todo again or save with --force to overwrite theirs.", path)
+		}
+		if resp.IsError() {
+			log.Fatalf("Error updating todo: %s (your changes are kept in %s)", resp.String(), path)
+		}
+		os.Remove(path)
+		fmt.Println("TODO updated:", resp.String())
+	},
+}
+
+// frontMatterOf returns the editable fields of a todo, dates in local time
+func frontMatterOf(todo todoDetails) todoFrontMatter {
+	matter := todoFrontMatter{
+		Title:     todo.Title,
+		Completed: todo.Completed,
+		Priority:  todo.Priority,
+		Tags:      todo.Tags,
+		Repeat:    todo.Repeat,
+	}
+	if todo.StartAt != nil {
+		matter.Start = todo.StartAt.Local().Format(editLayout)
+	}
+	if todo.DueAt != nil {
+		matter.Due = todo.DueAt.Local().Format(editLayout)
+	}
+	return matter
+}
+
+// writeTodoDocument lays out the front-matter between --- lines followed by the notes
+func writeTodoDocument(matter todoFrontMatter, notes string) ([]byte, error) {
+	header, err := yaml.Marshal(matter)
+	if err != nil {
+		return nil, err
+	}
+	var document bytes.Buffer
+	document.WriteString("---\n")
+	document.Write(header)
+	document.WriteString("---\n")
+	document.WriteString(notes)
+	if notes != "" && !strings.HasSuffix(notes, "\n") {
+		document.WriteString("\n")
+	}
+	return document.Bytes(), nil
+}
+
+// readTodoDocument splits an edited document back into front-matter and notes
+func readTodoDocument(document []byte) (todoFrontMatter, string, error) {
+	var matter todoFrontMatter
+	text := strings.ReplaceAll(string(document), "\r\n", "\n")
+	if !strings.HasPrefix(text, "---\n") {
+		return matter, "", fmt.Errorf("the front-matter must start with a --- line")
+	}
+	header, notes, ok := strings.Cut(strings.TrimPrefix(text, "---\n"), "\n---\n")
+	if !ok {
+		return matter, "", fmt.Errorf("the front-matter must end with a --- line")
+	}
+	if err := yaml.Unmarshal([]byte(header), &matter); err != nil {
+		return matter, "", fmt.Errorf("invalid front-matter: %v", err)
+	}
+	return matter, strings.TrimRight(notes, "\n"), nil
+}
+
+// todoChanges builds the PUT /todos/:id body for the fields that were edited
+func todoChanges(before, after todoFrontMatter, notesBefore, notesAfter string) (map[string]interface{}, error) {
+	requestBody := map[string]interface{}{}
+	if after.Title != before.Title {
+		if strings.TrimSpace(after.Title) == "" {
+			return nil, fmt.Errorf("title must not be empty")
+		}
+		requestBody["title"] = after.Title
+	}
+	if notesAfter != strings.TrimRight(notesBefore, "\n") {
+		requestBody["notes"] = notesAfter
+	}
+	if after.Completed != before.Completed {
+		requestBody["completed"] = after.Completed
+	}
+	if after.Priority != before.Priority {
+		priority, err := models.ParsePriority(after.Priority)
+		if err != nil {
+			return nil, err
+		}
+		requestBody["priority"] = priority.String()
+	}
+	if strings.Join(after.Tags, "\x00") != strings.Join(before.Tags, "\x00") {
+		tags := after.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		requestBody["tags"] = tags
+	}
+
+	for _, date := range []struct {
+		field, before, after string
+		endOfDay             bool
+	}{
+		{"start_at", before.Start, after.Start, false},
+		{"due_at", before.Due, after.Due, true},
+	} {
+		if date.after == date.before {
+			continue
+		}
+		if date.after == "" {
+			requestBody[date.field] = nil
+			continue
+		}
+		t, err := parseDateFlag(date.after, date.endOfDay)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", date.field, err)
+		}
+		requestBody[date.field] = t.Format(time.RFC3339)
+	}
+
+	if after.Repeat != before.Repeat {
+		requestBody["repeat"] = ""
+		if after.Repeat != "" {
+			rule, err := models.ParseRepeat(after.Repeat)
+			if err != nil {
+				return nil, err
+			}
+			requestBody["repeat"] = rule.String()
+			requestBody["repeat_tz"] = localZone()
+		}
+	}
+	return requestBody, nil
+}
+
+// runEditor opens path in $VISUAL or $EDITOR, falling back to vi
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// The editor may come with arguments, e.g. "code --wait"
+	parts := strings.Fields(editor)
+	command := exec.Command(parts[0], append(parts[1:], path)...)
+	command.Stdin = os.Stdin
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+	return command.Run()
+}
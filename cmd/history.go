@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	historyCmd.Flags().Bool("json", false, "print the raw JSON response")
+	todoCmd.AddCommand(historyCmd)
+}
+
+// todoEvent is one entry of GET /todos/:id/history
+type todoEvent struct {
+	Actor   string    `json:"actor"`
+	Action  string    `json:"action"`
+	At      time.Time `json:"at"`
+	Changes []struct {
+		Field  string      `json:"field"`
+		Before interface{} `json:"before"`
+		After  interface{} `json:"after"`
+	} `json:"changes"`
+}
+
+// historyValue shows a recorded field value on one line
+func historyValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "(none)"
+	case string:
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t.Local().Format("2006-01-02 15:04")
+		}
+		v = strings.Join(strings.Fields(v), " ")
+		if runes := []rune(v); len(runes) > 60 {
+			v = string(runes[:59]) + "…"
+		}
+		return fmt.Sprintf("%q", v)
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, item := range v {
+			values[i] = fmt.Sprint(item)
+		}
+		return strings.Join(values, ", ")
+	}
+	return fmt.Sprint(value)
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history [id]",
+	Short: "Show who changed a todo and when, oldest change first",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+
+		// Create a new Resty Client
+		restyClient := apiClient()
+		resp, err := restyClient.R().
+			SetHeader("Authorization", "Bearer "+token).
+			Get(fmt.Sprintf(TODO_SERVER_PATH+"/todos/%s/history", args[0]))
+		if err != nil {
+			fmt.Println("Error fetching the history:", err)
+			return
+		}
+
+		if raw, _ := cmd.Flags().GetBool("json"); raw || resp.IsError() {
+			fmt.Println(string(resp.Body()))
+			return
+		}
+		var events []todoEvent
+		if err := json.Unmarshal(resp.Body(), &events); err != nil {
+			fmt.Println(string(resp.Body()))
+			return
+		}
+		if len(events) == 0 {
+			fmt.Println("No changes recorded.")
+			return
+		}
+		for _, event := range events {
+			fmt.Printf("%s  %s  %s\n", event.At.Local().Format("2006-01-02 15:04"), event.Actor, event.Action)
+			for _, change := range event.Changes {
+				if event.Action == "created" {
+					fmt.Printf("    %s: %s\n", change.Field, historyValue(change.After))
+					continue
+				}
+				// A purge lists the fields as they were last
+				if event.Action == "purged" {
+					fmt.Printf("    %s: %s\n", change.Field, historyValue(change.Before))
+					continue
+				}
+				fmt.Printf("    %s: %s -> %s\n", change.Field, historyValue(change.Before), historyValue(change.After))
+			}
+		}
+	},
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ANSI escape sequences used to style Markdown in the terminal
+const (
+	ansiReset     = "\033[0m"
+	ansiBold      = "\033[1m"
+	ansiDim       = "\033[2m"
+	ansiItalic    = "\033[3m"
+	ansiUnderline = "\033[4m"
+	ansiYellow    = "\033[33m"
+	ansiCyan      = "\033[36m"
+)
+
+var (
+	mdHeading  = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	mdBullet   = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	mdTask     = regexp.MustCompile(`^\[([ xX])\]\s+(.*)$`)
+	mdNumbered = regexp.MustCompile(`^(\s*)(\d+)[.)]\s+(.*)$`)
+	mdRule     = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+	mdCode     = regexp.MustCompile("`([^`]+)`")
+	mdBold     = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	mdItalic   = regexp.MustCompile(`\*([^*\s][^*]*)\*|\b_([^_]+)_\b`)
+	mdLink     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+)
+
+// useColor reports whether stdout is a terminal that should get ANSI styling
+func useColor() bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// renderMarkdown formats the Markdown of todo notes for the terminal. It
+// covers what notes usually hold: headings, lists and checklists, quotes,
+// fenced code, rules, emphasis, inline code and links. Without color the
+// markup is only tidied up, so the output still reads well in a pipe.
+func renderMarkdown(text string, color bool) string {
+	style := func(s string, codes ...string) string {
+		if !color {
+			return s
+		}
+		return strings.Join(codes, "") + s + ansiReset
+	}
+
+	var out []string
+	inCode := false
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			out = append(out, "    "+style(line, ansiCyan))
+			continue
+		}
+
+		switch {
+		case mdRule.MatchString(line):
+			out = append(out, style(strings.Repeat("─", 40), ansiDim))
+		case mdHeading.MatchString(line):
+			match := mdHeading.FindStringSubmatch(line)
+			heading := renderInline(match[2], color)
+			if len(match[1]) == 1 {
+				heading = strings.ToUpper(heading)
+			}
+			out = append(out, style(heading, ansiBold, ansiUnderline))
+		case strings.HasPrefix(line, ">"):
+			quote := strings.TrimSpace(strings.TrimPrefix(line, ">"))
+			out = append(out, style("│ ", ansiDim)+style(renderInline(quote, color), ansiItalic))
+		case mdBullet.MatchString(line):
+			match := mdBullet.FindStringSubmatch(line)
+			marker, item := "•", match[2]
+			if task := mdTask.FindStringSubmatch(item); task != nil {
+				marker, item = "☐", task[2]
+				if task[1] != " " {
+					marker = "☑"
+				}
+			}
+			out = append(out, match[1]+marker+" "+renderInline(item, color))
+		case mdNumbered.MatchString(line):
+			match := mdNumbered.FindStringSubmatch(line)
+			out = append(out, match[1]+match[2]+". "+renderInline(match[3], color))
+		default:
+			out = append(out, renderInline(line, color))
+		}
+	}
+	return strings.TrimRight(strings.Join(out, "\n"), "\n")
+}
+
+// renderInline formats emphasis, inline code and links within a line
+func renderInline(text string, color bool) string {
+	// Keep code spans out of the way of the other rules
+	var spans []string
+	text = mdCode.ReplaceAllStringFunc(text, func(span string) string {
+		spans = append(spans, span[1:len(span)-1])
+		return "\x00" + string(rune(len(spans)-1+'0')) + "\x00"
+	})
+
+	wrap := func(s string, code string) string {
+		if !color {
+			return s
+		}
+		return code + s + ansiReset
+	}
+	text = mdLink.ReplaceAllString(text, wrap("$1", ansiUnderline)+" ($2)")
+	text = mdBold.ReplaceAllStringFunc(text, func(s string) string {
+		match := mdBold.FindStringSubmatch(s)
+		return wrap(match[1]+match[2], ansiBold)
+	})
+	text = mdItalic.ReplaceAllStringFunc(text, func(s string) string {
+		match := mdItalic.FindStringSubmatch(s)
+		return wrap(match[1]+match[2], ansiItalic)
+	})
+
+	for i, span := range spans {
+		text = strings.Replace(text, "\x00"+string(rune(i+'0'))+"\x00", wrap(span, ansiCyan), 1)
+	}
+	return text
+}
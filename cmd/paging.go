@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"todo-cli/services"
+)
+
+// todoPage is one page of a todo listing as returned by the server
+type todoPage struct {
+	Todos      []json.RawMessage `json:"todos"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+// fetchTodoPages lists todos from path page by page, following next_cursor.
+// With page 0 every page is fetched, in pages of the largest size the server
+// allows unless limit is set. Otherwise only that page (counted from 1) of
+// limit todos is returned.
+func fetchTodoPages(token, path string, query url.Values, limit, page int) (todoPage, error) {
+	switch {
+	case limit <= 0 && page > 0:
+		limit = services.DefaultPageSize
+	case limit <= 0:
+		limit = services.MaxPageSize
+	}
+
+	var listed todoPage
+	cursor := ""
+	for number := 1; ; number++ {
+		request := apiClient().R().
+			SetHeader("Authorization", "Bearer "+token).
+			SetQueryParamsFromValues(query).
+			SetQueryParam("limit", strconv.Itoa(limit))
+		if cursor != "" {
+			request.SetQueryParam("cursor", cursor)
+		}
+		resp, err := request.Get(TODO_SERVER_PATH + path)
+		if err != nil {
+			return listed, err
+		}
+		if resp.IsError() {
+			return listed, fmt.Errorf("error fetching todos: %s", resp.String())
+		}
+
+		var current todoPage
+		if err := json.Unmarshal(resp.Body(), &current); err != nil {
+			return listed, err
+		}
+		if page > 0 && number < page {
+			if current.NextCursor == "" {
+				// Asked for a page past the end
+				return todoPage{Todos: []json.RawMessage{}}, nil
+			}
+			cursor = current.NextCursor
+			continue
+		}
+
+		listed.Todos = append(listed.Todos, current.Todos...)
+		listed.NextCursor = current.NextCursor
+		if page > 0 || current.NextCursor == "" {
+			if listed.Todos == nil {
+				listed.Todos = []json.RawMessage{}
+			}
+			return listed, nil
+		}
+		cursor = current.NextCursor
+	}
+}
@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Group command: `todo project`
+var projectCmd = &cobra.Command{
+	Use:   "project",
+	Short: "Manage projects (lists of todos)",
+}
+
+func init() {
+	projectCmd.AddCommand(projectCreateCmd)
+
+	projectLsCmd.Flags().Bool("archived", false, "include archived projects")
+	projectCmd.AddCommand(projectLsCmd)
+	projectCmd.AddCommand(projectRenameCmd)
+
+	projectArchiveCmd.Flags().Bool("undo", false, "unarchive the project instead")
+	projectCmd.AddCommand(projectArchiveCmd)
+
+	projectRmCmd.Flags().Bool("delete-todos", false, "delete the todos of the project instead of moving them to the Inbox")
+	projectCmd.AddCommand(projectRmCmd)
+
+	todoCmd.AddCommand(projectCmd)
+}
+
+// project is the part of a project the CLI shows
+type project struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Archived bool   `json:"archived"`
+}
+
+// resolveProject turns a --project value into a project ID. It accepts an ID,
+// a project name or inbox, which is returned as is.
+func resolveProject(token, value string) (string, error) {
+	if value == "inbox" || primitive.IsValidObjectID(value) {
+		return value, nil
+	}
+
+	var projects []project
+	resp, err := apiClient().R().
+		SetHeader("Authorization", "Bearer "+token).
+		SetQueryParam("archived", "true").
+		SetResult(&projects).
+		Get(TODO_SERVER_PATH + "/projects")
+	if err != nil {
+		return "", err
+	}
+	if resp.IsError() {
+		return "", fmt.Errorf("error fetching projects: %s", resp.String())
+	}
+	for _, p := range projects {
+		if strings.EqualFold(p.Name, value) {
+			return p.ID, nil
+		}
+	}
+	return "", fmt.Errorf("no project named %q", value)
+}
+
+var projectCreateCmd = &cobra.Command{
+	Use:   "create [name]",
+	Short: "Create a new project",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+
+		// Create a new Resty Client
+		restyClient := apiClient()
+		resp, err := restyClient.R().
+			SetHeader("Authorization", "Bearer "+token).
+			SetHeader("Content-Type", "application/json").
+			SetBody(map[string]string{"name": args[0]}).
+			Post(TODO_SERVER_PATH + "/projects")
+		if err != nil {
+			fmt.Println("Error:", err)
+		} else {
+			fmt.Println("Project created:", resp.String())
+		}
+	},
+}
+
+var projectLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List projects",
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+		archived, _ := cmd.Flags().GetBool("archived")
+
+		// Create a new Resty Client
+		restyClient := apiClient()
+		var projects []project
+		resp, err := restyClient.R().
+			SetHeader("Authorization", "Bearer "+token).
+			SetQueryParam("archived", fmt.Sprint(archived)).
+			SetResult(&projects).
+			Get(TODO_SERVER_PATH + "/projects")
+		if err != nil {
+			fmt.Println("Error fetching projects:", err)
+			return
+		}
+		if resp.IsError() {
+			fmt.Println("Error fetching projects:", resp.String())
+			return
+		}
+
+		for _, p := range projects {
+			status := ""
+			if p.Archived {
+				status = "(archived)"
+			}
+			fmt.Printf("%s  %s %s\n", p.ID, p.Name, status)
+		}
+	},
+}
+
+var projectRenameCmd = &cobra.Command{
+	Use:   "rename [project] [name]",
+	Short: "Rename a project",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		updateProject(cmd, args[0], map[string]interface{}{"name": args[1]}, "Project renamed:")
+	},
+}
+
+var projectArchiveCmd = &cobra.Command{
+	Use:   "archive [project]",
+	Short: "Archive a project, hiding it from project ls",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		undo, _ := cmd.Flags().GetBool("undo")
+		updateProject(cmd, args[0], map[string]interface{}{"archived": !undo}, "Project updated:")
+	},
+}
+
+// updateProject sends a PUT /projects/:id for a project given by ID or name
+func updateProject(cmd *cobra.Command, name string, requestBody map[string]interface{}, done string) {
+	token, err := GetTokenForUser(cmd)
+	if err != nil {
+		log.Fatalf("Failed to get token: %v", err)
+	}
+	projectID, err := resolveProject(token, name)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create a new Resty Client
+	restyClient := apiClient()
+	resp, err := restyClient.R().
+		SetHeader("Authorization", "Bearer "+token).
+		SetHeader("Content-Type", "application/json").
+		SetBody(requestBody).
+		Put(fmt.Sprintf(TODO_SERVER_PATH+"/projects/%s", projectID))
+	if err != nil {
+		fmt.Println("Error:", err)
+	} else {
+		fmt.Println(done, resp.String())
+	}
+}
+
+var projectRmCmd = &cobra.Command{
+	Use:   "rm [project]",
+	Short: "Delete a project, moving its todos to the Inbox",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+		projectID, err := resolveProject(token, args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		todos := "inbox"
+		if deleteTodos, _ := cmd.Flags().GetBool("delete-todos"); deleteTodos {
+			todos = "delete"
+		}
+
+		// Create a new Resty Client
+		restyClient := apiClient()
+		resp, err := restyClient.R().
+			SetHeader("Authorization", "Bearer "+token).
+			SetQueryParam("todos", todos).
+			Delete(fmt.Sprintf(TODO_SERVER_PATH+"/projects/%s", projectID))
+		if err != nil {
+			fmt.Println("Error:", err)
+		} else {
+			fmt.Println("Project deleted:", resp.String())
+		}
+	},
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"todo-cli/models"
+
+	"github.com/spf13/cobra"
+)
+
+// setRepeatField adds the recurrence rule of the --repeat flag to a request
+// body, read in the local timezone. A new repeating todo without --due is due
+// at the end of the first day the rule matches, starting today.
+func setRepeatField(cmd *cobra.Command, requestBody map[string]interface{}, clearable bool) error {
+	if !cmd.Flags().Changed("repeat") {
+		return nil
+	}
+	value, _ := cmd.Flags().GetString("repeat")
+	if clearable && value == "none" {
+		requestBody["repeat"] = ""
+		return nil
+	}
+	rule, err := models.ParseRepeat(value)
+	if err != nil {
+		return fmt.Errorf("--repeat: %v", err)
+	}
+	requestBody["repeat"] = rule.String()
+	requestBody["repeat_tz"] = localZone()
+
+	if _, ok := requestBody["due_at"]; !ok && !clearable {
+		today, _ := parseDateFlag("today", true)
+		dueAt, ok := rule.Next(today, today.AddDate(0, 0, -1))
+		if !ok {
+			return fmt.Errorf("--repeat: the rule has already ended")
+		}
+		requestBody["due_at"] = dueAt.Format(time.RFC3339)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -14,25 +15,28 @@ import (
 var (
 	MONGODB_URI      string
 	TODO_SERVER_PATH string
+	STORAGE          string
 )
 var cfgFile string
+var contextName string
 
 func init() {
-	// Load environment variables from the .env file
+	// Load environment variables from the .env file, if there is one
 	err := godotenv.Load()
-	if err != nil {
-		log.Fatalf("Error loading .env file")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("Error loading .env file: %v", err)
 	}
 
 	// Initialize global variables
 	MONGODB_URI = os.Getenv("MONGODB_URI")
 	TODO_SERVER_PATH = os.Getenv("TODO_SERVER_PATH")
-
-	// Check if environment variables are set
-	if MONGODB_URI == "" || TODO_SERVER_PATH == "" {
-		log.Fatal("Environment variables MONGODB_URI or TODO_SERVER_PATH are not set")
+	STORAGE = os.Getenv("STORAGE") // e.g. sqlite://./todos.db, defaults to MongoDB
+	if STORAGE == "" {
+		STORAGE = MONGODB_URI
 	}
+
 	cobra.OnInitialize(initConfig)
+	RootCmd.PersistentFlags().StringVar(&contextName, "context", "", "context to use instead of the current one, see todo-cli context")
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -57,6 +61,13 @@ func initConfig() {
 	if err := viper.ReadInConfig(); err == nil {
 		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
+
+	// The context decides which server the requests go to. A missing server
+	// is reported by the requests, and a missing storage once something opens
+	// it, so `context`, `serve` and `help` work without either.
+	if err := useContext(); err != nil {
+		log.Fatal(err)
+	}
 }
 
 // RootCmd is the base command for the CLI
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	searchTodoCmd.Flags().Int("limit", 0, "maximum number of results, 20 by default")
+	searchTodoCmd.Flags().Bool("json", false, "print the raw JSON response")
+	todoCmd.AddCommand(searchTodoCmd)
+}
+
+// searchResult is a todo found by GET /todos/search
+type searchResult struct {
+	ID         string            `json:"id"`
+	Title      string            `json:"title"`
+	Completed  bool              `json:"completed"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+var searchTodoCmd = &cobra.Command{
+	Use:   "search [words...]",
+	Short: "Search the titles and notes of todos",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+
+		// Create a new Resty Client
+		restyClient := apiClient()
+		request := restyClient.R().
+			SetHeader("Authorization", "Bearer "+token).
+			SetQueryParam("q", strings.Join(args, " "))
+		if limit, _ := cmd.Flags().GetInt("limit"); limit > 0 {
+			request.SetQueryParam("limit", strconv.Itoa(limit))
+		}
+		resp, err := request.Get(TODO_SERVER_PATH + "/todos/search")
+		if err != nil {
+			fmt.Println("Error searching todos:", err)
+			return
+		}
+
+		if raw, _ := cmd.Flags().GetBool("json"); raw || resp.IsError() {
+			fmt.Println(string(resp.Body()))
+			return
+		}
+		var found struct {
+			Results []searchResult `json:"results"`
+		}
+		if err := json.Unmarshal(resp.Body(), &found); err != nil {
+			fmt.Println(string(resp.Body()))
+			return
+		}
+		printSearchResults(found.Results)
+	},
+}
+
+// printSearchResults lists search results best first, with the matched words
+// of the title and notes emphasized
+func printSearchResults(results []searchResult) {
+	if len(results) == 0 {
+		fmt.Println("No todos found.")
+		return
+	}
+	color := useColor()
+	for i, result := range results {
+		mark := "[ ]"
+		if result.Completed {
+			mark = "[x]"
+		}
+		title := html.EscapeString(result.Title)
+		if highlighted, ok := result.Highlights["title"]; ok {
+			title = highlighted
+		}
+		fmt.Printf("%2d. %s %s (%s)\n", i+1, mark, unmark(title, color), result.ID)
+		if notes, ok := result.Highlights["notes"]; ok {
+			fmt.Printf("    %s\n", unmark(notes, color))
+		}
+	}
+}
+
+// unmark turns the <mark></mark> of a highlight into terminal emphasis
+func unmark(highlighted string, color bool) string {
+	start, end := "**", "**"
+	if color {
+		start, end = ansiBold+ansiYellow, ansiReset
+	}
+	highlighted = strings.ReplaceAll(highlighted, "<mark>", start)
+	highlighted = strings.ReplaceAll(highlighted, "</mark>", end)
+	return html.UnescapeString(highlighted)
+}
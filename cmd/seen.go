@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// maxSeenTodos is how many todos the CLI remembers having shown
+const maxSeenTodos = 200
+
+// seenTodo is a todo as the CLI last showed it, which is what an update the
+// user types afterwards is based on
+type seenTodo struct {
+	Todo map[string]interface{} `json:"todo"`
+	At   time.Time              `json:"at"`
+}
+
+// seenPath returns where the todos last shown are kept, next to the credentials
+func seenPath() (string, error) {
+	path, err := credentialsPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "seen"), nil
+}
+
+func loadSeen() (map[string]seenTodo, error) {
+	seen := map[string]seenTodo{}
+	path, err := seenPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return seen, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// A damaged file only means updates are not checked against it
+	if json.Unmarshal(data, &seen) != nil {
+		return map[string]seenTodo{}, nil
+	}
+	return seen, nil
+}
+
+// rememberTodo keeps a todo as it was just shown or saved, in the context
+// it came from, forgetting the todos seen longest ago
+func rememberTodo(body []byte) error {
+	var todo map[string]interface{}
+	if err := json.Unmarshal(body, &todo); err != nil {
+		return err
+	}
+	id, _ := todo["id"].(string)
+	if id == "" {
+		return nil
+	}
+	seen, err := loadSeen()
+	if err != nil {
+		return err
+	}
+	seen[activeContext.Name+"/"+id] = seenTodo{Todo: todo, At: time.Now()}
+
+	if len(seen) > maxSeenTodos {
+		keys := make([]string, 0, len(seen))
+		for key := range seen {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return seen[keys[i]].At.Before(seen[keys[j]].At) })
+		for _, key := range keys[:len(seen)-maxSeenTodos] {
+			delete(seen, key)
+		}
+	}
+
+	path, err := seenPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(seen)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// seenVersion returns the todo with the ID as the CLI last showed it and
+// the version it was at, ok is false when it was not shown yet
+func seenVersion(id string) (todo map[string]interface{}, version int64, ok bool) {
+	seen, err := loadSeen()
+	if err != nil {
+		return nil, 0, false
+	}
+	entry, ok := seen[activeContext.Name+"/"+id]
+	if !ok {
+		return nil, 0, false
+	}
+	v, ok := entry.Todo["version"].(float64)
+	return entry.Todo, int64(v), ok
+}
@@ -1,7 +1,12 @@
 package cmd
 
 import (
+	"context"
+	"log"
+
 	"todo-cli/api"
+	"todo-cli/db"
+	"todo-cli/services"
 
 	"github.com/spf13/cobra"
 )
@@ -11,10 +16,51 @@ var serveCmd = &cobra.Command{
 	Use:   "serve",
 	Short: "Start the API server",
 	Run: func(cmd *cobra.Command, args []string) {
-		api.StartServer() // Start the Gin server
+		ephemeral, _ := cmd.Flags().GetBool("ephemeral")
+		seed, _ := cmd.Flags().GetString("seed")
+
+		storage := STORAGE
+		if ephemeral {
+			// Keep everything in memory, nothing survives the process
+			storage = "memory://ephemeral"
+		} else if seed != "" {
+			log.Fatal("The --seed flag can only be used together with --ephemeral")
+		}
+
+		store, err := db.Open(storage)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer store.Close()
+
+		if seed != "" {
+			fixture, err := services.LoadFixture(seed)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := services.SeedFixture(store.Stores(), fixture); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// Deleted todos stay in the trash for the retention period
+		if retention := services.TrashRetention(); retention > 0 {
+			go services.RunTrashPurge(context.Background(), store.Stores().Todos, store.Stores().Events, retention)
+		}
+
+		if after := services.AutoArchiveAfter(); after > 0 {
+			go services.RunAutoArchive(context.Background(), store.Stores().Todos, store.Stores().Events, after)
+		}
+
+		// Start the Gin server
+		if err := api.StartServer(store.Stores()); err != nil {
+			log.Fatal(err)
+		}
 	},
 }
 
 func init() {
+	serveCmd.Flags().Bool("ephemeral", false, "Keep all data in memory instead of the configured storage")
+	serveCmd.Flags().String("seed", "", "JSON fixture file of users and todos to load into the ephemeral store")
 	RootCmd.AddCommand(serveCmd)
 }
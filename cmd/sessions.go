@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Group command: `user sessions`
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "List and revoke the places you are logged in",
+}
+
+func init() {
+	sessionsLsCmd.Flags().Bool("json", false, "print the raw JSON response")
+	sessionsCmd.AddCommand(sessionsLsCmd)
+	sessionsCmd.AddCommand(sessionsRevokeCmd)
+
+	sessionsRevokeAllCmd.Flags().BoolP("yes", "y", false, "do not ask for confirmation")
+	sessionsCmd.AddCommand(sessionsRevokeAllCmd)
+
+	userCmd.AddCommand(sessionsCmd)
+}
+
+// session is one entry of GET /user/sessions
+type session struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+var sessionsLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List your sessions, the most recently used first",
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+
+		resp, err := apiClient().R().
+			SetHeader("Authorization", "Bearer "+token).
+			Get(TODO_SERVER_PATH + "/user/sessions")
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		var result struct {
+			Sessions []session `json:"sessions"`
+		}
+		if raw, _ := cmd.Flags().GetBool("json"); raw || resp.IsError() || json.Unmarshal(resp.Body(), &result) != nil {
+			fmt.Println(resp.String())
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  ID\tDEVICE\tIP\tCREATED\tLAST USED")
+		for _, s := range result.Sessions {
+			mark := " "
+			if s.Current {
+				mark = "*"
+			}
+			device := s.UserAgent
+			if runes := []rune(device); len(runes) > 40 {
+				device = string(runes[:39]) + "…"
+			}
+			fmt.Fprintf(w, "%s %s\t%s\t%s\t%s\t%s\n", mark, s.ID, device, s.IP,
+				s.CreatedAt.Local().Format("2006-01-02 15:04"), s.LastUsedAt.Local().Format("2006-01-02 15:04"))
+		}
+		w.Flush()
+	},
+}
+
+var sessionsRevokeCmd = &cobra.Command{
+	Use:   "revoke [id]...",
+	Short: "Log out the given sessions",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+
+		for _, id := range args {
+			var result struct {
+				Current bool `json:"current"`
+			}
+			resp, err := apiClient().R().
+				SetHeader("Authorization", "Bearer "+token).
+				SetResult(&result).
+				Delete(TODO_SERVER_PATH + "/user/sessions/" + id)
+			if err != nil {
+				fmt.Println("Error:", err)
+				continue
+			}
+			if resp.IsError() {
+				fmt.Printf("%s: %s\n", id, resp.String())
+				continue
+			}
+			fmt.Println("Session revoked:", id)
+			// Revoking this session logs the CLI out
+			if result.Current {
+				if err := removeCredentials(); err != nil {
+					log.Fatalf("Error removing credentials: %v", err)
+				}
+				fmt.Println("That was this session, you are logged out.")
+				return
+			}
+		}
+	},
+}
+
+var sessionsRevokeAllCmd = &cobra.Command{
+	Use:   "revoke-all",
+	Short: "Log out everywhere, this session included",
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+
+		if yes, _ := cmd.Flags().GetBool("yes"); !yes {
+			fmt.Print("Log out of every session, this one included? [y/N] ")
+			answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+				fmt.Println("Nothing revoked.")
+				return
+			}
+		}
+
+		resp, err := apiClient().R().
+			SetHeader("Authorization", "Bearer "+token).
+			Delete(TODO_SERVER_PATH + "/user/sessions")
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if resp.IsError() {
+			fmt.Println("Error:", resp.String())
+			return
+		}
+		if err := removeCredentials(); err != nil {
+			log.Fatalf("Error removing credentials: %v", err)
+		}
+		fmt.Println("Logged out everywhere.")
+	},
+}
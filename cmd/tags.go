@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+
+	"github.com/spf13/cobra"
+)
+
+// Group command: `todo tag`
+var tagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "Manage the tags of todos",
+}
+
+func init() {
+	tagCmd.AddCommand(tagAddCmd)
+	tagCmd.AddCommand(tagRmCmd)
+	tagCmd.AddCommand(tagLsCmd)
+	tagCmd.AddCommand(tagRenameCmd)
+	todoCmd.AddCommand(tagCmd)
+}
+
+var tagAddCmd = &cobra.Command{
+	Use:   "add [id] [tag...]",
+	Short: "Add tags to a todo",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+
+		// Create a new Resty Client
+		restyClient := apiClient()
+		resp, err := restyClient.R().
+			SetHeader("Authorization", "Bearer "+token).
+			SetHeader("Content-Type", "application/json").
+			SetBody(map[string][]string{"tags": args[1:]}).
+			Post(fmt.Sprintf(TODO_SERVER_PATH+"/todos/%s/tags", args[0]))
+		if err != nil {
+			fmt.Println("Error:", err)
+		} else {
+			fmt.Println("TODO tagged:", resp.String())
+		}
+	},
+}
+
+var tagRmCmd = &cobra.Command{
+	Use:   "rm [id] [tag...]",
+	Short: "Remove tags from a todo",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+
+		// Create a new Resty Client
+		restyClient := apiClient()
+		for _, tag := range args[1:] {
+			resp, err := restyClient.R().
+				SetHeader("Authorization", "Bearer "+token).
+				Delete(fmt.Sprintf(TODO_SERVER_PATH+"/todos/%s/tags/%s", args[0], url.PathEscape(tag)))
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			fmt.Println("TODO untagged:", resp.String())
+		}
+	},
+}
+
+var tagLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List tags with the number of todos using them",
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+
+		// Create a new Resty Client
+		restyClient := apiClient()
+		var tags []struct {
+			Tag   string `json:"tag"`
+			Count int    `json:"count"`
+		}
+		resp, err := restyClient.R().
+			SetHeader("Authorization", "Bearer "+token).
+			SetResult(&tags).
+			Get(TODO_SERVER_PATH + "/tags")
+		if err != nil {
+			fmt.Println("Error fetching tags:", err)
+			return
+		}
+		if resp.IsError() {
+			fmt.Println("Error fetching tags:", resp.String())
+			return
+		}
+
+		for _, tag := range tags {
+			fmt.Printf("%-20s %d\n", tag.Tag, tag.Count)
+		}
+	},
+}
+
+var tagRenameCmd = &cobra.Command{
+	Use:   "rename [old] [new]",
+	Short: "Rename a tag on all todos",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+
+		// Create a new Resty Client
+		restyClient := apiClient()
+		resp, err := restyClient.R().
+			SetHeader("Authorization", "Bearer "+token).
+			SetHeader("Content-Type", "application/json").
+			SetBody(map[string]string{"name": args[1]}).
+			Put(fmt.Sprintf(TODO_SERVER_PATH+"/tags/%s", url.PathEscape(args[0])))
+		if err != nil {
+			fmt.Println("Error:", err)
+		} else {
+			fmt.Println("Tag renamed:", resp.String())
+		}
+	},
+}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"todo-cli/models"
+
+	"github.com/spf13/cobra"
+)
+
+// Group command: `user token`
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage personal access tokens for scripts and integrations",
+	Long: `Personal access tokens let cron jobs and bots use the API without logging in.
+Send one as "Authorization: Bearer <token>", or set TODO_TOKEN to run the CLI with it.`,
+}
+
+func init() {
+	tokenCreateCmd.Flags().StringSlice("scope", []string{models.ScopeTodosRead},
+		"scope to grant, can be repeated: "+strings.Join(models.Scopes, ", "))
+	tokenCreateCmd.Flags().String("expires", "", "expire the token after a duration like 90d or 12h, or on a date like 2025-12-31")
+	tokenCreateCmd.Flags().Bool("json", false, "print the raw JSON response")
+	tokenCmd.AddCommand(tokenCreateCmd)
+
+	tokenLsCmd.Flags().Bool("json", false, "print the raw JSON response")
+	tokenCmd.AddCommand(tokenLsCmd)
+	tokenCmd.AddCommand(tokenRevokeCmd)
+
+	userCmd.AddCommand(tokenCmd)
+}
+
+// accessToken is one entry of GET /user/tokens
+type accessToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// parseExpiry turns an --expires value into the time the token expires at,
+// either a duration from now, which may count days, or a date
+func parseExpiry(value string) (time.Time, error) {
+	if strings.HasSuffix(value, "d") {
+		if n, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil && n > 0 {
+			return time.Now().AddDate(0, 0, n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return time.Now().Add(d), nil
+	}
+	t, err := parseDateFlag(value, true)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiry %q, use a duration like 90d or 12h, or a date", value)
+	}
+	return t, nil
+}
+
+var tokenCreateCmd = &cobra.Command{
+	Use:   "create [name]",
+	Short: "Create a personal access token, it is shown only once",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+
+		scopes, _ := cmd.Flags().GetStringSlice("scope")
+		requestBody := map[string]interface{}{"name": args[0], "scopes": scopes}
+		if expires, _ := cmd.Flags().GetString("expires"); expires != "" {
+			t, err := parseExpiry(expires)
+			if err != nil {
+				log.Fatalf("--expires: %v", err)
+			}
+			requestBody["expires_at"] = t.Format(time.RFC3339)
+		}
+
+		resp, err := apiClient().R().
+			SetHeader("Authorization", "Bearer "+token).
+			SetHeader("Content-Type", "application/json").
+			SetBody(requestBody).
+			Post(TODO_SERVER_PATH + "/user/tokens/")
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		var result struct {
+			accessToken
+			Token string `json:"token"`
+		}
+		if raw, _ := cmd.Flags().GetBool("json"); raw || resp.IsError() || json.Unmarshal(resp.Body(), &result) != nil {
+			fmt.Println(resp.String())
+			return
+		}
+
+		fmt.Printf("Token %s created with %s (id %s).\n", result.Name, strings.Join(result.Scopes, ", "), result.ID)
+		if result.ExpiresAt != nil {
+			fmt.Println("It expires on", result.ExpiresAt.Local().Format("2006-01-02 15:04")+".")
+		}
+		fmt.Println("Copy it now, it will not be shown again:")
+		fmt.Println(result.Token)
+	},
+}
+
+var tokenLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List your personal access tokens",
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+
+		resp, err := apiClient().R().
+			SetHeader("Authorization", "Bearer "+token).
+			Get(TODO_SERVER_PATH + "/user/tokens/")
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		var result struct {
+			Tokens []accessToken `json:"tokens"`
+		}
+		if raw, _ := cmd.Flags().GetBool("json"); raw || resp.IsError() || json.Unmarshal(resp.Body(), &result) != nil {
+			fmt.Println(resp.String())
+			return
+		}
+		if len(result.Tokens) == 0 {
+			fmt.Println("No personal access tokens.")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tSCOPES\tCREATED\tEXPIRES\tLAST USED")
+		for _, t := range result.Tokens {
+			expires := "never"
+			if t.ExpiresAt != nil {
+				expires = t.ExpiresAt.Local().Format("2006-01-02 15:04")
+				if !t.ExpiresAt.After(time.Now()) {
+					expires += " (expired)"
+				}
+			}
+			lastUsed := "never"
+			if t.LastUsedAt != nil {
+				lastUsed = t.LastUsedAt.Local().Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, strings.Join(t.Scopes, ","),
+				t.CreatedAt.Local().Format("2006-01-02 15:04"), expires, lastUsed)
+		}
+		w.Flush()
+	},
+}
+
+var tokenRevokeCmd = &cobra.Command{
+	Use:   "revoke [id or name]...",
+	Short: "Revoke personal access tokens, they stop working at once",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+
+		// Names are looked up among the tokens of the user
+		var result struct {
+			Tokens []accessToken `json:"tokens"`
+		}
+		resp, err := apiClient().R().
+			SetHeader("Authorization", "Bearer "+token).
+			SetResult(&result).
+			Get(TODO_SERVER_PATH + "/user/tokens/")
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		if resp.IsError() {
+			log.Fatalf("Error: %s", resp.String())
+		}
+
+		for _, arg := range args {
+			id := arg
+			for _, t := range result.Tokens {
+				if strings.EqualFold(t.Name, arg) {
+					id = t.ID
+				}
+			}
+			resp, err := apiClient().R().
+				SetHeader("Authorization", "Bearer "+token).
+				Delete(TODO_SERVER_PATH + "/user/tokens/" + id)
+			if err != nil {
+				fmt.Println("Error:", err)
+				continue
+			}
+			if resp.IsError() {
+				fmt.Printf("%s: %s\n", arg, resp.String())
+				continue
+			}
+			fmt.Println("Token revoked:", arg)
+		}
+	},
+}
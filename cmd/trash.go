@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/spf13/cobra"
+)
+
+// Group command: `todo trash`
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "List, restore or permanently delete deleted todos",
+}
+
+func init() {
+	trashLsCmd.Flags().Bool("json", false, "print the raw JSON response")
+	trashCmd.AddCommand(trashLsCmd)
+	trashCmd.AddCommand(trashRestoreCmd)
+
+	trashEmptyCmd.Flags().BoolP("yes", "y", false, "do not ask for confirmation")
+	trashCmd.AddCommand(trashEmptyCmd)
+
+	todoCmd.AddCommand(trashCmd)
+}
+
+// trashedTodo is the part of a deleted todo the CLI shows
+type trashedTodo struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	ParentID  string    `json:"parent_id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// fetchTrash lists the todos in the trash of the user
+func fetchTrash(token string) ([]trashedTodo, *resty.Response, error) {
+	var todos []trashedTodo
+	resp, err := apiClient().R().
+		SetHeader("Authorization", "Bearer "+token).
+		SetResult(&todos).
+		Get(TODO_SERVER_PATH + "/trash")
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.IsError() {
+		return nil, resp, fmt.Errorf("error fetching the trash: %s", resp.String())
+	}
+	return todos, resp, nil
+}
+
+var trashLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the todos in the trash, the last deleted first",
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+		todos, resp, err := fetchTrash(token)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		if raw, _ := cmd.Flags().GetBool("json"); raw {
+			fmt.Println(resp.String())
+			return
+		}
+		if len(todos) == 0 {
+			fmt.Println("The trash is empty.")
+			return
+		}
+		for _, todo := range todos {
+			subtask := ""
+			if todo.ParentID != "" {
+				subtask = " (subtask)"
+			}
+			fmt.Printf("%s  %s  %s%s\n", todo.ID, todo.DeletedAt.Local().Format("2006-01-02 15:04"), todo.Title, subtask)
+		}
+	},
+}
+
+var trashRestoreCmd = &cobra.Command{
+	Use:   "restore [id]...",
+	Short: "Restore todos from the trash together with the subtasks deleted with them",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+
+		// Create a new Resty Client
+		restyClient := apiClient()
+		for _, id := range args {
+			resp, err := restyClient.R().
+				SetHeader("Authorization", "Bearer "+token).
+				Post(fmt.Sprintf(TODO_SERVER_PATH+"/trash/%s/restore", id))
+			if err != nil {
+				fmt.Println("Error:", err)
+				continue
+			}
+			if resp.IsError() {
+				fmt.Printf("Error restoring %s: %s\n", id, resp.String())
+				continue
+			}
+			fmt.Println("TODO restored:", resp.String())
+		}
+	},
+}
+
+var trashEmptyCmd = &cobra.Command{
+	Use:   "empty",
+	Short: "Permanently delete every todo in the trash",
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+
+		if yes, _ := cmd.Flags().GetBool("yes"); !yes {
+			todos, _, err := fetchTrash(token)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if len(todos) == 0 {
+				fmt.Println("The trash is empty.")
+				return
+			}
+			fmt.Printf("Permanently delete %d todos? [y/N] ", len(todos))
+			answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+				fmt.Println("Nothing deleted.")
+				return
+			}
+		}
+
+		// Create a new Resty Client
+		restyClient := apiClient()
+		resp, err := restyClient.R().
+			SetHeader("Authorization", "Bearer "+token).
+			Delete(TODO_SERVER_PATH + "/trash")
+		if err != nil {
+			fmt.Println("Error:", err)
+		} else {
+			fmt.Println("Response:", resp.String())
+		}
+	},
+}
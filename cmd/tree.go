@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// treeTodo is the part of a todo the tree view needs
+type treeTodo struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Completed bool   `json:"completed"`
+	ParentID  string `json:"parent_id"`
+	Progress  *struct {
+		Summary string `json:"summary"`
+	} `json:"progress"`
+}
+
+// printTodoTree prints the todos of a GET /todos response indented below
+// their parents, keeping the order the server returned them in. Subtasks whose
+// parent is not part of the response are shown at the top level.
+func printTodoTree(page []json.RawMessage) error {
+	todos := make([]treeTodo, len(page))
+	for i, raw := range page {
+		if err := json.Unmarshal(raw, &todos[i]); err != nil {
+			return err
+		}
+	}
+
+	listed := map[string]bool{}
+	for _, todo := range todos {
+		listed[todo.ID] = true
+	}
+	children := map[string][]treeTodo{}
+	var roots []treeTodo
+	for _, todo := range todos {
+		if todo.ParentID != "" && listed[todo.ParentID] {
+			children[todo.ParentID] = append(children[todo.ParentID], todo)
+		} else {
+			roots = append(roots, todo)
+		}
+	}
+
+	var printNode func(todo treeTodo, depth int)
+	printNode = func(todo treeTodo, depth int) {
+		mark := "[ ]"
+		if todo.Completed {
+			mark = "[x]"
+		}
+		line := fmt.Sprintf("%s%s %s (%s)", strings.Repeat("  ", depth), mark, todo.Title, todo.ID)
+		if todo.Progress != nil {
+			line += " " + todo.Progress.Summary
+		}
+		fmt.Println(line)
+		for _, child := range children[todo.ID] {
+			printNode(child, depth+1)
+		}
+	}
+	for _, todo := range roots {
+		printNode(todo, 0)
+	}
+	if len(todos) == 0 {
+		fmt.Println("No todos found.")
+	}
+	return nil
+}
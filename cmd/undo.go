@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	undoCmd.Flags().Bool("json", false, "print the raw JSON response")
+	todoCmd.AddCommand(undoCmd)
+
+	redoCmd.Flags().Bool("json", false, "print the raw JSON response")
+	todoCmd.AddCommand(redoCmd)
+}
+
+// replayedChange is a todo changed by an undone or redone operation
+type replayedChange struct {
+	Before *struct {
+		Title string `json:"title"`
+	} `json:"before"`
+	After *struct {
+		Title string `json:"title"`
+	} `json:"after"`
+}
+
+// title returns the title of the todo as the undo or redo left it
+func (c replayedChange) title(undo bool) string {
+	if c.Before != nil && (undo || c.After == nil) {
+		return c.Before.Title
+	}
+	return c.After.Title
+}
+
+// replayOperation posts to /todos/undo or /todos/redo and lists the todos
+// the operation changed
+func replayOperation(cmd *cobra.Command, path string, undo bool) {
+	token, err := GetTokenForUser(cmd)
+	if err != nil {
+		log.Fatalf("Failed to get token: %v", err)
+	}
+
+	// Create a new Resty Client
+	restyClient := apiClient()
+	resp, err := restyClient.R().
+		SetHeader("Authorization", "Bearer "+token).
+		Post(TODO_SERVER_PATH + path)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	if raw, _ := cmd.Flags().GetBool("json"); raw {
+		fmt.Println(resp.String())
+		return
+	}
+	var result struct {
+		Message   string `json:"message"`
+		Error     string `json:"error"`
+		Operation struct {
+			Changes []replayedChange `json:"changes"`
+		} `json:"operation"`
+	}
+	if err := json.Unmarshal(resp.Body(), &result); err != nil {
+		fmt.Println(resp.String())
+		return
+	}
+	if resp.IsError() {
+		fmt.Println("Error:", result.Error)
+		return
+	}
+	fmt.Println(result.Message)
+	for _, change := range result.Operation.Changes {
+		fmt.Println("  " + change.title(undo))
+	}
+}
+
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Undo the last change made to your todos",
+	Run: func(cmd *cobra.Command, args []string) {
+		replayOperation(cmd, "/todos/undo", true)
+	},
+}
+
+var redoCmd = &cobra.Command{
+	Use:   "redo",
+	Short: "Redo the last undone change to your todos",
+	Run: func(cmd *cobra.Command, args []string) {
+		replayOperation(cmd, "/todos/redo", false)
+	},
+}
@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/spf13/cobra"
+)
+
+// Group command: `todo view`
+var viewCmd = &cobra.Command{
+	Use:   "view",
+	Short: "Save and run named todo listings (smart lists)",
+}
+
+func init() {
+	viewCmd.AddCommand(viewLsCmd)
+
+	viewSaveCmd.Flags().String("where", "", whereHelp)
+	viewSaveCmd.Flags().String("sort", "", "comma separated fields to sort by, - for descending, e.g. due_at,-priority")
+	viewCmd.AddCommand(viewSaveCmd)
+
+	viewRunCmd.Flags().String("sort", "", "sort by these fields instead of the sort of the view")
+	viewRunCmd.Flags().Int("limit", 0, "number of todos per page, all pages are fetched unless --page is given")
+	viewRunCmd.Flags().Int("page", 0, "only fetch this page, counted from 1")
+	viewRunCmd.Flags().Bool("json", false, "print the raw JSON response instead of a tree")
+	viewCmd.AddCommand(viewRunCmd)
+
+	viewCmd.AddCommand(viewRmCmd)
+
+	todoCmd.AddCommand(viewCmd)
+}
+
+// savedView is the part of a saved view the CLI shows
+type savedView struct {
+	ID     string `json:"id"`
+	Key    string `json:"key"`
+	Name   string `json:"name"`
+	Filter string `json:"filter"`
+	Sort   string `json:"sort"`
+}
+
+// ref is how the view is addressed in /views/:id
+func (v savedView) ref() string {
+	if v.Key != "" {
+		return v.Key
+	}
+	return v.ID
+}
+
+// fetchViews lists the built-in and saved views of the user
+func fetchViews(token string) ([]savedView, error) {
+	var views []savedView
+	resp, err := apiClient().R().
+		SetHeader("Authorization", "Bearer "+token).
+		SetResult(&views).
+		Get(TODO_SERVER_PATH + "/views")
+	if err != nil {
+		return nil, err
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("error fetching views: %s", resp.String())
+	}
+	return views, nil
+}
+
+// findView looks a view up by name, ID or built-in key. found is false
+// when the user has no such view.
+func findView(token, value string) (view savedView, found bool, err error) {
+	views, err := fetchViews(token)
+	if err != nil {
+		return view, false, err
+	}
+	for _, v := range views {
+		if strings.EqualFold(v.Name, value) || v.ID == value || strings.EqualFold(v.Key, value) {
+			return v, true, nil
+		}
+	}
+	return view, false, nil
+}
+
+var viewLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List views",
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+		views, err := fetchViews(token)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		for _, v := range views {
+			query := v.Filter
+			if v.Sort != "" {
+				query += "  sort " + v.Sort
+			}
+			id := v.ID
+			if v.Key != "" {
+				id = v.Key + " (built-in)"
+			}
+			fmt.Printf("%-24s  %-20s  %s\n", id, v.Name, query)
+		}
+	},
+}
+
+var viewSaveCmd = &cobra.Command{
+	Use:   "save [name]",
+	Short: "Save a view, or change the query of an existing one",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+		where, _ := cmd.Flags().GetString("where")
+		if where != "" {
+			if err := checkWhere(where); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		existing, found, err := findView(token, args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		requestBody := map[string]interface{}{}
+		if cmd.Flags().Changed("where") || !found {
+			requestBody["filter"] = where
+		}
+		if cmd.Flags().Changed("sort") || !found {
+			sort, _ := cmd.Flags().GetString("sort")
+			requestBody["sort"] = sort
+		}
+
+		request := apiClient().R().
+			SetHeader("Authorization", "Bearer "+token).
+			SetHeader("Content-Type", "application/json")
+		var resp *resty.Response
+		if found {
+			resp, err = request.SetBody(requestBody).Put(fmt.Sprintf(TODO_SERVER_PATH+"/views/%s", existing.ref()))
+		} else {
+			requestBody["name"] = args[0]
+			resp, err = request.SetBody(requestBody).Post(TODO_SERVER_PATH + "/views")
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if resp.IsError() {
+			fmt.Println("Error saving view:", resp.String())
+			return
+		}
+		fmt.Println("View saved:", resp.String())
+	},
+}
+
+var viewRunCmd = &cobra.Command{
+	Use:   "run [name]",
+	Short: "List the todos of a view",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+		view, found, err := findView(token, args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !found {
+			log.Fatalf("No view named %q, see todo view ls", args[0])
+		}
+
+		query := url.Values{}
+		query.Set("tz", localOffset())
+		if sort, _ := cmd.Flags().GetString("sort"); sort != "" {
+			query.Set("sort", sort)
+		}
+		limit, _ := cmd.Flags().GetInt("limit")
+		page, _ := cmd.Flags().GetInt("page")
+		todos, err := fetchTodoPages(token, "/views/"+view.ref()+"/todos", query, limit, page)
+		if err != nil {
+			fmt.Println("Error fetching todos:", err)
+			return
+		}
+
+		if raw, _ := cmd.Flags().GetBool("json"); raw {
+			body, _ := json.Marshal(todos)
+			fmt.Println(string(body))
+			return
+		}
+		if err := printTodoTree(todos.Todos); err != nil {
+			fmt.Println("Error reading todos:", err)
+		}
+		if page > 0 && todos.NextCursor != "" {
+			fmt.Printf("More todos on --page %d\n", page+1)
+		}
+	},
+}
+
+var viewRmCmd = &cobra.Command{
+	Use:   "rm [name]",
+	Short: "Delete a saved view",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := GetTokenForUser(cmd)
+		if err != nil {
+			log.Fatalf("Failed to get token: %v", err)
+		}
+		view, found, err := findView(token, args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !found {
+			log.Fatalf("No view named %q, see todo view ls", args[0])
+		}
+
+		// Create a new Resty Client
+		restyClient := apiClient()
+		resp, err := restyClient.R().
+			SetHeader("Authorization", "Bearer "+token).
+			Delete(fmt.Sprintf(TODO_SERVER_PATH+"/views/%s", view.ref()))
+		if err != nil {
+			fmt.Println("Error:", err)
+		} else {
+			fmt.Println("Response:", resp.String())
+		}
+	},
+}
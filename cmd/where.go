@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"todo-cli/services"
+)
+
+// checkWhere parses a --where expression the way the server will, so a
+// mistake is reported before any request with the offending spot marked:
+//
+//	--where: column 10: unknown field "prio"
+//	  tag:work prio>=high
+//	           ^
+func checkWhere(expr string) error {
+	_, err := services.ParseFilterExpr(expr)
+	var syntaxErr *services.FilterSyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return err
+	}
+	// Tabs keep their width so the caret stays under the right character
+	indent := []rune(expr)[:syntaxErr.Column-1]
+	for i, r := range indent {
+		if r != '\t' {
+			indent[i] = ' '
+		}
+	}
+	return fmt.Errorf("--where: %v\n  %s\n  %s^", err, expr, string(indent))
+}
+
+// whereHelp sums up the --where syntax for the flag usage
+var whereHelp = strings.Join([]string{
+	"filter expression, e.g. 'tag:work AND (priority>=high OR due<today) AND NOT done'.",
+	"Fields: tag, project, title, notes, priority, due, start, created, updated, age, done, is, has;",
+	"dates are today, tomorrow, yesterday, 3d, -2w or YYYY-MM-DD, ages 30d or 4w",
+}, " ")
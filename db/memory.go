@@ -0,0 +1,703 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"todo-cli/models"
+	"todo-cli/services"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore implements the todo, project, view, event, operation, user and token stores in process memory.
+// Documents are kept BSON encoded so callers never share state with the store.
+type MemoryStore struct {
+	mu         sync.RWMutex
+	todos      []memoryDoc
+	projects   []memoryDoc
+	views      []memoryDoc
+	events     []memoryDoc
+	operations []memoryDoc
+	users      []memoryDoc
+	tokens     []memoryDoc
+	// accessTokens are the personal access tokens, sessions are in tokens
+	accessTokens []memoryDoc
+}
+
+// memoryDoc is a stored document with the fields it is looked up by
+type memoryDoc struct {
+	id     primitive.ObjectID
+	userID primitive.ObjectID
+	key    string // username for users, session ID for tokens, todo ID for events
+	owner  string // user ID of tokens
+	data   []byte
+}
+
+var (
+	_ services.TodoStore      = (*MemoryStore)(nil)
+	_ services.ProjectStore   = (*MemoryStore)(nil)
+	_ services.ViewStore      = (*MemoryStore)(nil)
+	_ services.EventStore     = (*MemoryStore)(nil)
+	_ services.OperationStore = (*MemoryStore)(nil)
+	_ services.UserStore      = (*MemoryStore)(nil)
+	_ services.TokenStore     = (*MemoryStore)(nil)
+	_ services.Transactor     = (*MemoryStore)(nil)
+)
+
+var (
+	memoryStoresMu sync.Mutex
+	memoryStores   = map[string]*MemoryStore{}
+)
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// namedMemoryStore returns the process wide store registered under name, so the
+// server and in-process CLI commands opening the same memory:// URL share data
+func namedMemoryStore(name string) *MemoryStore {
+	memoryStoresMu.Lock()
+	defer memoryStoresMu.Unlock()
+
+	store, ok := memoryStores[name]
+	if !ok {
+		store = NewMemoryStore()
+		memoryStores[name] = store
+	}
+	return store
+}
+
+// Stores returns the store wired into every slot of services.Stores
+func (s *MemoryStore) Stores() services.Stores {
+	return services.Stores{Todos: s, Projects: s, Views: s, Events: s, Operations: s, Users: s, Tokens: s, Transactions: s}
+}
+
+// InTransaction runs fn on a copy of the store and keeps the copy when fn
+// succeeds. The store stays locked meanwhile, so nothing else sees or
+// changes its documents halfway.
+func (s *MemoryStore) InTransaction(ctx context.Context, fn func(ctx context.Context, stores services.Stores) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &MemoryStore{
+		todos:        append([]memoryDoc(nil), s.todos...),
+		projects:     append([]memoryDoc(nil), s.projects...),
+		views:        append([]memoryDoc(nil), s.views...),
+		events:       append([]memoryDoc(nil), s.events...),
+		operations:   append([]memoryDoc(nil), s.operations...),
+		users:        append([]memoryDoc(nil), s.users...),
+		tokens:       append([]memoryDoc(nil), s.tokens...),
+		accessTokens: append([]memoryDoc(nil), s.accessTokens...),
+	}
+	if err := fn(ctx, tx.Stores()); err != nil {
+		return err
+	}
+	s.todos, s.projects, s.views, s.events = tx.todos, tx.projects, tx.views, tx.events
+	s.operations, s.users, s.tokens, s.accessTokens = tx.operations, tx.users, tx.tokens, tx.accessTokens
+	return nil
+}
+
+// Close is a no-op, the data lives as long as the process
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// find decodes the first document matching into out
+func find(docs []memoryDoc, out interface{}, match func(memoryDoc) bool) error {
+	for _, doc := range docs {
+		if match(doc) {
+			return bson.Unmarshal(doc.data, out)
+		}
+	}
+	return services.ErrNotFound
+}
+
+// findAll decodes every document matching
+func findAll[T any](docs []memoryDoc, match func(memoryDoc) bool) ([]T, error) {
+	var found []T
+	for _, doc := range docs {
+		if !match(doc) {
+			continue
+		}
+		var out T
+		if err := bson.Unmarshal(doc.data, &out); err != nil {
+			return nil, err
+		}
+		found = append(found, out)
+	}
+	return found, nil
+}
+
+// InsertTodo stores a new todo
+func (s *MemoryStore) InsertTodo(ctx context.Context, todo models.Todo) error {
+	data, err := bson.Marshal(todo)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.todos = append(s.todos, memoryDoc{id: todo.ID, userID: todo.UserID, data: data})
+	return nil
+}
+
+// FindTodos returns every todo owned by the user
+func (s *MemoryStore) FindTodos(ctx context.Context, userID primitive.ObjectID, query services.TodoQuery) ([]models.Todo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	todos, err := findAll[models.Todo](s.todos, func(doc memoryDoc) bool { return doc.userID == userID })
+	if err != nil {
+		return nil, err
+	}
+	return query.Select(todos), nil
+}
+
+// ScanTodos decodes the todos owned by the user one at a time
+func (s *MemoryStore) ScanTodos(ctx context.Context, userID primitive.ObjectID, fn func(models.Todo) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, doc := range s.todos {
+		if doc.userID != userID {
+			continue
+		}
+		var todo models.Todo
+		if err := bson.Unmarshal(doc.data, &todo); err != nil {
+			return err
+		}
+		if err := fn(todo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SearchTodos scores the todos of the user passing the query by the words
+// matching the terms, title matches weigh three times as much as notes
+func (s *MemoryStore) SearchTodos(ctx context.Context, userID primitive.ObjectID, terms []string, query services.TodoQuery, limit int) ([]services.TodoMatch, error) {
+	var matches []services.TodoMatch
+	err := s.ScanTodos(ctx, userID, func(todo models.Todo) error {
+		if !query.Match(todo) {
+			return nil
+		}
+		score := 3*services.CountMatches(todo.Title, terms) + services.CountMatches(todo.Notes, terms)
+		if score > 0 {
+			matches = append(matches, services.TodoMatch{Todo: todo, Score: float64(score)})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Todo.CreatedAt.After(matches[j].Todo.CreatedAt)
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// FindTodo returns a single todo owned by the user
+func (s *MemoryStore) FindTodo(ctx context.Context, id, userID primitive.ObjectID) (models.Todo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var todo models.Todo
+	err := find(s.todos, &todo, func(doc memoryDoc) bool { return doc.id == id && doc.userID == userID })
+	return todo, err
+}
+
+// ReplaceTodo overwrites a stored todo with the given one, as long as the
+// stored one is still at version
+func (s *MemoryStore) ReplaceTodo(ctx context.Context, todo models.Todo, version int64) error {
+	data, err := bson.Marshal(todo)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, doc := range s.todos {
+		if doc.id != todo.ID || doc.userID != todo.UserID {
+			continue
+		}
+		var current models.Todo
+		if err := bson.Unmarshal(doc.data, &current); err != nil {
+			return err
+		}
+		if current.Version != version {
+			return &services.VersionMismatchError{Expected: version, Current: current.Version}
+		}
+		s.todos[i].data = data
+		return nil
+	}
+	return services.ErrNotFound
+}
+
+// DeleteTodo removes a todo owned by the user
+func (s *MemoryStore) DeleteTodo(ctx context.Context, id, userID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, doc := range s.todos {
+		if doc.id == id && doc.userID == userID {
+			s.todos = append(s.todos[:i], s.todos[i+1:]...)
+			return nil
+		}
+	}
+	return services.ErrNotFound
+}
+
+// PurgeTodos deletes the todos of every user moved to the trash before the given time
+func (s *MemoryStore) PurgeTodos(ctx context.Context, before time.Time) ([]models.Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged []models.Todo
+	// A fresh slice leaves s.todos whole when a document fails to decode
+	kept := make([]memoryDoc, 0, len(s.todos))
+	for _, doc := range s.todos {
+		var todo models.Todo
+		if err := bson.Unmarshal(doc.data, &todo); err != nil {
+			return nil, err
+		}
+		if todo.DeletedAt != nil && todo.DeletedAt.Before(before) {
+			purged = append(purged, todo)
+			continue
+		}
+		kept = append(kept, doc)
+	}
+	s.todos = kept
+	return purged, nil
+}
+
+// ArchiveTodos archives the todos of every user completed before the given time
+func (s *MemoryStore) ArchiveTodos(ctx context.Context, completedBefore, archivedAt time.Time) ([]models.Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var archived []models.Todo
+	for i, doc := range s.todos {
+		var todo models.Todo
+		if err := bson.Unmarshal(doc.data, &todo); err != nil {
+			return archived, err
+		}
+		if !archivable(todo, completedBefore) {
+			continue
+		}
+		before := todo
+		todo.ArchivedAt = &archivedAt
+		todo.Version++
+		data, err := bson.Marshal(todo)
+		if err != nil {
+			return archived, err
+		}
+		s.todos[i].data = data
+		archived = append(archived, before)
+	}
+	return archived, nil
+}
+
+// archivable reports whether ArchiveTodos should archive a todo
+func archivable(todo models.Todo, completedBefore time.Time) bool {
+	return todo.Completed && todo.ArchivedAt == nil && todo.DeletedAt == nil && todo.CompletionTime().Before(completedBefore)
+}
+
+// InsertProject stores a new project
+func (s *MemoryStore) InsertProject(ctx context.Context, project models.Project) error {
+	data, err := bson.Marshal(project)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.projects = append(s.projects, memoryDoc{id: project.ID, userID: project.UserID, data: data})
+	return nil
+}
+
+// FindProjects returns every project owned by the user
+func (s *MemoryStore) FindProjects(ctx context.Context, userID primitive.ObjectID) ([]models.Project, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return findAll[models.Project](s.projects, func(doc memoryDoc) bool { return doc.userID == userID })
+}
+
+// FindProject returns a single project owned by the user
+func (s *MemoryStore) FindProject(ctx context.Context, id, userID primitive.ObjectID) (models.Project, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var project models.Project
+	err := find(s.projects, &project, func(doc memoryDoc) bool { return doc.id == id && doc.userID == userID })
+	return project, err
+}
+
+// ReplaceProject overwrites a stored project with the given one
+func (s *MemoryStore) ReplaceProject(ctx context.Context, project models.Project) error {
+	data, err := bson.Marshal(project)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, doc := range s.projects {
+		if doc.id == project.ID && doc.userID == project.UserID {
+			s.projects[i].data = data
+			return nil
+		}
+	}
+	return services.ErrNotFound
+}
+
+// DeleteProject removes a project owned by the user
+func (s *MemoryStore) DeleteProject(ctx context.Context, id, userID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, doc := range s.projects {
+		if doc.id == id && doc.userID == userID {
+			s.projects = append(s.projects[:i], s.projects[i+1:]...)
+			return nil
+		}
+	}
+	return services.ErrNotFound
+}
+
+// InsertView stores a new saved view
+func (s *MemoryStore) InsertView(ctx context.Context, view models.SavedView) error {
+	data, err := bson.Marshal(view)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.views = append(s.views, memoryDoc{id: view.ID, userID: view.UserID, data: data})
+	return nil
+}
+
+// FindViews returns every saved view owned by the user
+func (s *MemoryStore) FindViews(ctx context.Context, userID primitive.ObjectID) ([]models.SavedView, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return findAll[models.SavedView](s.views, func(doc memoryDoc) bool { return doc.userID == userID })
+}
+
+// FindView returns a single saved view owned by the user
+func (s *MemoryStore) FindView(ctx context.Context, id, userID primitive.ObjectID) (models.SavedView, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var view models.SavedView
+	err := find(s.views, &view, func(doc memoryDoc) bool { return doc.id == id && doc.userID == userID })
+	return view, err
+}
+
+// ReplaceView overwrites a stored view with the given one
+func (s *MemoryStore) ReplaceView(ctx context.Context, view models.SavedView) error {
+	data, err := bson.Marshal(view)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, doc := range s.views {
+		if doc.id == view.ID && doc.userID == view.UserID {
+			s.views[i].data = data
+			return nil
+		}
+	}
+	return services.ErrNotFound
+}
+
+// DeleteView removes a saved view owned by the user
+func (s *MemoryStore) DeleteView(ctx context.Context, id, userID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, doc := range s.views {
+		if doc.id == id && doc.userID == userID {
+			s.views = append(s.views[:i], s.views[i+1:]...)
+			return nil
+		}
+	}
+	return services.ErrNotFound
+}
+
+// InsertEvent stores a new event in the history of a todo
+func (s *MemoryStore) InsertEvent(ctx context.Context, event models.TodoEvent) error {
+	data, err := bson.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, memoryDoc{id: event.ID, userID: event.UserID, key: event.TodoID.Hex(), data: data})
+	return nil
+}
+
+// FindEvents returns the history of a todo owned by the user, oldest first
+func (s *MemoryStore) FindEvents(ctx context.Context, todoID, userID primitive.ObjectID) ([]models.TodoEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := todoID.Hex()
+	return findAll[models.TodoEvent](s.events, func(doc memoryDoc) bool { return doc.key == key && doc.userID == userID })
+}
+
+// InsertOperation logs a new operation
+func (s *MemoryStore) InsertOperation(ctx context.Context, op models.Operation) error {
+	data, err := bson.Marshal(op)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.operations = append(s.operations, memoryDoc{id: op.ID, userID: op.UserID, data: data})
+	return nil
+}
+
+// FindOperations returns the logged operations of the user, oldest first
+func (s *MemoryStore) FindOperations(ctx context.Context, userID primitive.ObjectID) ([]models.Operation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return findAll[models.Operation](s.operations, func(doc memoryDoc) bool { return doc.userID == userID })
+}
+
+// ReplaceOperation overwrites a logged operation with the given one
+func (s *MemoryStore) ReplaceOperation(ctx context.Context, op models.Operation) error {
+	data, err := bson.Marshal(op)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, doc := range s.operations {
+		if doc.id == op.ID && doc.userID == op.UserID {
+			s.operations[i].data = data
+			return nil
+		}
+	}
+	return services.ErrNotFound
+}
+
+// DeleteOperation removes a logged operation of the user
+func (s *MemoryStore) DeleteOperation(ctx context.Context, id, userID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, doc := range s.operations {
+		if doc.id == id && doc.userID == userID {
+			s.operations = append(s.operations[:i], s.operations[i+1:]...)
+			return nil
+		}
+	}
+	return services.ErrNotFound
+}
+
+// InsertUser stores a new user
+func (s *MemoryStore) InsertUser(ctx context.Context, user models.User) error {
+	data, err := bson.Marshal(user)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, doc := range s.users {
+		if doc.key == user.Username {
+			return services.ErrUsernameTaken
+		}
+	}
+	s.users = append(s.users, memoryDoc{id: user.ID, key: user.Username, data: data})
+	return nil
+}
+
+// FindUserByID returns the user with the given ID
+func (s *MemoryStore) FindUserByID(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var user models.User
+	err := find(s.users, &user, func(doc memoryDoc) bool { return doc.id == id })
+	return user, err
+}
+
+// FindUserByUsername returns the user with the given username
+func (s *MemoryStore) FindUserByUsername(ctx context.Context, username string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var user models.User
+	err := find(s.users, &user, func(doc memoryDoc) bool { return doc.key == username })
+	return user, err
+}
+
+// InsertToken stores the session of a login
+func (s *MemoryStore) InsertToken(ctx context.Context, token models.Token) error {
+	data, err := bson.Marshal(token)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens = append(s.tokens, memoryDoc{key: token.ID, owner: token.UserID, data: data})
+	return nil
+}
+
+// FindToken returns the session with the given ID
+func (s *MemoryStore) FindToken(ctx context.Context, id string) (models.Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var token models.Token
+	err := find(s.tokens, &token, func(doc memoryDoc) bool { return doc.key == id })
+	return token, err
+}
+
+// RotateToken replaces a session whose refresh token is still the one hashed as refreshHash
+func (s *MemoryStore) RotateToken(ctx context.Context, token models.Token, refreshHash string) error {
+	data, err := bson.Marshal(token)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, doc := range s.tokens {
+		if doc.key != token.ID {
+			continue
+		}
+		var current models.Token
+		if err := bson.Unmarshal(doc.data, &current); err != nil {
+			return err
+		}
+		if current.RefreshHash != refreshHash {
+			break
+		}
+		s.tokens[i].data = data
+		return nil
+	}
+	return services.ErrNotFound
+}
+
+// FindTokens returns the sessions of the user
+func (s *MemoryStore) FindTokens(ctx context.Context, userID string) ([]models.Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return findAll[models.Token](s.tokens, func(doc memoryDoc) bool { return doc.owner == userID })
+}
+
+// DeleteTokens removes the sessions of the user
+func (s *MemoryStore) DeleteTokens(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.tokens[:0]
+	for _, doc := range s.tokens {
+		if doc.owner != userID {
+			kept = append(kept, doc)
+		}
+	}
+	s.tokens = kept
+	return nil
+}
+
+// DeleteToken removes a session
+func (s *MemoryStore) DeleteToken(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, doc := range s.tokens {
+		if doc.key == id {
+			s.tokens = append(s.tokens[:i], s.tokens[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+// InsertAccessToken stores a new personal access token
+func (s *MemoryStore) InsertAccessToken(ctx context.Context, token models.AccessToken) error {
+	data, err := bson.Marshal(token)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.accessTokens = append(s.accessTokens, memoryDoc{id: token.ID, userID: token.UserID, data: data})
+	return nil
+}
+
+// FindAccessToken returns the personal access token with the given ID
+func (s *MemoryStore) FindAccessToken(ctx context.Context, id primitive.ObjectID) (models.AccessToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var token models.AccessToken
+	err := find(s.accessTokens, &token, func(doc memoryDoc) bool { return doc.id == id })
+	return token, err
+}
+
+// FindAccessTokens returns the personal access tokens of the user
+func (s *MemoryStore) FindAccessTokens(ctx context.Context, userID primitive.ObjectID) ([]models.AccessToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return findAll[models.AccessToken](s.accessTokens, func(doc memoryDoc) bool { return doc.userID == userID })
+}
+
+// ReplaceAccessToken overwrites a stored personal access token with the given one
+func (s *MemoryStore) ReplaceAccessToken(ctx context.Context, token models.AccessToken) error {
+	data, err := bson.Marshal(token)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, doc := range s.accessTokens {
+		if doc.id == token.ID && doc.userID == token.UserID {
+			s.accessTokens[i].data = data
+			return nil
+		}
+	}
+	return services.ErrNotFound
+}
+
+// DeleteAccessToken removes a personal access token of the user
+func (s *MemoryStore) DeleteAccessToken(ctx context.Context, id, userID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, doc := range s.accessTokens {
+		if doc.id == id && doc.userID == userID {
+			s.accessTokens = append(s.accessTokens[:i], s.accessTokens[i+1:]...)
+			return nil
+		}
+	}
+	return services.ErrNotFound
+}
@@ -0,0 +1,811 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"todo-cli/models"
+	"todo-cli/services"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore implements the todo, project, view, event, operation, user and token stores on top of MongoDB
+type MongoStore struct {
+	client   *mongo.Client
+	database *mongo.Database
+	session  mongo.Session // the session of a store handed out by InTransaction
+}
+
+var (
+	_ services.TodoStore      = (*MongoStore)(nil)
+	_ services.ProjectStore   = (*MongoStore)(nil)
+	_ services.ViewStore      = (*MongoStore)(nil)
+	_ services.EventStore     = (*MongoStore)(nil)
+	_ services.OperationStore = (*MongoStore)(nil)
+	_ services.UserStore      = (*MongoStore)(nil)
+	_ services.TokenStore     = (*MongoStore)(nil)
+	_ services.Transactor     = (*MongoStore)(nil)
+)
+
+// NewMongoStore returns a store backed by the given database of a connected client
+func NewMongoStore(client *mongo.Client, databaseName string) *MongoStore {
+	return &MongoStore{client: client, database: client.Database(databaseName)}
+}
+
+// EnsureIndexes creates the indexes the queries of the store rely on
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.todos().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "title", Value: "text"}, {Key: "notes", Value: "text"}},
+		Options: options.Index().SetName("todos_text").SetWeights(bson.M{"title": 3, "notes": 1}),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.events().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "todo_id", Value: 1}, {Key: "at", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	// InsertUser relies on it to turn a second registration into ErrUsernameTaken
+	_, err = s.users().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "username", Value: 1}},
+		Options: options.Index().SetName("users_username").SetUnique(true),
+	})
+	return err
+}
+
+// Stores returns the store wired into every slot of services.Stores
+func (s *MongoStore) Stores() services.Stores {
+	return services.Stores{Todos: s, Projects: s, Views: s, Events: s, Operations: s, Users: s, Tokens: s, Transactions: s}
+}
+
+// InTransaction runs fn on a store whose operations all belong to one
+// transaction. MongoDB only has transactions on replica sets and sharded
+// clusters, on a standalone server it returns services.ErrNoTransactions.
+func (s *MongoStore) InTransaction(ctx context.Context, fn func(ctx context.Context, stores services.Stores) error) error {
+	if s.session != nil {
+		return fn(ctx, s.Stores())
+	}
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := s.database.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return err
+	}
+	if hello.SetName == "" && hello.Msg != "isdbgrid" {
+		return services.ErrNoTransactions
+	}
+
+	session, err := s.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	tx := &MongoStore{client: s.client, database: s.database, session: session}
+	_, err = session.WithTransaction(ctx, func(ctx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(ctx, tx.Stores())
+	})
+	return err
+}
+
+// inSession binds ctx to the session of a store handed out by
+// InTransaction, so the operations run with it belong to its transaction
+func (s *MongoStore) inSession(ctx context.Context) context.Context {
+	if s.session == nil {
+		return ctx
+	}
+	return mongo.NewSessionContext(ctx, s.session)
+}
+
+// Close disconnects the underlying client
+func (s *MongoStore) Close() error {
+	return s.client.Disconnect(context.Background())
+}
+
+func (s *MongoStore) todos() *mongo.Collection        { return s.database.Collection("todos") }
+func (s *MongoStore) projects() *mongo.Collection     { return s.database.Collection("projects") }
+func (s *MongoStore) views() *mongo.Collection        { return s.database.Collection("views") }
+func (s *MongoStore) events() *mongo.Collection       { return s.database.Collection("todo_events") }
+func (s *MongoStore) operations() *mongo.Collection   { return s.database.Collection("operations") }
+func (s *MongoStore) users() *mongo.Collection        { return s.database.Collection("users") }
+func (s *MongoStore) tokens() *mongo.Collection       { return s.database.Collection("tokens") }
+func (s *MongoStore) accessTokens() *mongo.Collection { return s.database.Collection("access_tokens") }
+
+// notFound maps the driver's empty result error onto services.ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return services.ErrNotFound
+	}
+	return err
+}
+
+// InsertTodo stores a new todo
+func (s *MongoStore) InsertTodo(ctx context.Context, todo models.Todo) error {
+	ctx = s.inSession(ctx)
+	_, err := s.todos().InsertOne(ctx, todo)
+	return err
+}
+
+// FindTodos returns the todos of the user passing the query. Sorted
+// queries run as an aggregation, which can sort missing values last and
+// titles without regard to case.
+func (s *MongoStore) FindTodos(ctx context.Context, userID primitive.ObjectID, query services.TodoQuery) ([]models.Todo, error) {
+	ctx = s.inSession(ctx)
+	filter := todoQueryFilter(query)
+	filter["user_id"] = userID
+
+	var cursor *mongo.Cursor
+	var err error
+	if query.Ordered() {
+		cursor, err = s.todos().Aggregate(ctx, todoSortPipeline(filter, query))
+	} else {
+		opts := options.Find()
+		if query.Limit > 0 {
+			opts.SetLimit(int64(query.Limit))
+		}
+		cursor, err = s.todos().Find(ctx, filter, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var todos []models.Todo
+	err = cursor.All(ctx, &todos)
+	return todos, err
+}
+
+// todoSortPipeline returns the aggregation sorting the todos passing filter
+// the way TodoSort.Less does, after query.After and up to query.Limit
+func todoSortPipeline(filter bson.M, query services.TodoQuery) mongo.Pipeline {
+	keys := append(append(services.TodoSort{}, query.Sort...), services.SortKey{Field: "created_at"}, services.SortKey{Field: "_id"})
+
+	// Every key is copied into _sN and whether it is missing into _mN
+	computed := bson.D{}
+	sortBy := bson.D{}
+	var alternatives, equal bson.A
+	for i, key := range keys {
+		value, missing := fmt.Sprintf("_s%d", i), fmt.Sprintf("_m%d", i)
+		computed = append(computed,
+			bson.E{Key: value, Value: todoSortExpr(key.Field, "$"+key.Field)},
+			bson.E{Key: missing, Value: bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$" + key.Field, nil}}, nil}}, 1, 0}}},
+		)
+		direction := 1
+		if key.Desc {
+			direction = -1
+		}
+		sortBy = append(sortBy, bson.E{Key: missing, Value: 1}, bson.E{Key: value, Value: direction})
+
+		if query.After == nil {
+			continue
+		}
+		// A todo follows the one the page resumes after on the first key they differ on
+		last, ok := todoSortValue(key.Field, *query.After)
+		if !ok {
+			// Nothing without a value follows a todo without one, only ties go on
+			equal = append(equal, bson.M{"$eq": bson.A{"$" + missing, 1}})
+			continue
+		}
+		lastExpr := todoSortExpr(key.Field, bson.M{"$literal": last})
+		comparison := "$gt"
+		if key.Desc {
+			comparison = "$lt"
+		}
+		follows := bson.M{"$or": bson.A{
+			bson.M{"$eq": bson.A{"$" + missing, 1}},
+			bson.M{comparison: bson.A{"$" + value, lastExpr}},
+		}}
+		alternatives = append(alternatives, bson.M{"$and": append(append(bson.A{}, equal...), follows)})
+		equal = append(equal, bson.M{"$and": bson.A{
+			bson.M{"$eq": bson.A{"$" + missing, 0}},
+			bson.M{"$eq": bson.A{"$" + value, lastExpr}},
+		}})
+	}
+
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: filter}}, {{Key: "$addFields", Value: computed}}}
+	if query.After != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"$expr": bson.M{"$or": alternatives}}}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$sort", Value: sortBy}})
+	if query.Limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: query.Limit}})
+	}
+	hidden := bson.M{}
+	for i := range keys {
+		hidden[fmt.Sprintf("_s%d", i)] = 0
+		hidden[fmt.Sprintf("_m%d", i)] = 0
+	}
+	return append(pipeline, bson.D{{Key: "$project", Value: hidden}})
+}
+
+// todoSortExpr returns what a todo is sorted by for a field, given the
+// field or a value of it
+func todoSortExpr(field string, value interface{}) interface{} {
+	if field == "title" {
+		return bson.M{"$toLower": value}
+	}
+	return value
+}
+
+// todoSortValue returns the value of the sort field of a todo, false when
+// it is not set
+func todoSortValue(field string, todo models.Todo) (interface{}, bool) {
+	optional := func(t *time.Time) (interface{}, bool) {
+		if t == nil {
+			return nil, false
+		}
+		return *t, true
+	}
+	switch field {
+	case "title":
+		return todo.Title, true
+	case "completed":
+		return todo.Completed, true
+	case "priority":
+		return todo.Priority, true
+	case "position":
+		return todo.Position, true
+	case "created_at":
+		return todo.CreatedAt, true
+	case "updated_at":
+		return todo.UpdatedAt, true
+	case "start_at":
+		return optional(todo.StartAt)
+	case "due_at":
+		return optional(todo.DueAt)
+	case "completed_at":
+		return optional(todo.CompletedAt)
+	case "archived_at":
+		return optional(todo.ArchivedAt)
+	case "_id":
+		return todo.ID, true
+	}
+	return nil, false
+}
+
+// ScanTodos decodes the todos owned by the user one at a time
+func (s *MongoStore) ScanTodos(ctx context.Context, userID primitive.ObjectID, fn func(models.Todo) error) error {
+	ctx = s.inSession(ctx)
+	cursor, err := s.todos().Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var todo models.Todo
+		if err := cursor.Decode(&todo); err != nil {
+			return err
+		}
+		if err := fn(todo); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// SearchTodos ranks the todos of the user passing the query matching any of
+// the terms with the text index on title and notes
+func (s *MongoStore) SearchTodos(ctx context.Context, userID primitive.ObjectID, terms []string, query services.TodoQuery, limit int) ([]services.TodoMatch, error) {
+	ctx = s.inSession(ctx)
+	score := bson.M{"$meta": "textScore"}
+	opts := options.Find().
+		SetProjection(bson.M{"score": score}).
+		SetSort(bson.M{"score": score}).
+		SetLimit(int64(limit))
+	filter := todoQueryFilter(query)
+	filter["user_id"] = userID
+	filter["$text"] = bson.M{"$search": strings.Join(terms, " ")}
+	cursor, err := s.todos().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var matches []services.TodoMatch
+	for cursor.Next(ctx) {
+		var found struct {
+			models.Todo `bson:",inline"`
+			Score       float64 `bson:"score"`
+		}
+		if err := cursor.Decode(&found); err != nil {
+			return nil, err
+		}
+		matches = append(matches, services.TodoMatch{Todo: found.Todo, Score: found.Score})
+	}
+	return matches, cursor.Err()
+}
+
+// todoQueryFilter returns the conditions of a query as a filter, a todo
+// leaves a time unset by leaving out its field
+func todoQueryFilter(query services.TodoQuery) bson.M {
+	filter := bson.M{}
+	if query.Trashed != nil {
+		filter["deleted_at"] = isSetFilter(*query.Trashed)
+	}
+	if query.Archived != nil {
+		filter["archived_at"] = isSetFilter(*query.Archived)
+	}
+	if query.Completed != nil {
+		filter["completed"] = *query.Completed
+	}
+	if query.Inbox {
+		filter["project_id"] = nil
+	}
+	if query.Project != nil {
+		filter["project_id"] = *query.Project
+	}
+	if len(query.Tags) > 0 {
+		filter["tags"] = bson.M{"$all": query.Tags}
+	}
+	if query.Parents != nil {
+		filter["parent_id"] = bson.M{"$in": query.Parents}
+	}
+	if query.Series != nil {
+		filter["series_id"] = *query.Series
+	}
+	for field, bounds := range map[string]services.TimeRange{"created_at": query.Created, "updated_at": query.Updated} {
+		condition := bson.M{}
+		if bounds.After != nil {
+			condition["$gte"] = *bounds.After
+		}
+		if bounds.Before != nil {
+			condition["$lt"] = *bounds.Before
+		}
+		if len(condition) > 0 {
+			filter[field] = condition
+		}
+	}
+	return filter
+}
+
+// isSetFilter matches an optional field that is set, or unset when set is false
+func isSetFilter(set bool) interface{} {
+	if set {
+		return bson.M{"$ne": nil}
+	}
+	return nil
+}
+
+// FindTodo returns a single todo owned by the user
+func (s *MongoStore) FindTodo(ctx context.Context, id, userID primitive.ObjectID) (models.Todo, error) {
+	ctx = s.inSession(ctx)
+	var todo models.Todo
+	err := s.todos().FindOne(ctx, bson.M{"_id": id, "user_id": userID}).Decode(&todo)
+	return todo, notFound(err)
+}
+
+// ReplaceTodo overwrites a stored todo with the given one, as long as the
+// stored one is still at version
+func (s *MongoStore) ReplaceTodo(ctx context.Context, todo models.Todo, version int64) error {
+	ctx = s.inSession(ctx)
+	atVersion := interface{}(version)
+	if version == 0 {
+		// Todos stored before they had versions have none
+		atVersion = bson.M{"$in": bson.A{0, nil}}
+	}
+	result, err := s.todos().ReplaceOne(ctx, bson.M{"_id": todo.ID, "user_id": todo.UserID, "version": atVersion}, todo)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+	current, err := s.FindTodo(ctx, todo.ID, todo.UserID)
+	if err != nil {
+		return err
+	}
+	return &services.VersionMismatchError{Expected: version, Current: current.Version}
+}
+
+// DeleteTodo removes a todo owned by the user
+func (s *MongoStore) DeleteTodo(ctx context.Context, id, userID primitive.ObjectID) error {
+	ctx = s.inSession(ctx)
+	result, err := s.todos().DeleteOne(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return services.ErrNotFound
+	}
+	return nil
+}
+
+// PurgeTodos deletes the todos of every user moved to the trash before the given time
+func (s *MongoStore) PurgeTodos(ctx context.Context, before time.Time) ([]models.Todo, error) {
+	ctx = s.inSession(ctx)
+	cursor, err := s.todos().Find(ctx, bson.M{"deleted_at": bson.M{"$lt": before}})
+	if err != nil {
+		return nil, err
+	}
+	var expired []models.Todo
+	if err := cursor.All(ctx, &expired); err != nil {
+		return nil, err
+	}
+	var purged []models.Todo
+	for _, todo := range expired {
+		// A todo restored meanwhile stays
+		result, err := s.todos().DeleteOne(ctx, bson.M{"_id": todo.ID, "deleted_at": bson.M{"$lt": before}})
+		if err != nil {
+			return purged, err
+		}
+		if result.DeletedCount == 1 {
+			purged = append(purged, todo)
+		}
+	}
+	return purged, nil
+}
+
+// ArchiveTodos archives the todos of every user completed before the given time
+func (s *MongoStore) ArchiveTodos(ctx context.Context, completedBefore, archivedAt time.Time) ([]models.Todo, error) {
+	ctx = s.inSession(ctx)
+	due := bson.M{
+		"completed":   true,
+		"archived_at": bson.M{"$exists": false},
+		"deleted_at":  bson.M{"$exists": false},
+		// Todos completed before completed_at was recorded go by their last update
+		"$or": bson.A{
+			bson.M{"completed_at": bson.M{"$lt": completedBefore}},
+			bson.M{"completed_at": bson.M{"$exists": false}, "updated_at": bson.M{"$lt": completedBefore}},
+		},
+	}
+	cursor, err := s.todos().Find(ctx, due)
+	if err != nil {
+		return nil, err
+	}
+	var found []models.Todo
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	var archived []models.Todo
+	for _, todo := range found {
+		// A todo reopened, trashed or archived meanwhile stays as it is
+		filter := bson.M{"_id": todo.ID}
+		for key, value := range due {
+			filter[key] = value
+		}
+		result, err := s.todos().UpdateOne(ctx, filter, bson.M{
+			"$set": bson.M{"archived_at": archivedAt},
+			"$inc": bson.M{"version": 1},
+		})
+		if err != nil {
+			return archived, err
+		}
+		if result.ModifiedCount == 1 {
+			archived = append(archived, todo)
+		}
+	}
+	return archived, nil
+}
+
+// InsertProject stores a new project
+func (s *MongoStore) InsertProject(ctx context.Context, project models.Project) error {
+	ctx = s.inSession(ctx)
+	_, err := s.projects().InsertOne(ctx, project)
+	return err
+}
+
+// FindProjects returns every project owned by the user
+func (s *MongoStore) FindProjects(ctx context.Context, userID primitive.ObjectID) ([]models.Project, error) {
+	ctx = s.inSession(ctx)
+	cursor, err := s.projects().Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var projects []models.Project
+	if err := cursor.All(ctx, &projects); err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
+
+// FindProject returns a single project owned by the user
+func (s *MongoStore) FindProject(ctx context.Context, id, userID primitive.ObjectID) (models.Project, error) {
+	ctx = s.inSession(ctx)
+	var project models.Project
+	err := s.projects().FindOne(ctx, bson.M{"_id": id, "user_id": userID}).Decode(&project)
+	return project, notFound(err)
+}
+
+// ReplaceProject overwrites a stored project with the given one
+func (s *MongoStore) ReplaceProject(ctx context.Context, project models.Project) error {
+	ctx = s.inSession(ctx)
+	result, err := s.projects().ReplaceOne(ctx, bson.M{"_id": project.ID, "user_id": project.UserID}, project)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return services.ErrNotFound
+	}
+	return nil
+}
+
+// DeleteProject removes a project owned by the user
+func (s *MongoStore) DeleteProject(ctx context.Context, id, userID primitive.ObjectID) error {
+	ctx = s.inSession(ctx)
+	result, err := s.projects().DeleteOne(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return services.ErrNotFound
+	}
+	return nil
+}
+
+// InsertView stores a new saved view
+func (s *MongoStore) InsertView(ctx context.Context, view models.SavedView) error {
+	ctx = s.inSession(ctx)
+	_, err := s.views().InsertOne(ctx, view)
+	return err
+}
+
+// FindViews returns every saved view owned by the user
+func (s *MongoStore) FindViews(ctx context.Context, userID primitive.ObjectID) ([]models.SavedView, error) {
+	ctx = s.inSession(ctx)
+	cursor, err := s.views().Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var views []models.SavedView
+	if err := cursor.All(ctx, &views); err != nil {
+		return nil, err
+	}
+	return views, nil
+}
+
+// FindView returns a single saved view owned by the user
+func (s *MongoStore) FindView(ctx context.Context, id, userID primitive.ObjectID) (models.SavedView, error) {
+	ctx = s.inSession(ctx)
+	var view models.SavedView
+	err := s.views().FindOne(ctx, bson.M{"_id": id, "user_id": userID}).Decode(&view)
+	return view, notFound(err)
+}
+
+// ReplaceView overwrites a stored view with the given one
+func (s *MongoStore) ReplaceView(ctx context.Context, view models.SavedView) error {
+	ctx = s.inSession(ctx)
+	result, err := s.views().ReplaceOne(ctx, bson.M{"_id": view.ID, "user_id": view.UserID}, view)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return services.ErrNotFound
+	}
+	return nil
+}
+
+// DeleteView removes a saved view owned by the user
+func (s *MongoStore) DeleteView(ctx context.Context, id, userID primitive.ObjectID) error {
+	ctx = s.inSession(ctx)
+	result, err := s.views().DeleteOne(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return services.ErrNotFound
+	}
+	return nil
+}
+
+// InsertEvent stores a new event in the history of a todo
+func (s *MongoStore) InsertEvent(ctx context.Context, event models.TodoEvent) error {
+	ctx = s.inSession(ctx)
+	_, err := s.events().InsertOne(ctx, event)
+	return err
+}
+
+// FindEvents returns the history of a todo owned by the user, oldest first
+func (s *MongoStore) FindEvents(ctx context.Context, todoID, userID primitive.ObjectID) ([]models.TodoEvent, error) {
+	ctx = s.inSession(ctx)
+	cursor, err := s.events().Find(ctx, bson.M{"todo_id": todoID, "user_id": userID},
+		options.Find().SetSort(bson.D{{Key: "at", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var events []models.TodoEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// InsertOperation logs a new operation
+func (s *MongoStore) InsertOperation(ctx context.Context, op models.Operation) error {
+	ctx = s.inSession(ctx)
+	_, err := s.operations().InsertOne(ctx, op)
+	return err
+}
+
+// FindOperations returns the logged operations of the user, oldest first
+func (s *MongoStore) FindOperations(ctx context.Context, userID primitive.ObjectID) ([]models.Operation, error) {
+	ctx = s.inSession(ctx)
+	cursor, err := s.operations().Find(ctx, bson.M{"user_id": userID},
+		options.Find().SetSort(bson.D{{Key: "at", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var ops []models.Operation
+	if err := cursor.All(ctx, &ops); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// ReplaceOperation overwrites a logged operation with the given one
+func (s *MongoStore) ReplaceOperation(ctx context.Context, op models.Operation) error {
+	ctx = s.inSession(ctx)
+	result, err := s.operations().ReplaceOne(ctx, bson.M{"_id": op.ID, "user_id": op.UserID}, op)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return services.ErrNotFound
+	}
+	return nil
+}
+
+// DeleteOperation removes a logged operation of the user
+func (s *MongoStore) DeleteOperation(ctx context.Context, id, userID primitive.ObjectID) error {
+	ctx = s.inSession(ctx)
+	result, err := s.operations().DeleteOne(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return services.ErrNotFound
+	}
+	return nil
+}
+
+// InsertUser stores a new user
+func (s *MongoStore) InsertUser(ctx context.Context, user models.User) error {
+	ctx = s.inSession(ctx)
+	_, err := s.users().InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return services.ErrUsernameTaken
+	}
+	return err
+}
+
+// FindUserByID returns the user with the given ID
+func (s *MongoStore) FindUserByID(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	ctx = s.inSession(ctx)
+	var user models.User
+	err := s.users().FindOne(ctx, bson.M{"_id": id}).Decode(&user)
+	return user, notFound(err)
+}
+
+// FindUserByUsername returns the user with the given username
+func (s *MongoStore) FindUserByUsername(ctx context.Context, username string) (models.User, error) {
+	ctx = s.inSession(ctx)
+	var user models.User
+	err := s.users().FindOne(ctx, bson.M{"username": username}).Decode(&user)
+	return user, notFound(err)
+}
+
+// InsertToken stores the session of a login
+func (s *MongoStore) InsertToken(ctx context.Context, token models.Token) error {
+	ctx = s.inSession(ctx)
+	_, err := s.tokens().InsertOne(ctx, token)
+	return err
+}
+
+// FindToken returns the session with the given ID
+func (s *MongoStore) FindToken(ctx context.Context, id string) (models.Token, error) {
+	ctx = s.inSession(ctx)
+	var token models.Token
+	err := s.tokens().FindOne(ctx, bson.M{"token": id}).Decode(&token)
+	return token, notFound(err)
+}
+
+// RotateToken replaces a session whose refresh token is still the one hashed as refreshHash
+func (s *MongoStore) RotateToken(ctx context.Context, token models.Token, refreshHash string) error {
+	ctx = s.inSession(ctx)
+	result, err := s.tokens().ReplaceOne(ctx, bson.M{"token": token.ID, "refresh_hash": refreshHash}, token)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return services.ErrNotFound
+	}
+	return nil
+}
+
+// FindTokens returns the sessions of the user
+func (s *MongoStore) FindTokens(ctx context.Context, userID string) ([]models.Token, error) {
+	ctx = s.inSession(ctx)
+	cursor, err := s.tokens().Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	var tokens []models.Token
+	err = cursor.All(ctx, &tokens)
+	return tokens, err
+}
+
+// DeleteTokens removes the sessions of the user
+func (s *MongoStore) DeleteTokens(ctx context.Context, userID string) error {
+	ctx = s.inSession(ctx)
+	_, err := s.tokens().DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// DeleteToken removes a session
+func (s *MongoStore) DeleteToken(ctx context.Context, id string) error {
+	ctx = s.inSession(ctx)
+	_, err := s.tokens().DeleteOne(ctx, bson.M{"token": id})
+	return err
+}
+
+// InsertAccessToken stores a new personal access token
+func (s *MongoStore) InsertAccessToken(ctx context.Context, token models.AccessToken) error {
+	ctx = s.inSession(ctx)
+	_, err := s.accessTokens().InsertOne(ctx, token)
+	return err
+}
+
+// FindAccessToken returns the personal access token with the given ID
+func (s *MongoStore) FindAccessToken(ctx context.Context, id primitive.ObjectID) (models.AccessToken, error) {
+	ctx = s.inSession(ctx)
+	var token models.AccessToken
+	err := s.accessTokens().FindOne(ctx, bson.M{"_id": id}).Decode(&token)
+	return token, notFound(err)
+}
+
+// FindAccessTokens returns the personal access tokens of the user
+func (s *MongoStore) FindAccessTokens(ctx context.Context, userID primitive.ObjectID) ([]models.AccessToken, error) {
+	ctx = s.inSession(ctx)
+	cursor, err := s.accessTokens().Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tokens []models.AccessToken
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// ReplaceAccessToken overwrites a stored personal access token with the given one
+func (s *MongoStore) ReplaceAccessToken(ctx context.Context, token models.AccessToken) error {
+	ctx = s.inSession(ctx)
+	result, err := s.accessTokens().ReplaceOne(ctx, bson.M{"_id": token.ID, "user_id": token.UserID}, token)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return services.ErrNotFound
+	}
+	return nil
+}
+
+// DeleteAccessToken removes a personal access token of the user
+func (s *MongoStore) DeleteAccessToken(ctx context.Context, id, userID primitive.ObjectID) error {
+	ctx = s.inSession(ctx)
+	result, err := s.accessTokens().DeleteOne(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return services.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"todo-cli/services"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Store is a storage backend implementing every store the services need
+type Store interface {
+	services.TodoStore
+	services.ProjectStore
+	services.ViewStore
+	services.UserStore
+	services.TokenStore
+
+	Stores() services.Stores
+	Close() error
+}
+
+// Open opens the storage backend selected by a storage URL:
+//
+//	mongodb://... or mongodb+srv://...  MongoDB, database from DATABASE_NAME
+//	sqlite://./todos.db                 embedded SQLite file
+//	memory://name                       in-memory store shared by everything in the process opening name
+func Open(storage string) (Store, error) {
+	switch {
+	case strings.HasPrefix(storage, "mongodb://"), strings.HasPrefix(storage, "mongodb+srv://"):
+		return openMongo(storage)
+	case strings.HasPrefix(storage, "sqlite://"):
+		return NewSQLiteStore(strings.TrimPrefix(storage, "sqlite://"))
+	case strings.HasPrefix(storage, "memory://"):
+		return namedMemoryStore(strings.TrimPrefix(storage, "memory://")), nil
+	case storage == "":
+		return nil, fmt.Errorf("no storage configured, set STORAGE or MONGODB_URI")
+	default:
+		return nil, fmt.Errorf("unsupported storage %q", storage)
+	}
+}
+
+func openMongo(uri string) (*MongoStore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %v", err)
+	}
+	// Ping the database to verify connection
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("failed to connect to MongoDB: %v", err)
+	}
+
+	databaseName := os.Getenv("DATABASE_NAME")
+	if databaseName == "" {
+		databaseName = "go-todo-db"
+	}
+	store := NewMongoStore(client, databaseName)
+	if err := store.EnsureIndexes(ctx); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("failed to create MongoDB indexes: %v", err)
+	}
+	return store, nil
+}
@@ -0,0 +1,1108 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"todo-cli/models"
+	"todo-cli/services"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"modernc.org/sqlite" // registers the pure Go "sqlite" driver
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLiteStore implements the todo, project, view, event, operation, user and token stores in a single SQLite file.
+// Documents are kept BSON encoded, exactly as they would be stored in MongoDB,
+// next to the columns needed to look them up.
+type SQLiteStore struct {
+	db *sql.DB
+	tx *sql.Tx // the transaction of a store handed out by InTransaction
+}
+
+var (
+	_ services.TodoStore      = (*SQLiteStore)(nil)
+	_ services.ProjectStore   = (*SQLiteStore)(nil)
+	_ services.ViewStore      = (*SQLiteStore)(nil)
+	_ services.EventStore     = (*SQLiteStore)(nil)
+	_ services.OperationStore = (*SQLiteStore)(nil)
+	_ services.UserStore      = (*SQLiteStore)(nil)
+	_ services.TokenStore     = (*SQLiteStore)(nil)
+	_ services.Transactor     = (*SQLiteStore)(nil)
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS users (
+	id       TEXT PRIMARY KEY,
+	username TEXT NOT NULL UNIQUE,
+	data     BLOB NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS todos (
+	id      TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	data    BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS todos_user_id ON todos (user_id);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS todos_fts USING fts5 (
+	title,
+	notes,
+	todo_id UNINDEXED,
+	user_id UNINDEXED,
+	tokenize = 'porter unicode61'
+);
+
+CREATE TABLE IF NOT EXISTS projects (
+	id      TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	data    BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS projects_user_id ON projects (user_id);
+
+CREATE TABLE IF NOT EXISTS views (
+	id      TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	data    BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS views_user_id ON views (user_id);
+
+CREATE TABLE IF NOT EXISTS todo_events (
+	id      TEXT PRIMARY KEY,
+	todo_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	data    BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS todo_events_todo_id ON todo_events (todo_id);
+
+CREATE TABLE IF NOT EXISTS operations (
+	id      TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	data    BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS operations_user_id ON operations (user_id);
+
+CREATE TABLE IF NOT EXISTS tokens (
+	token        TEXT PRIMARY KEY,
+	user_id      TEXT NOT NULL,
+	exp          INTEGER NOT NULL,
+	refresh_hash TEXT NOT NULL,
+	data         BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS tokens_user_id ON tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS access_tokens (
+	id      TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	data    BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS access_tokens_user_id ON access_tokens (user_id);
+`
+
+// NewSQLiteStore opens (creating if needed) the SQLite database at path
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	// WAL and a busy timeout let the server and the CLI use the file at the
+	// same time. Every transaction writes, so each takes the write lock as it
+	// begins and waits for it there, instead of failing when it needs it later.
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate", path)
+	conn, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Exec(sqliteSchema); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create sqlite schema: %v", err)
+	}
+	store := &SQLiteStore{db: conn}
+	if err := store.addTodoColumns(context.Background()); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to migrate the sqlite schema: %v", err)
+	}
+	if err := store.syncSearchIndex(context.Background()); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to build the sqlite search index: %v", err)
+	}
+	return store, nil
+}
+
+// syncSearchIndex rebuilds the full-text index of todos when it is out of
+// step with the todos table, e.g. for a database created before it existed
+func (s *SQLiteStore) syncSearchIndex(ctx context.Context) error {
+	var todos, indexed int
+	err := s.conn().QueryRowContext(ctx, "SELECT (SELECT count(*) FROM todos), (SELECT count(*) FROM todos_fts)").Scan(&todos, &indexed)
+	if err != nil || todos == indexed {
+		return err
+	}
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM todos_fts"); err != nil {
+		return err
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT data FROM todos")
+	if err != nil {
+		return err
+	}
+	var all []models.Todo
+	for rows.Next() {
+		var data []byte
+		var todo models.Todo
+		if err := rows.Scan(&data); err != nil {
+			rows.Close()
+			return err
+		}
+		if err := bson.Unmarshal(data, &todo); err != nil {
+			rows.Close()
+			return err
+		}
+		all = append(all, todo)
+	}
+	rows.Close()
+	for _, todo := range all {
+		if err := indexTodo(ctx, tx, todo); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// todoColumn is a field of todos copied into a column of its own next to the
+// document, for the statements that look at it
+type todoColumn struct {
+	name  string
+	decl  string // type and default in the schema
+	value func(models.Todo) interface{}
+}
+
+// todoColumns are added to the todos table of databases created before them
+var todoColumns = []todoColumn{
+	{"version", "INTEGER NOT NULL DEFAULT 0", func(todo models.Todo) interface{} { return todo.Version }},
+	{"deleted_at", "INTEGER", func(todo models.Todo) interface{} { return unixMillis(todo.DeletedAt) }},
+	{"archived_at", "INTEGER", func(todo models.Todo) interface{} { return unixMillis(todo.ArchivedAt) }},
+	// Titles sort without regard to case, as TodoSort does
+	{"title_key", "TEXT NOT NULL DEFAULT ''", func(todo models.Todo) interface{} { return strings.ToLower(todo.Title) }},
+	{"completed", "INTEGER NOT NULL DEFAULT 0", func(todo models.Todo) interface{} { return todo.Completed }},
+	{"priority", "INTEGER NOT NULL DEFAULT 0", func(todo models.Todo) interface{} { return int(todo.Priority) }},
+	{"position", "REAL NOT NULL DEFAULT 0", func(todo models.Todo) interface{} { return todo.Position }},
+	{"created_at", "INTEGER NOT NULL DEFAULT 0", func(todo models.Todo) interface{} { return unixMillis(&todo.CreatedAt) }},
+	{"updated_at", "INTEGER NOT NULL DEFAULT 0", func(todo models.Todo) interface{} { return unixMillis(&todo.UpdatedAt) }},
+	{"start_at", "INTEGER", func(todo models.Todo) interface{} { return unixMillis(todo.StartAt) }},
+	{"due_at", "INTEGER", func(todo models.Todo) interface{} { return unixMillis(todo.DueAt) }},
+	{"completed_at", "INTEGER", func(todo models.Todo) interface{} { return unixMillis(todo.CompletedAt) }},
+	{"project_id", "TEXT", func(todo models.Todo) interface{} { return hexOrNull(todo.ProjectID) }},
+	{"parent_id", "TEXT", func(todo models.Todo) interface{} { return hexOrNull(todo.ParentID) }},
+	{"series_id", "TEXT", func(todo models.Todo) interface{} { return hexOrNull(todo.SeriesID) }},
+	// A JSON array, looked into with json_each
+	{"tags", "TEXT", func(todo models.Todo) interface{} {
+		if len(todo.Tags) == 0 {
+			return nil
+		}
+		tags, _ := json.Marshal(todo.Tags)
+		return string(tags)
+	}},
+}
+
+// todoSortColumns are the columns the fields of a TodoSort are sorted by,
+// when they are not named like the field
+var todoSortColumns = map[string]string{"title": "title_key"}
+
+// todoColumnValue returns the value of the named todoColumn of a todo
+func todoColumnValue(name string, todo models.Todo) interface{} {
+	for _, column := range todoColumns {
+		if column.name == name {
+			return column.value(todo)
+		}
+	}
+	panic("unknown todo column " + name)
+}
+
+// hexOrNull returns an optional ID in hex, NULL when it is not set
+func hexOrNull(id *primitive.ObjectID) interface{} {
+	if id == nil {
+		return nil
+	}
+	return id.Hex()
+}
+
+// unixMillis returns an optional time as the milliseconds since 1970 BSON
+// keeps, NULL when it is not set
+func unixMillis(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UnixMilli()
+}
+
+// todoQueryWhere returns the conditions of a query on the todos table for a
+// WHERE clause, "1" without any, and their arguments
+func todoQueryWhere(query services.TodoQuery) (string, []interface{}) {
+	conditions := []string{"1"}
+	var args []interface{}
+	if query.Trashed != nil {
+		conditions = append(conditions, isSetCondition("todos.deleted_at", *query.Trashed))
+	}
+	if query.Archived != nil {
+		conditions = append(conditions, isSetCondition("todos.archived_at", *query.Archived))
+	}
+	if query.Completed != nil {
+		conditions = append(conditions, "todos.completed = ?")
+		args = append(args, *query.Completed)
+	}
+	if query.Inbox {
+		conditions = append(conditions, "todos.project_id IS NULL")
+	}
+	if query.Project != nil {
+		conditions = append(conditions, "todos.project_id = ?")
+		args = append(args, query.Project.Hex())
+	}
+	for _, tag := range query.Tags {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM json_each(todos.tags) WHERE json_each.value = ?)")
+		args = append(args, tag)
+	}
+	if query.Parents != nil {
+		placeholders := make([]string, len(query.Parents))
+		for i, parent := range query.Parents {
+			placeholders[i] = "?"
+			args = append(args, parent.Hex())
+		}
+		conditions = append(conditions, "todos.parent_id IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if query.Series != nil {
+		conditions = append(conditions, "todos.series_id = ?")
+		args = append(args, query.Series.Hex())
+	}
+	for column, bounds := range map[string]services.TimeRange{"created_at": query.Created, "updated_at": query.Updated} {
+		if bounds.After != nil {
+			conditions = append(conditions, "todos."+column+" >= ?")
+			args = append(args, bounds.After.UnixMilli())
+		}
+		if bounds.Before != nil {
+			conditions = append(conditions, "todos."+column+" < ?")
+			args = append(args, bounds.Before.UnixMilli())
+		}
+	}
+	if query.After != nil {
+		after, afterArgs := todoAfterCondition(query.Sort, *query.After)
+		conditions = append(conditions, after)
+		args = append(args, afterArgs...)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// todoSortKeys returns the columns a sort orders todos by, ties broken by
+// creation time and ID as TodoSort.Less does
+func todoSortKeys(order services.TodoSort) []services.SortKey {
+	keys := make([]services.SortKey, 0, len(order)+2)
+	for _, key := range order {
+		if column, ok := todoSortColumns[key.Field]; ok {
+			key.Field = column
+		}
+		keys = append(keys, key)
+	}
+	return append(keys, services.SortKey{Field: "created_at"}, services.SortKey{Field: "id"})
+}
+
+// todoOrderBy returns the ORDER BY clause of a sort. Todos without a value
+// come last whatever the direction.
+func todoOrderBy(order services.TodoSort) string {
+	var terms []string
+	for _, key := range todoSortKeys(order) {
+		direction := "ASC"
+		if key.Desc {
+			direction = "DESC"
+		}
+		terms = append(terms, fmt.Sprintf("todos.%s IS NULL, todos.%s %s", key.Field, key.Field, direction))
+	}
+	return strings.Join(terms, ", ")
+}
+
+// todoAfterCondition returns the condition for the todos sorted after the
+// given one: a todo follows it on the first sort key they differ on
+func todoAfterCondition(order services.TodoSort, after models.Todo) (string, []interface{}) {
+	var alternatives, equal []string
+	var args, equalArgs []interface{}
+	for _, key := range todoSortKeys(order) {
+		column := "todos." + key.Field
+		var value interface{}
+		if key.Field == "id" {
+			value = after.ID.Hex()
+		} else {
+			value = todoColumnValue(key.Field, after)
+		}
+		if value == nil {
+			// Nothing without a value follows a todo without one, only ties go on
+			equal = append(equal, column+" IS NULL")
+			continue
+		}
+		comparison := ">"
+		if key.Desc {
+			comparison = "<"
+		}
+		alternatives = append(alternatives, "("+strings.Join(append(equal, fmt.Sprintf("(%s IS NULL OR %s %s ?)", column, column, comparison)), " AND ")+")")
+		args = append(append(args, equalArgs...), value)
+		equal = append(equal, column+" = ?")
+		equalArgs = append(equalArgs, value)
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
+
+// isSetCondition tests that an optional column is set, or unset when set is false
+func isSetCondition(column string, set bool) string {
+	if set {
+		return column + " IS NOT NULL"
+	}
+	return column + " IS NULL"
+}
+
+// addTodoColumns adds the todoColumns missing from the todos table and fills
+// them in from the documents
+func (s *SQLiteStore) addTodoColumns(ctx context.Context) error {
+	rows, err := s.conn().QueryContext(ctx, "SELECT name FROM pragma_table_info('todos')")
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	added := false
+	for _, column := range todoColumns {
+		if existing[column.name] {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE todos ADD COLUMN %s %s", column.name, column.decl)); err != nil {
+			return err
+		}
+		added = true
+	}
+	if !added {
+		return nil
+	}
+
+	rows, err = tx.QueryContext(ctx, "SELECT data FROM todos")
+	if err != nil {
+		return err
+	}
+	var all []models.Todo
+	for rows.Next() {
+		var data []byte
+		var todo models.Todo
+		if err := rows.Scan(&data); err != nil {
+			rows.Close()
+			return err
+		}
+		if err := bson.Unmarshal(data, &todo); err != nil {
+			rows.Close()
+			return err
+		}
+		all = append(all, todo)
+	}
+	rows.Close()
+	for _, todo := range all {
+		args := append(todoColumnValues(todo), todo.ID.Hex())
+		if _, err := tx.ExecContext(ctx, "UPDATE todos SET "+todoColumnAssignments()+" WHERE id = ?", args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// todoColumnAssignments returns "name = ?, ..." to set every todoColumn
+func todoColumnAssignments() string {
+	assignments := make([]string, len(todoColumns))
+	for i, column := range todoColumns {
+		assignments[i] = column.name + " = ?"
+	}
+	return strings.Join(assignments, ", ")
+}
+
+// todoColumnValues returns the values of the todoColumns of a todo
+func todoColumnValues(todo models.Todo) []interface{} {
+	values := make([]interface{}, len(todoColumns))
+	for i, column := range todoColumns {
+		values[i] = column.value(todo)
+	}
+	return values
+}
+
+// indexTodo adds a todo to the full-text index
+func indexTodo(ctx context.Context, tx sqlConn, todo models.Todo) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO todos_fts (title, notes, todo_id, user_id) VALUES (?, ?, ?, ?)",
+		todo.Title, todo.Notes, todo.ID.Hex(), todo.UserID.Hex())
+	return err
+}
+
+// unindexTodo removes a todo from the full-text index
+func unindexTodo(ctx context.Context, tx sqlConn, id primitive.ObjectID) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM todos_fts WHERE todo_id = ?", id.Hex())
+	return err
+}
+
+// Stores returns the store wired into every slot of services.Stores
+func (s *SQLiteStore) Stores() services.Stores {
+	return services.Stores{Todos: s, Projects: s, Views: s, Events: s, Operations: s, Users: s, Tokens: s, Transactions: s}
+}
+
+// InTransaction runs fn on a store whose statements all go to one
+// transaction, committed when fn succeeds
+func (s *SQLiteStore) InTransaction(ctx context.Context, fn func(ctx context.Context, stores services.Stores) error) error {
+	if s.tx != nil {
+		return fn(ctx, s.Stores())
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(ctx, (&SQLiteStore{db: s.db, tx: tx}).Stores()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqlConn runs statements, on the database or in a transaction
+type sqlConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// sqlTx is a transaction begun by a method of the store
+type sqlTx interface {
+	sqlConn
+	Commit() error
+	Rollback() error
+}
+
+// conn returns what the statements of the store run on
+func (s *SQLiteStore) conn() sqlConn {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
+// begin starts a transaction, or a savepoint within the transaction of a
+// store handed out by InTransaction
+func (s *SQLiteStore) begin(ctx context.Context) (sqlTx, error) {
+	if s.tx == nil {
+		return s.db.BeginTx(ctx, nil)
+	}
+	if _, err := s.tx.ExecContext(ctx, "SAVEPOINT nested"); err != nil {
+		return nil, err
+	}
+	return &savepoint{Tx: s.tx}, nil
+}
+
+// savepoint is a transaction nested in another one, committing it keeps its
+// changes for the outer transaction to commit
+type savepoint struct {
+	*sql.Tx
+	done bool
+}
+
+func (t *savepoint) Commit() error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	_, err := t.Tx.Exec("RELEASE nested")
+	return err
+}
+
+func (t *savepoint) Rollback() error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	_, err := t.Tx.Exec("ROLLBACK TO nested; RELEASE nested")
+	return err
+}
+
+// Close closes the underlying database file
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// queryOne decodes the data column of the first row returned by query into out
+func (s *SQLiteStore) queryOne(ctx context.Context, out interface{}, query string, args ...interface{}) error {
+	var data []byte
+	err := s.conn().QueryRowContext(ctx, query, args...).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return services.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, out)
+}
+
+// queryAll decodes the data column of every row returned by query
+func queryAll[T any](ctx context.Context, s *SQLiteStore, query string, args ...interface{}) ([]T, error) {
+	rows, err := s.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs []T
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var doc T
+		if err := bson.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// exec runs a statement and reports services.ErrNotFound when it touched no rows
+func (s *SQLiteStore) exec(ctx context.Context, query string, args ...interface{}) error {
+	return touched(s.conn().ExecContext(ctx, query, args...))
+}
+
+// execTx is exec within a transaction
+func execTx(ctx context.Context, tx sqlConn, query string, args ...interface{}) error {
+	return touched(tx.ExecContext(ctx, query, args...))
+}
+
+// touched maps a statement that affected no rows onto services.ErrNotFound
+func touched(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return services.ErrNotFound
+	}
+	return nil
+}
+
+// InsertTodo stores a new todo
+func (s *SQLiteStore) InsertTodo(ctx context.Context, todo models.Todo) error {
+	data, err := bson.Marshal(todo)
+	if err != nil {
+		return err
+	}
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO todos (id, user_id, data) VALUES (?, ?, ?)",
+		todo.ID.Hex(), todo.UserID.Hex(), data); err != nil {
+		return err
+	}
+	args := append(todoColumnValues(todo), todo.ID.Hex())
+	if _, err := tx.ExecContext(ctx, "UPDATE todos SET "+todoColumnAssignments()+" WHERE id = ?", args...); err != nil {
+		return err
+	}
+	if err := indexTodo(ctx, tx, todo); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// FindTodos returns the todos of the user passing the query
+func (s *SQLiteStore) FindTodos(ctx context.Context, userID primitive.ObjectID, query services.TodoQuery) ([]models.Todo, error) {
+	where, args := todoQueryWhere(query)
+	orderBy := "rowid"
+	if query.Ordered() {
+		orderBy = todoOrderBy(query.Sort)
+	}
+	statement := "SELECT data FROM todos WHERE user_id = ? AND " + where + " ORDER BY " + orderBy
+	args = append([]interface{}{userID.Hex()}, args...)
+	if query.Limit > 0 {
+		statement += " LIMIT ?"
+		args = append(args, query.Limit)
+	}
+	return queryAll[models.Todo](ctx, s, statement, args...)
+}
+
+// ScanTodos decodes the todos owned by the user one row at a time
+func (s *SQLiteStore) ScanTodos(ctx context.Context, userID primitive.ObjectID, fn func(models.Todo) error) error {
+	rows, err := s.conn().QueryContext(ctx, "SELECT data FROM todos WHERE user_id = ? ORDER BY rowid", userID.Hex())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		var todo models.Todo
+		if err := bson.Unmarshal(data, &todo); err != nil {
+			return err
+		}
+		if err := fn(todo); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// FindTodo returns a single todo owned by the user
+func (s *SQLiteStore) FindTodo(ctx context.Context, id, userID primitive.ObjectID) (models.Todo, error) {
+	var todo models.Todo
+	err := s.queryOne(ctx, &todo, "SELECT data FROM todos WHERE id = ? AND user_id = ?", id.Hex(), userID.Hex())
+	return todo, err
+}
+
+// ReplaceTodo overwrites a stored todo with the given one, as long as the
+// stored one is still at version
+func (s *SQLiteStore) ReplaceTodo(ctx context.Context, todo models.Todo, version int64) error {
+	data, err := bson.Marshal(todo)
+	if err != nil {
+		return err
+	}
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	args := append(append([]interface{}{data}, todoColumnValues(todo)...), todo.ID.Hex(), todo.UserID.Hex(), version)
+	err = execTx(ctx, tx, "UPDATE todos SET data = ?, "+todoColumnAssignments()+" WHERE id = ? AND user_id = ? AND version = ?", args...)
+	if errors.Is(err, services.ErrNotFound) {
+		var current int64
+		if err := tx.QueryRowContext(ctx, "SELECT version FROM todos WHERE id = ? AND user_id = ?",
+			todo.ID.Hex(), todo.UserID.Hex()).Scan(&current); err == nil {
+			return &services.VersionMismatchError{Expected: version, Current: current}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := unindexTodo(ctx, tx, todo.ID); err != nil {
+		return err
+	}
+	if err := indexTodo(ctx, tx, todo); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteTodo removes a todo owned by the user
+func (s *SQLiteStore) DeleteTodo(ctx context.Context, id, userID primitive.ObjectID) error {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := execTx(ctx, tx, "DELETE FROM todos WHERE id = ? AND user_id = ?", id.Hex(), userID.Hex()); err != nil {
+		return err
+	}
+	if err := unindexTodo(ctx, tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PurgeTodos deletes the todos of every user moved to the trash before the given time
+func (s *SQLiteStore) PurgeTodos(ctx context.Context, before time.Time) ([]models.Todo, error) {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT data FROM todos WHERE deleted_at < ?", before.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	var expired []models.Todo
+	for rows.Next() {
+		var data []byte
+		var todo models.Todo
+		if err := rows.Scan(&data); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if err := bson.Unmarshal(data, &todo); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		expired = append(expired, todo)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, todo := range expired {
+		if err := execTx(ctx, tx, "DELETE FROM todos WHERE id = ?", todo.ID.Hex()); err != nil {
+			return nil, err
+		}
+		if err := unindexTodo(ctx, tx, todo.ID); err != nil {
+			return nil, err
+		}
+	}
+	return expired, tx.Commit()
+}
+
+// ArchiveTodos archives the todos of every user completed before the given time
+func (s *SQLiteStore) ArchiveTodos(ctx context.Context, completedBefore, archivedAt time.Time) ([]models.Todo, error) {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Todos completed before completed_at was recorded go by their last update
+	rows, err := tx.QueryContext(ctx, `SELECT data FROM todos
+WHERE completed AND archived_at IS NULL AND deleted_at IS NULL
+AND (completed_at < ? OR (completed_at IS NULL AND updated_at < ?))`,
+		completedBefore.UnixMilli(), completedBefore.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	var archive []models.Todo
+	for rows.Next() {
+		var data []byte
+		var todo models.Todo
+		if err := rows.Scan(&data); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if err := bson.Unmarshal(data, &todo); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		archive = append(archive, todo)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, todo := range archive {
+		todo.ArchivedAt = &archivedAt
+		todo.Version++
+		data, err := bson.Marshal(todo)
+		if err != nil {
+			return nil, err
+		}
+		args := append(append([]interface{}{data}, todoColumnValues(todo)...), todo.ID.Hex())
+		if err := execTx(ctx, tx, "UPDATE todos SET data = ?, "+todoColumnAssignments()+" WHERE id = ?", args...); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// SearchTodos ranks the todos of the user passing the query matching any of
+// the terms with the full-text index, title matches weigh three times as much
+// as notes
+func (s *SQLiteStore) SearchTodos(ctx context.Context, userID primitive.ObjectID, terms []string, query services.TodoQuery, limit int) ([]services.TodoMatch, error) {
+	// Every term is quoted so it is never read as FTS5 syntax and matched as a prefix
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+	}
+	where, whereArgs := todoQueryWhere(query)
+	args := append([]interface{}{strings.Join(quoted, " OR "), userID.Hex()}, whereArgs...)
+	rows, err := s.conn().QueryContext(ctx, `
+		SELECT todos.data, -bm25(todos_fts, 3.0, 1.0) AS score
+		FROM todos_fts JOIN todos ON todos.id = todos_fts.todo_id
+		WHERE todos_fts MATCH ? AND todos_fts.user_id = ? AND `+where+`
+		ORDER BY score DESC
+		LIMIT ?`,
+		append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []services.TodoMatch
+	for rows.Next() {
+		var data []byte
+		var match services.TodoMatch
+		if err := rows.Scan(&data, &match.Score); err != nil {
+			return nil, err
+		}
+		if err := bson.Unmarshal(data, &match.Todo); err != nil {
+			return nil, err
+		}
+		matches = append(matches, match)
+	}
+	return matches, rows.Err()
+}
+
+// InsertProject stores a new project
+func (s *SQLiteStore) InsertProject(ctx context.Context, project models.Project) error {
+	data, err := bson.Marshal(project)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn().ExecContext(ctx, "INSERT INTO projects (id, user_id, data) VALUES (?, ?, ?)",
+		project.ID.Hex(), project.UserID.Hex(), data)
+	return err
+}
+
+// FindProjects returns every project owned by the user
+func (s *SQLiteStore) FindProjects(ctx context.Context, userID primitive.ObjectID) ([]models.Project, error) {
+	return queryAll[models.Project](ctx, s, "SELECT data FROM projects WHERE user_id = ? ORDER BY rowid", userID.Hex())
+}
+
+// FindProject returns a single project owned by the user
+func (s *SQLiteStore) FindProject(ctx context.Context, id, userID primitive.ObjectID) (models.Project, error) {
+	var project models.Project
+	err := s.queryOne(ctx, &project, "SELECT data FROM projects WHERE id = ? AND user_id = ?", id.Hex(), userID.Hex())
+	return project, err
+}
+
+// ReplaceProject overwrites a stored project with the given one
+func (s *SQLiteStore) ReplaceProject(ctx context.Context, project models.Project) error {
+	data, err := bson.Marshal(project)
+	if err != nil {
+		return err
+	}
+	return s.exec(ctx, "UPDATE projects SET data = ? WHERE id = ? AND user_id = ?",
+		data, project.ID.Hex(), project.UserID.Hex())
+}
+
+// DeleteProject removes a project owned by the user
+func (s *SQLiteStore) DeleteProject(ctx context.Context, id, userID primitive.ObjectID) error {
+	return s.exec(ctx, "DELETE FROM projects WHERE id = ? AND user_id = ?", id.Hex(), userID.Hex())
+}
+
+// InsertView stores a new saved view
+func (s *SQLiteStore) InsertView(ctx context.Context, view models.SavedView) error {
+	data, err := bson.Marshal(view)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn().ExecContext(ctx, "INSERT INTO views (id, user_id, data) VALUES (?, ?, ?)",
+		view.ID.Hex(), view.UserID.Hex(), data)
+	return err
+}
+
+// FindViews returns every saved view owned by the user
+func (s *SQLiteStore) FindViews(ctx context.Context, userID primitive.ObjectID) ([]models.SavedView, error) {
+	return queryAll[models.SavedView](ctx, s, "SELECT data FROM views WHERE user_id = ? ORDER BY rowid", userID.Hex())
+}
+
+// FindView returns a single saved view owned by the user
+func (s *SQLiteStore) FindView(ctx context.Context, id, userID primitive.ObjectID) (models.SavedView, error) {
+	var view models.SavedView
+	err := s.queryOne(ctx, &view, "SELECT data FROM views WHERE id = ? AND user_id = ?", id.Hex(), userID.Hex())
+	return view, err
+}
+
+// ReplaceView overwrites a stored view with the given one
+func (s *SQLiteStore) ReplaceView(ctx context.Context, view models.SavedView) error {
+	data, err := bson.Marshal(view)
+	if err != nil {
+		return err
+	}
+	return s.exec(ctx, "UPDATE views SET data = ? WHERE id = ? AND user_id = ?",
+		data, view.ID.Hex(), view.UserID.Hex())
+}
+
+// DeleteView removes a saved view owned by the user
+func (s *SQLiteStore) DeleteView(ctx context.Context, id, userID primitive.ObjectID) error {
+	return s.exec(ctx, "DELETE FROM views WHERE id = ? AND user_id = ?", id.Hex(), userID.Hex())
+}
+
+// InsertEvent stores a new event in the history of a todo
+func (s *SQLiteStore) InsertEvent(ctx context.Context, event models.TodoEvent) error {
+	data, err := bson.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn().ExecContext(ctx, "INSERT INTO todo_events (id, todo_id, user_id, data) VALUES (?, ?, ?, ?)",
+		event.ID.Hex(), event.TodoID.Hex(), event.UserID.Hex(), data)
+	return err
+}
+
+// FindEvents returns the history of a todo owned by the user, oldest first
+func (s *SQLiteStore) FindEvents(ctx context.Context, todoID, userID primitive.ObjectID) ([]models.TodoEvent, error) {
+	return queryAll[models.TodoEvent](ctx, s, "SELECT data FROM todo_events WHERE todo_id = ? AND user_id = ? ORDER BY rowid",
+		todoID.Hex(), userID.Hex())
+}
+
+// InsertOperation logs a new operation
+func (s *SQLiteStore) InsertOperation(ctx context.Context, op models.Operation) error {
+	data, err := bson.Marshal(op)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn().ExecContext(ctx, "INSERT INTO operations (id, user_id, data) VALUES (?, ?, ?)",
+		op.ID.Hex(), op.UserID.Hex(), data)
+	return err
+}
+
+// FindOperations returns the logged operations of the user, oldest first
+func (s *SQLiteStore) FindOperations(ctx context.Context, userID primitive.ObjectID) ([]models.Operation, error) {
+	return queryAll[models.Operation](ctx, s, "SELECT data FROM operations WHERE user_id = ? ORDER BY rowid", userID.Hex())
+}
+
+// ReplaceOperation overwrites a logged operation with the given one
+func (s *SQLiteStore) ReplaceOperation(ctx context.Context, op models.Operation) error {
+	data, err := bson.Marshal(op)
+	if err != nil {
+		return err
+	}
+	return s.exec(ctx, "UPDATE operations SET data = ? WHERE id = ? AND user_id = ?",
+		data, op.ID.Hex(), op.UserID.Hex())
+}
+
+// DeleteOperation removes a logged operation of the user
+func (s *SQLiteStore) DeleteOperation(ctx context.Context, id, userID primitive.ObjectID) error {
+	return s.exec(ctx, "DELETE FROM operations WHERE id = ? AND user_id = ?", id.Hex(), userID.Hex())
+}
+
+// InsertUser stores a new user
+func (s *SQLiteStore) InsertUser(ctx context.Context, user models.User) error {
+	data, err := bson.Marshal(user)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn().ExecContext(ctx, "INSERT INTO users (id, username, data) VALUES (?, ?, ?)",
+		user.ID.Hex(), user.Username, data)
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return services.ErrUsernameTaken
+	}
+	return err
+}
+
+// FindUserByID returns the user with the given ID
+func (s *SQLiteStore) FindUserByID(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	var user models.User
+	err := s.queryOne(ctx, &user, "SELECT data FROM users WHERE id = ?", id.Hex())
+	return user, err
+}
+
+// FindUserByUsername returns the user with the given username
+func (s *SQLiteStore) FindUserByUsername(ctx context.Context, username string) (models.User, error) {
+	var user models.User
+	err := s.queryOne(ctx, &user, "SELECT data FROM users WHERE username = ?", username)
+	return user, err
+}
+
+// InsertToken stores the session of a login
+func (s *SQLiteStore) InsertToken(ctx context.Context, token models.Token) error {
+	data, err := bson.Marshal(token)
+	if err != nil {
+		return err
+	}
+	return s.exec(ctx, "INSERT INTO tokens (token, user_id, exp, refresh_hash, data) VALUES (?, ?, ?, ?, ?)",
+		token.ID, token.UserID, token.Exp, token.RefreshHash, data)
+}
+
+// FindToken returns the session with the given ID
+func (s *SQLiteStore) FindToken(ctx context.Context, id string) (models.Token, error) {
+	var token models.Token
+	err := s.queryOne(ctx, &token, "SELECT data FROM tokens WHERE token = ?", id)
+	return token, err
+}
+
+// RotateToken replaces a session whose refresh token is still the one hashed as refreshHash
+func (s *SQLiteStore) RotateToken(ctx context.Context, token models.Token, refreshHash string) error {
+	data, err := bson.Marshal(token)
+	if err != nil {
+		return err
+	}
+	// Checking the hash in the update itself lets exactly one of two
+	// refreshes at the same time through
+	return s.exec(ctx, "UPDATE tokens SET exp = ?, refresh_hash = ?, data = ? WHERE token = ? AND refresh_hash = ?",
+		token.Exp, token.RefreshHash, data, token.ID, refreshHash)
+}
+
+// FindTokens returns the sessions of the user
+func (s *SQLiteStore) FindTokens(ctx context.Context, userID string) ([]models.Token, error) {
+	return queryAll[models.Token](ctx, s, "SELECT data FROM tokens WHERE user_id = ?", userID)
+}
+
+// DeleteTokens removes the sessions of the user
+func (s *SQLiteStore) DeleteTokens(ctx context.Context, userID string) error {
+	_, err := s.conn().ExecContext(ctx, "DELETE FROM tokens WHERE user_id = ?", userID)
+	return err
+}
+
+// DeleteToken removes a session
+func (s *SQLiteStore) DeleteToken(ctx context.Context, id string) error {
+	_, err := s.conn().ExecContext(ctx, "DELETE FROM tokens WHERE token = ?", id)
+	return err
+}
+
+// InsertAccessToken stores a new personal access token
+func (s *SQLiteStore) InsertAccessToken(ctx context.Context, token models.AccessToken) error {
+	data, err := bson.Marshal(token)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn().ExecContext(ctx, "INSERT INTO access_tokens (id, user_id, data) VALUES (?, ?, ?)",
+		token.ID.Hex(), token.UserID.Hex(), data)
+	return err
+}
+
+// FindAccessToken returns the personal access token with the given ID
+func (s *SQLiteStore) FindAccessToken(ctx context.Context, id primitive.ObjectID) (models.AccessToken, error) {
+	var token models.AccessToken
+	err := s.queryOne(ctx, &token, "SELECT data FROM access_tokens WHERE id = ?", id.Hex())
+	return token, err
+}
+
+// FindAccessTokens returns the personal access tokens of the user
+func (s *SQLiteStore) FindAccessTokens(ctx context.Context, userID primitive.ObjectID) ([]models.AccessToken, error) {
+	return queryAll[models.AccessToken](ctx, s, "SELECT data FROM access_tokens WHERE user_id = ? ORDER BY rowid", userID.Hex())
+}
+
+// ReplaceAccessToken overwrites a stored personal access token with the given one
+func (s *SQLiteStore) ReplaceAccessToken(ctx context.Context, token models.AccessToken) error {
+	data, err := bson.Marshal(token)
+	if err != nil {
+		return err
+	}
+	return s.exec(ctx, "UPDATE access_tokens SET data = ? WHERE id = ? AND user_id = ?",
+		data, token.ID.Hex(), token.UserID.Hex())
+}
+
+// DeleteAccessToken removes a personal access token of the user
+func (s *SQLiteStore) DeleteAccessToken(ctx context.Context, id, userID primitive.ObjectID) error {
+	return s.exec(ctx, "DELETE FROM access_tokens WHERE id = ? AND user_id = ?", id.Hex(), userID.Hex())
+}
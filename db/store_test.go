@@ -0,0 +1,412 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"todo-cli/models"
+	"todo-cli/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testStores opens every backend that runs without a server, empty
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	sqlite, err := NewSQLiteStore(filepath.Join(t.TempDir(), "todos.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	return map[string]Store{"memory": NewMemoryStore(), "sqlite": sqlite}
+}
+
+func TestReplaceTodoVersion(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			todo := models.Todo{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Title: "report", Version: 1}
+			if err := store.InsertTodo(ctx, todo); err != nil {
+				t.Fatal(err)
+			}
+
+			todo.Title, todo.Version = "first", 2
+			if err := store.ReplaceTodo(ctx, todo, 1); err != nil {
+				t.Fatalf("ReplaceTodo at the stored version failed: %v", err)
+			}
+			// A second writer that read version 1 as well
+			lost := todo
+			lost.Title = "second"
+			var mismatch *services.VersionMismatchError
+			if err := store.ReplaceTodo(ctx, lost, 1); !errors.As(err, &mismatch) || mismatch.Expected != 1 || mismatch.Current != 2 {
+				t.Fatalf("ReplaceTodo at a stale version returned %v, want a mismatch at version 2", err)
+			}
+
+			stored, err := store.FindTodo(ctx, todo.ID, todo.UserID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Title != "first" || stored.Version != 2 {
+				t.Errorf("stored todo is %q at version %d, want %q at version 2", stored.Title, stored.Version, "first")
+			}
+			if err := store.ReplaceTodo(ctx, models.Todo{ID: primitive.NewObjectID(), UserID: todo.UserID}, 1); !errors.Is(err, services.ErrNotFound) {
+				t.Errorf("ReplaceTodo of a missing todo returned %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestInsertUserUnique(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			first := models.User{ID: primitive.NewObjectID(), Username: "alice"}
+			if err := store.InsertUser(ctx, first); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.InsertUser(ctx, models.User{ID: primitive.NewObjectID(), Username: "alice"}); !errors.Is(err, services.ErrUsernameTaken) {
+				t.Fatalf("InsertUser of a taken username returned %v, want ErrUsernameTaken", err)
+			}
+			if err := store.InsertUser(ctx, models.User{ID: primitive.NewObjectID(), Username: "bob"}); err != nil {
+				t.Fatalf("InsertUser of another username failed: %v", err)
+			}
+			found, err := store.FindUserByUsername(ctx, "alice")
+			if err != nil || found.ID != first.ID {
+				t.Errorf("FindUserByUsername returned %v, %v, want the first alice", found.ID, err)
+			}
+		})
+	}
+}
+
+func TestRotateTokenConcurrent(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			session := models.Token{ID: primitive.NewObjectID().Hex(), UserID: primitive.NewObjectID().Hex(), RefreshHash: "first"}
+			if err := store.InsertToken(ctx, session); err != nil {
+				t.Fatal(err)
+			}
+
+			const refreshes = 8
+			errs := make(chan error, refreshes)
+			var wg sync.WaitGroup
+			for i := 0; i < refreshes; i++ {
+				rotated := session
+				rotated.RefreshHash = fmt.Sprintf("second-%d", i)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs <- store.RotateToken(ctx, rotated, "first")
+				}()
+			}
+			wg.Wait()
+			close(errs)
+
+			var rotated int
+			for err := range errs {
+				switch {
+				case err == nil:
+					rotated++
+				case !errors.Is(err, services.ErrNotFound):
+					t.Errorf("RotateToken returned %v, want ErrNotFound when another refresh came first", err)
+				}
+			}
+			if rotated != 1 {
+				t.Errorf("%d refreshes rotated the session, want exactly one", rotated)
+			}
+			stored, err := store.FindToken(ctx, session.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.RefreshHash == "first" {
+				t.Errorf("the session still holds the first refresh token")
+			}
+		})
+	}
+}
+
+// TestFindTodosQuery checks that the stores select, sort and page todos the
+// way TodoQuery.Select does
+func TestFindTodosQuery(t *testing.T) {
+	ctx := context.Background()
+	random := rand.New(rand.NewSource(1))
+	userID := primitive.NewObjectID()
+	projects := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()}
+	tags := []string{"work", "home", "errand"}
+	base := time.Date(2024, 10, 1, 9, 0, 0, 0, time.UTC)
+	someTime := func() *time.Time {
+		if random.Intn(3) == 0 {
+			return nil
+		}
+		t := base.Add(time.Duration(random.Intn(10)) * 24 * time.Hour)
+		return &t
+	}
+
+	var todos []models.Todo
+	for i := 0; i < 80; i++ {
+		todo := models.Todo{
+			ID:        primitive.NewObjectID(),
+			UserID:    userID,
+			Title:     []string{"Alpha", "beta", "alpha", "Gamma", ""}[random.Intn(5)],
+			Completed: random.Intn(2) == 0,
+			Priority:  models.Priority(random.Intn(5)),
+			Position:  float64(random.Intn(4)),
+			StartAt:   someTime(),
+			DueAt:     someTime(),
+			CreatedAt: base.Add(time.Duration(random.Intn(20)) * time.Hour),
+		}
+		todo.UpdatedAt = todo.CreatedAt.Add(time.Duration(random.Intn(20)) * time.Hour)
+		if random.Intn(3) > 0 {
+			todo.ProjectID = &projects[random.Intn(2)]
+		}
+		for _, tag := range tags {
+			if random.Intn(2) == 0 {
+				todo.Tags = append(todo.Tags, tag)
+			}
+		}
+		if i > 10 && random.Intn(4) == 0 {
+			todo.ParentID = &todos[random.Intn(len(todos))].ID
+		}
+		if i > 2 && random.Intn(4) == 0 {
+			todo.SeriesID = &todos[2].ID
+		}
+		todos = append(todos, todo)
+	}
+	// A todo of someone else is never returned
+	others := append([]models.Todo{}, todos[0])
+	others[0].ID, others[0].UserID = primitive.NewObjectID(), primitive.NewObjectID()
+
+	yes, no := true, false
+	after := base.Add(5 * time.Hour)
+	queries := map[string]services.TodoQuery{
+		"everything": {},
+		"open":       {Completed: &no},
+		"done":       {Completed: &yes},
+		"project":    {Project: &projects[0]},
+		"inbox":      {Inbox: true},
+		"tags":       {Tags: []string{"work", "home"}},
+		"subtasks":   {Parents: []primitive.ObjectID{todos[0].ID, todos[3].ID, todos[7].ID}},
+		"series":     {Series: &todos[2].ID},
+		"created":    {Created: services.TimeRange{After: &after}},
+		"updated":    {Updated: services.TimeRange{Before: &after}},
+	}
+	sorts := []string{"", "title", "-title", "-priority,position", "due_at", "-due_at,title", "start_at,-priority", "completed,-created_at", "-updated_at", "position,completed_at"}
+
+	for name, store := range testStores(t) {
+		for _, todo := range append(todos, others...) {
+			if err := store.InsertTodo(ctx, todo); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for queryName, query := range queries {
+			for _, spec := range sorts {
+				order, err := services.ParseTodoSort(spec)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if spec == "" {
+					order = nil
+				}
+				query.Sort = order
+				query.After, query.Limit = nil, 0
+				want := ids(query.Select(todos))
+				for _, limit := range []int{0, 1, 7} {
+					if len(order) == 0 && limit > 0 {
+						// Only sorted todos can be resumed after one of them
+						continue
+					}
+					t.Run(fmt.Sprintf("%s/%s/%s/limit %d", name, queryName, spec, limit), func(t *testing.T) {
+						got := pageThrough(t, store, userID, query, limit)
+						if len(order) == 0 {
+							// Without a sort the stores keep their own order
+							got, want := sortedIDs(got), sortedIDs(want)
+							if !reflect.DeepEqual(got, want) {
+								t.Errorf("FindTodos returned %d todos, want %d", len(got), len(want))
+							}
+							return
+						}
+						if !reflect.DeepEqual(got, want) {
+							t.Errorf("FindTodos returned %d todos in another order than the %d expected", len(got), len(want))
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+// pageThrough reads every todo of the query, limit at a time when it is set
+func pageThrough(t *testing.T, store Store, userID primitive.ObjectID, query services.TodoQuery, limit int) []primitive.ObjectID {
+	t.Helper()
+	ctx := context.Background()
+	query.Limit = limit
+	var found []primitive.ObjectID
+	for {
+		page, err := store.FindTodos(ctx, userID, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if limit > 0 && len(page) > limit {
+			t.Fatalf("FindTodos returned %d todos with a limit of %d", len(page), limit)
+		}
+		found = append(found, ids(page)...)
+		if limit == 0 || len(page) < limit {
+			return found
+		}
+		query.After = &page[len(page)-1]
+	}
+}
+
+func ids(todos []models.Todo) []primitive.ObjectID {
+	found := []primitive.ObjectID{}
+	for _, todo := range todos {
+		found = append(found, todo.ID)
+	}
+	return found
+}
+
+func sortedIDs(found []primitive.ObjectID) []string {
+	hex := make([]string, len(found))
+	for i, id := range found {
+		hex[i] = id.Hex()
+	}
+	sort.Strings(hex)
+	return hex
+}
+
+func TestMemoryPurgeTodosFailure(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	deletedAt := time.Date(2024, 10, 1, 9, 0, 0, 0, time.UTC)
+	trashed := models.Todo{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Title: "trashed", DeletedAt: &deletedAt}
+	live := models.Todo{ID: primitive.NewObjectID(), UserID: trashed.UserID, Title: "live"}
+	for _, todo := range []models.Todo{trashed, live} {
+		if err := store.InsertTodo(ctx, todo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.todos = append(store.todos, memoryDoc{id: primitive.NewObjectID(), data: []byte("not bson")})
+	want := append([]memoryDoc(nil), store.todos...)
+
+	if _, err := store.PurgeTodos(ctx, deletedAt.Add(time.Hour)); err == nil {
+		t.Fatal("PurgeTodos of an undecodable todo succeeded")
+	}
+	if !reflect.DeepEqual(store.todos, want) {
+		t.Error("a failed PurgeTodos changed the stored todos")
+	}
+}
+
+func TestArchiveTodos(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 10, 1, 9, 0, 0, 0, time.UTC)
+	long, recent := now.Add(-30*24*time.Hour), now.Add(-time.Hour)
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			todo := func(title string, completed bool, completedAt, updatedAt, deletedAt, archivedAt *time.Time) models.Todo {
+				todo := models.Todo{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Title: title, Completed: completed,
+					CompletedAt: completedAt, DeletedAt: deletedAt, ArchivedAt: archivedAt, Version: 1}
+				if updatedAt != nil {
+					todo.UpdatedAt = *updatedAt
+				}
+				if err := store.InsertTodo(ctx, todo); err != nil {
+					t.Fatal(err)
+				}
+				return todo
+			}
+			want := []models.Todo{
+				todo("done long ago", true, &long, &long, nil, nil),
+				todo("done before completed_at was recorded", true, nil, &long, nil, nil),
+			}
+			todo("done recently", true, &recent, &recent, nil, nil)
+			todo("open", false, nil, &long, nil, nil)
+			todo("trashed", true, &long, &long, &recent, nil)
+			todo("archived", true, &long, &long, nil, &recent)
+
+			archived, err := store.ArchiveTodos(ctx, now.Add(-7*24*time.Hour), now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := sortedIDs(ids(archived)), sortedIDs(ids(want)); !reflect.DeepEqual(got, want) {
+				t.Fatalf("ArchiveTodos archived %v, want %v", got, want)
+			}
+			for _, todo := range want {
+				stored, err := store.FindTodo(ctx, todo.ID, todo.UserID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if stored.ArchivedAt == nil || !stored.ArchivedAt.Equal(now) || stored.Version != 2 {
+					t.Errorf("%q is archived at %v at version %d, want %v at version 2", todo.Title, stored.ArchivedAt, stored.Version, now)
+				}
+			}
+			if again, err := store.ArchiveTodos(ctx, now.Add(-7*24*time.Hour), now); err != nil || len(again) != 0 {
+				t.Errorf("archiving again returned %d todos, %v, want none", len(again), err)
+			}
+		})
+	}
+}
+
+func TestInTransaction(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			userID := primitive.NewObjectID()
+			kept := models.Todo{ID: primitive.NewObjectID(), UserID: userID, Title: "kept", Version: 1}
+			if err := store.InsertTodo(ctx, kept); err != nil {
+				t.Fatal(err)
+			}
+			transactions := store.Stores().Transactions
+			changed := kept
+			changed.Title, changed.Version = "changed", 2
+			added := models.Todo{ID: primitive.NewObjectID(), UserID: userID, Title: "added", Version: 1}
+
+			failure := errors.New("failed")
+			err := transactions.InTransaction(ctx, func(ctx context.Context, stores services.Stores) error {
+				if err := stores.Todos.ReplaceTodo(ctx, changed, 1); err != nil {
+					return err
+				}
+				if err := stores.Todos.InsertTodo(ctx, added); err != nil {
+					return err
+				}
+				return failure
+			})
+			if !errors.Is(err, failure) {
+				t.Fatalf("InTransaction returned %v, want the error of fn", err)
+			}
+			if stored, err := store.FindTodo(ctx, kept.ID, userID); err != nil || stored.Title != "kept" {
+				t.Errorf("a failed transaction left the todo as %q, %v", stored.Title, err)
+			}
+			if _, err := store.FindTodo(ctx, added.ID, userID); !errors.Is(err, services.ErrNotFound) {
+				t.Errorf("a failed transaction added a todo, FindTodo returned %v", err)
+			}
+
+			err = transactions.InTransaction(ctx, func(ctx context.Context, stores services.Stores) error {
+				if err := stores.Todos.ReplaceTodo(ctx, changed, 1); err != nil {
+					return err
+				}
+				// A failing step does not undo the steps before it
+				var mismatch *services.VersionMismatchError
+				if err := stores.Todos.ReplaceTodo(ctx, changed, 1); !errors.As(err, &mismatch) {
+					return fmt.Errorf("replacing at a stale version returned %v", err)
+				}
+				return stores.Todos.InsertTodo(ctx, added)
+			})
+			if err != nil {
+				t.Fatalf("InTransaction failed: %v", err)
+			}
+			if stored, err := store.FindTodo(ctx, kept.ID, userID); err != nil || stored.Title != "changed" {
+				t.Errorf("a committed transaction left the todo as %q, %v", stored.Title, err)
+			}
+			if found, err := store.FindTodos(ctx, userID, services.TodoQuery{}); err != nil || len(found) != 2 {
+				t.Errorf("after the transaction the user has %d todos, %v, want 2", len(found), err)
+			}
+		})
+	}
+}
@@ -1,6 +1,11 @@
 package main
 
-import "todo-cli/cmd"
+import (
+	// The timezones of repeating todos resolve on hosts without zoneinfo
+	_ "time/tzdata"
+
+	"todo-cli/cmd"
+)
 
 func main() {
 	cmd.Execute()
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Scopes a personal access token can be granted. Sessions opened by logging
+// in have them all.
+const (
+	ScopeTodosRead  = "todos:read"  // read todos, projects, tags and views
+	ScopeTodosWrite = "todos:write" // change them as well, implies todos:read
+	ScopeAdmin      = "admin"       // everything, including sessions and access tokens
+)
+
+// Scopes lists every scope, in the order they are documented
+var Scopes = []string{ScopeTodosRead, ScopeTodosWrite, ScopeAdmin}
+
+// AccessToken is a named, long-lived personal access token for scripts and
+// integrations that cannot log in. The token itself is shown once when it is
+// created and only stored as a hash.
+type AccessToken struct {
+	ID         primitive.ObjectID `bson:"_id" json:"id"`
+	UserID     primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Name       string             `bson:"name" json:"name"`
+	Scopes     []string           `bson:"scopes" json:"scopes"`
+	Hash       string             `bson:"hash" json:"-"` // SHA-256 of the token
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	ExpiresAt  *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"` // Never expires when nil
+	LastUsedAt *time.Time         `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+}
+
+// Expired reports whether the token expired by the given time
+func (t AccessToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// Allows reports whether the token was granted scope, directly or through a
+// broader one
+func (t AccessToken) Allows(scope string) bool {
+	for _, granted := range t.Scopes {
+		switch {
+		case granted == scope, granted == ScopeAdmin:
+			return true
+		case granted == ScopeTodosWrite && scope == ScopeTodosRead:
+			return true
+		}
+	}
+	return false
+}
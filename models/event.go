@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Actions recorded in the history of a todo
+const (
+	ActionCreated    = "created"
+	ActionUpdated    = "updated"
+	ActionCompleted  = "completed"
+	ActionReopened   = "reopened"
+	ActionArchived   = "archived"
+	ActionUnarchived = "unarchived"
+	ActionDeleted    = "deleted"
+	ActionRestored   = "restored"
+	ActionPurged     = "purged" // Deleted for good, the history is all that is left
+)
+
+// TodoEvent is one entry in the history of a todo
+type TodoEvent struct {
+	ID      primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	TodoID  primitive.ObjectID  `bson:"todo_id" json:"todo_id"`
+	UserID  primitive.ObjectID  `bson:"user_id" json:"user_id"`             // Owner of the todo
+	ActorID *primitive.ObjectID `bson:"actor_id,omitempty" json:"actor_id"` // Who made the change, nil for the server itself
+	Actor   string              `bson:"-" json:"actor"`                     // Computed, username of the actor or "system"
+	Action  string              `bson:"action" json:"action"`               // One of the Action constants
+	Changes []FieldChange       `bson:"changes,omitempty" json:"changes"`   // Fields that changed
+	At      time.Time           `bson:"at" json:"at"`
+}
+
+// FieldChange is the value of a field of a todo before and after a change,
+// nil where the field was not set
+type FieldChange struct {
+	Field  string      `bson:"field" json:"field"`
+	Before interface{} `bson:"before" json:"before"`
+	After  interface{} `bson:"after" json:"after"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Operation is a mutation of todos made by one request, logged so the user
+// can undo and redo it
+type Operation struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID  primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Name    string             `bson:"name" json:"name"` // e.g. "update todo"
+	Changes []TodoChange       `bson:"changes" json:"changes"`
+	// Projects are the projects it deleted, restored before its todos
+	Projects []ProjectChange `bson:"projects,omitempty" json:"projects,omitempty"`
+	Undone   bool            `bson:"undone" json:"undone"` // Set while the operation is undone and can be redone
+	At       time.Time       `bson:"at" json:"at"`
+}
+
+// TodoChange is a todo as it was before and after an operation
+type TodoChange struct {
+	TodoID primitive.ObjectID `bson:"todo_id" json:"todo_id"`
+	Before *Todo              `bson:"before,omitempty" json:"before"` // nil when the operation created it
+	After  *Todo              `bson:"after,omitempty" json:"after"`   // nil when the operation deleted it for good
+}
+
+// ProjectChange is a project as it was before and after an operation
+type ProjectChange struct {
+	ProjectID primitive.ObjectID `bson:"project_id" json:"project_id"`
+	Before    *Project           `bson:"before,omitempty" json:"before"` // nil when the operation created it
+	After     *Project           `bson:"after,omitempty" json:"after"`   // nil when the operation deleted it
+}
+
+// Title returns the title of the changed todo
+func (c TodoChange) Title() string {
+	if c.After != nil {
+		return c.After.Title
+	}
+	if c.Before != nil {
+		return c.Before.Title
+	}
+	return ""
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Project is a list of todos. Todos without a project are in the Inbox.
+type Project struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Name      string             `bson:"name" json:"name" validate:"required,min=1,max=100"`
+	Archived  bool               `bson:"archived" json:"archived"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// ProjectUpdate struct is used to rename or (un)archive a project
+type ProjectUpdate struct {
+	Name      string    `json:"name,omitempty"`     // Optional
+	Archived  *bool     `json:"archived,omitempty"` // Optional
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,334 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RRule is the subset of RFC 5545 recurrence rules todos can repeat by:
+// FREQ (DAILY, WEEKLY, MONTHLY or YEARLY), INTERVAL, BYDAY for weekly rules,
+// BYMONTHDAY for monthly rules (negative days count from the end of the month)
+// and UNTIL.
+type RRule struct {
+	Freq       string
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay []int
+	Until      *time.Time
+}
+
+var rruleFreqs = []string{"DAILY", "WEEKLY", "MONTHLY", "YEARLY"}
+
+var rruleDays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// ParseRRule parses a rule such as FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH, with or
+// without the RRULE: prefix
+func ParseRRule(value string) (RRule, error) {
+	rule := RRule{Interval: 1}
+	value = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(value)), "RRULE:")
+	for _, part := range strings.Split(value, ";") {
+		if part == "" {
+			continue
+		}
+		name, arg, ok := strings.Cut(part, "=")
+		if !ok || arg == "" {
+			return RRule{}, fmt.Errorf("invalid rrule part %q", part)
+		}
+		switch name {
+		case "FREQ":
+			rule.Freq = arg
+		case "INTERVAL":
+			interval, err := strconv.Atoi(arg)
+			if err != nil || interval < 1 {
+				return RRule{}, fmt.Errorf("invalid rrule INTERVAL %q", arg)
+			}
+			rule.Interval = interval
+		case "BYDAY":
+			for _, day := range strings.Split(arg, ",") {
+				weekday, ok := rruleDays[day]
+				if !ok {
+					return RRule{}, fmt.Errorf("invalid rrule BYDAY %q, expected MO, TU, WE, TH, FR, SA or SU", day)
+				}
+				rule.ByDay = append(rule.ByDay, weekday)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(arg, ",") {
+				monthDay, err := strconv.Atoi(day)
+				if err != nil || monthDay == 0 || monthDay < -31 || monthDay > 31 {
+					return RRule{}, fmt.Errorf("invalid rrule BYMONTHDAY %q", day)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, monthDay)
+			}
+		case "UNTIL":
+			until, err := parseRRuleTime(arg)
+			if err != nil {
+				return RRule{}, fmt.Errorf("invalid rrule UNTIL %q", arg)
+			}
+			rule.Until = &until
+		default:
+			return RRule{}, fmt.Errorf("unsupported rrule part %s", name)
+		}
+	}
+
+	switch {
+	case !containsString(rruleFreqs, rule.Freq):
+		return RRule{}, fmt.Errorf("invalid rrule FREQ %q, expected one of %s", rule.Freq, strings.Join(rruleFreqs, ", "))
+	case len(rule.ByDay) > 0 && rule.Freq != "WEEKLY":
+		return RRule{}, fmt.Errorf("rrule BYDAY is only supported with FREQ=WEEKLY")
+	case len(rule.ByMonthDay) > 0 && rule.Freq != "MONTHLY":
+		return RRule{}, fmt.Errorf("rrule BYMONTHDAY is only supported with FREQ=MONTHLY")
+	}
+	sort.Slice(rule.ByDay, func(i, j int) bool { return weekdayIndex(rule.ByDay[i]) < weekdayIndex(rule.ByDay[j]) })
+	sort.Ints(rule.ByMonthDay)
+	return rule, nil
+}
+
+// parseRRuleTime reads an UNTIL value, either a date or a UTC date-time
+func parseRRuleTime(value string) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("20060102", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// A date includes the whole day
+	return t.Add(24*time.Hour - time.Second), nil
+}
+
+// String writes the rule in its canonical form
+func (r RRule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		var days []string
+		for _, weekday := range r.ByDay {
+			days = append(days, strings.ToUpper(weekday.String()[:2]))
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		var days []string
+		for _, day := range r.ByMonthDay {
+			days = append(days, strconv.Itoa(day))
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next returns the first occurrence after the given one of the series that
+// started at start. Occurrences are at the time of day of start and are
+// evaluated in the location of after. Monthly rules without BYMONTHDAY fall
+// on the day of the month of start and yearly rules on its day of the year,
+// and months without that day are skipped as RFC 5545 requires, so a series
+// started on the 31st or on February 29 does not drift. It reports false once
+// the rule has ended.
+func (r RRule) Next(start, after time.Time) (time.Time, bool) {
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+	start = start.In(after.Location())
+
+	var next time.Time
+	switch r.Freq {
+	case "DAILY":
+		next = atClockOf(after.AddDate(0, 0, interval), start)
+	case "WEEKLY":
+		if len(r.ByDay) == 0 {
+			next = atClockOf(after.AddDate(0, 0, 7*interval), start)
+			break
+		}
+		week := startOfWeek(after)
+		// Every matching day is found within interval+1 weeks
+		for day := 1; day <= 7*(interval+1); day++ {
+			candidate := atClockOf(after.AddDate(0, 0, day), start)
+			weeks := int(startOfWeek(candidate).Sub(week).Hours()+12) / (24 * 7)
+			if weeks%interval == 0 && containsWeekday(r.ByDay, candidate.Weekday()) && candidate.After(after) {
+				next = candidate
+				break
+			}
+		}
+	case "MONTHLY":
+		days := r.ByMonthDay
+		if len(days) == 0 {
+			days = []int{start.Day()}
+		}
+		// Counting from the month of after, which is on the rule unless the
+		// series was moved, the months repeat after 12 steps
+		for months := 0; next.IsZero() && months <= 12*interval; months += interval {
+			next = firstAfter(monthDays(after, start, months, days), after)
+		}
+	case "YEARLY":
+		// A leap day comes back at most 8 years later
+		for years := 0; next.IsZero() && years <= 8*interval; years += interval {
+			y, _, _ := after.Date()
+			first := time.Date(y+years, start.Month(), 1, 0, 0, 0, 0, after.Location())
+			next = firstAfter(monthDays(first, start, 0, []int{start.Day()}), after)
+		}
+	}
+
+	if next.IsZero() || (r.Until != nil && next.After(*r.Until)) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// firstAfter returns the first of the dates, in order, that is after t, the
+// zero time if none is
+func firstAfter(dates []time.Time, t time.Time) time.Time {
+	for _, date := range dates {
+		if date.After(t) {
+			return date
+		}
+	}
+	return time.Time{}
+}
+
+// atClockOf returns the day of t at the time of day of clock, in the location of t
+func atClockOf(t, clock time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, clock.Hour(), clock.Minute(), clock.Second(), clock.Nanosecond(), t.Location())
+}
+
+// monthDays returns the given days of the month that is months after t at the
+// time of day of clock, in order. Days a shorter month does not have are
+// skipped, negative days count back from the end.
+func monthDays(t, clock time.Time, months int, days []int) []time.Time {
+	y, m, _ := t.Date()
+	first := time.Date(y, m+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	length := first.AddDate(0, 1, -1).Day()
+
+	var dates []time.Time
+	for _, day := range days {
+		if day < 0 {
+			day = length + day + 1
+		}
+		if day < 1 || day > length {
+			continue
+		}
+		dates = append(dates, atClockOf(first.AddDate(0, 0, day-1), clock))
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+	return dates
+}
+
+// startOfWeek returns midnight of the Monday starting the week of t
+func startOfWeek(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d-weekdayIndex(t.Weekday()), 0, 0, 0, 0, t.Location())
+}
+
+// weekdayIndex numbers the days of the week from Monday, as RFC 5545 does by default
+func weekdayIndex(day time.Weekday) int {
+	return (int(day) + 6) % 7
+}
+
+func containsWeekday(days []time.Weekday, day time.Weekday) bool {
+	for _, own := range days {
+		if own == day {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, own := range values {
+		if own == value {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	everyInterval = regexp.MustCompile(`^(?:every )?(\d+|other) (day|week|month|year)s?$`)
+	everyMonthDay = regexp.MustCompile(`^(?:every month on the |monthly on the |every )(\d{1,2})(?:st|nd|rd|th)?(?: of the month)?$`)
+	phraseUnits   = map[string]string{"day": "DAILY", "week": "WEEKLY", "month": "MONTHLY", "year": "YEARLY"}
+	phraseDays    = map[string]string{
+		"monday": "MO", "mon": "MO", "tuesday": "TU", "tue": "TU", "tues": "TU",
+		"wednesday": "WE", "wed": "WE", "thursday": "TH", "thu": "TH", "thurs": "TH",
+		"friday": "FR", "fri": "FR", "saturday": "SA", "sat": "SA", "sunday": "SU", "sun": "SU",
+	}
+)
+
+// ParseRepeat reads a recurrence written as an RRULE or as a common English
+// phrase: daily, weekly, monthly, yearly, weekdays, every 3 days, every other
+// week, every monday, every mon and thu, every other friday, every 15th or
+// every last day of the month
+func ParseRepeat(phrase string) (RRule, error) {
+	text := strings.ToLower(strings.Join(strings.Fields(phrase), " "))
+	if strings.HasPrefix(text, "freq=") || strings.HasPrefix(text, "rrule:") {
+		return ParseRRule(text)
+	}
+
+	rule := RRule{Interval: 1}
+	switch text {
+	case "daily", "every day":
+		rule.Freq = "DAILY"
+	case "weekly", "every week":
+		rule.Freq = "WEEKLY"
+	case "monthly", "every month":
+		rule.Freq = "MONTHLY"
+	case "yearly", "annually", "every year":
+		rule.Freq = "YEARLY"
+	case "weekdays", "every weekday":
+		return ParseRRule("FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR")
+	case "weekends", "every weekend":
+		return ParseRRule("FREQ=WEEKLY;BYDAY=SA,SU")
+	case "every last day of the month", "last day of the month", "monthly on the last day":
+		return ParseRRule("FREQ=MONTHLY;BYMONTHDAY=-1")
+	}
+	if rule.Freq != "" {
+		return rule, nil
+	}
+
+	if match := everyInterval.FindStringSubmatch(text); match != nil {
+		interval := 2
+		if match[1] != "other" {
+			interval, _ = strconv.Atoi(match[1])
+		}
+		return ParseRRule(fmt.Sprintf("FREQ=%s;INTERVAL=%d", phraseUnits[match[2]], interval))
+	}
+	if match := everyMonthDay.FindStringSubmatch(text); match != nil {
+		return ParseRRule("FREQ=MONTHLY;BYMONTHDAY=" + match[1])
+	}
+
+	// every [other] monday[, wednesday and friday]
+	if strings.HasPrefix(text, "every ") {
+		rule, rest := "FREQ=WEEKLY", strings.TrimPrefix(text, "every ")
+		if strings.HasPrefix(rest, "other ") {
+			rule, rest = rule+";INTERVAL=2", strings.TrimPrefix(rest, "other ")
+		}
+		var byDay []string
+		for _, name := range strings.FieldsFunc(strings.ReplaceAll(rest, " and ", ","), func(r rune) bool { return r == ',' || r == ' ' }) {
+			day, ok := phraseDays[strings.TrimSuffix(name, "s")]
+			if !ok {
+				day, ok = phraseDays[name]
+			}
+			if !ok {
+				byDay = nil
+				break
+			}
+			byDay = append(byDay, day)
+		}
+		if len(byDay) > 0 {
+			return ParseRRule(rule + ";BYDAY=" + strings.Join(byDay, ","))
+		}
+	}
+	return RRule{}, fmt.Errorf("cannot understand repeat %q, try daily, weekly, every monday, every 2 weeks, every 15th or an RRULE such as FREQ=WEEKLY;BYDAY=MO", phrase)
+}
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRRuleNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(y int, m time.Month, d, hour int) time.Time { return time.Date(y, m, d, hour, 0, 0, 0, time.UTC) }
+	local := func(y int, m time.Month, d, hour int) time.Time { return time.Date(y, m, d, hour, 0, 0, 0, newYork) }
+
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		want  []time.Time // the occurrences following start, one after the other
+	}{
+		{
+			name:  "daily",
+			rule:  "FREQ=DAILY;INTERVAL=2",
+			start: utc(2024, 12, 30, 9),
+			want:  []time.Time{utc(2025, 1, 1, 9), utc(2025, 1, 3, 9)},
+		},
+		{
+			name:  "weekly on some days",
+			rule:  "FREQ=WEEKLY;BYDAY=MO,TH",
+			start: utc(2024, 10, 14, 9), // a Monday
+			want:  []time.Time{utc(2024, 10, 17, 9), utc(2024, 10, 21, 9), utc(2024, 10, 24, 9)},
+		},
+		{
+			name:  "every other week on some days",
+			rule:  "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH",
+			start: utc(2024, 10, 14, 9),
+			want:  []time.Time{utc(2024, 10, 17, 9), utc(2024, 10, 28, 9), utc(2024, 10, 31, 9)},
+		},
+		{
+			name:  "monthly from the 31st skips shorter months",
+			rule:  "FREQ=MONTHLY",
+			start: utc(2025, 1, 31, 9),
+			want:  []time.Time{utc(2025, 3, 31, 9), utc(2025, 5, 31, 9), utc(2025, 7, 31, 9), utc(2025, 8, 31, 9)},
+		},
+		{
+			name:  "monthly from the 30th skips February only",
+			rule:  "FREQ=MONTHLY",
+			start: utc(2025, 1, 30, 9),
+			want:  []time.Time{utc(2025, 3, 30, 9), utc(2025, 4, 30, 9)},
+		},
+		{
+			name:  "last day of the month",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=-1",
+			start: utc(2024, 1, 31, 9),
+			want:  []time.Time{utc(2024, 2, 29, 9), utc(2024, 3, 31, 9), utc(2024, 4, 30, 9)},
+		},
+		{
+			name:  "several days of the month",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=1,15",
+			start: utc(2025, 1, 15, 9),
+			want:  []time.Time{utc(2025, 2, 1, 9), utc(2025, 2, 15, 9), utc(2025, 3, 1, 9)},
+		},
+		{
+			name:  "yearly",
+			rule:  "FREQ=YEARLY",
+			start: utc(2024, 3, 10, 9),
+			want:  []time.Time{utc(2025, 3, 10, 9), utc(2026, 3, 10, 9)},
+		},
+		{
+			name:  "yearly from a leap day waits for the next leap year",
+			rule:  "FREQ=YEARLY",
+			start: utc(2024, 2, 29, 9),
+			want:  []time.Time{utc(2028, 2, 29, 9), utc(2032, 2, 29, 9)},
+		},
+		{
+			name:  "daily keeps the local time when summer time starts",
+			rule:  "FREQ=DAILY",
+			start: local(2025, 3, 8, 9),
+			want:  []time.Time{local(2025, 3, 9, 9), local(2025, 3, 10, 9)},
+		},
+		{
+			name:  "weekly keeps the local time when summer time ends",
+			rule:  "FREQ=WEEKLY",
+			start: local(2025, 10, 27, 9),
+			want:  []time.Time{local(2025, 11, 3, 9), local(2025, 11, 10, 9)},
+		},
+		{
+			name:  "monthly keeps the local time across summer time",
+			rule:  "FREQ=MONTHLY",
+			start: local(2025, 1, 31, 8),
+			want:  []time.Time{local(2025, 3, 31, 8), local(2025, 5, 31, 8), local(2025, 7, 31, 8)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRRule(tt.rule)
+			if err != nil {
+				t.Fatalf("ParseRRule(%q) failed: %v", tt.rule, err)
+			}
+			after := tt.start
+			for _, want := range tt.want {
+				next, ok := rule.Next(tt.start, after)
+				if !ok {
+					t.Fatalf("Next(%v, %v) ended the rule, want %v", tt.start, after, want)
+				}
+				if !next.Equal(want) {
+					t.Fatalf("Next(%v, %v) = %v, want %v", tt.start, after, next, want)
+				}
+				after = next
+			}
+		})
+	}
+}
+
+func TestRRuleNextDSTInstant(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule, err := ParseRRule("FREQ=DAILY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 09:00 is 14:00 UTC in winter and 13:00 UTC in summer
+	start := time.Date(2025, 3, 8, 14, 0, 0, 0, time.UTC)
+	next, ok := rule.Next(start, start.In(newYork))
+	if want := time.Date(2025, 3, 9, 13, 0, 0, 0, time.UTC); !ok || !next.Equal(want) {
+		t.Errorf("Next = %v, %v, want %v", next, ok, want)
+	}
+}
+
+func TestRRuleNextUntil(t *testing.T) {
+	rule, err := ParseRRule("FREQ=DAILY;UNTIL=20241016")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 10, 15, 9, 0, 0, 0, time.UTC)
+	next, ok := rule.Next(start, start)
+	if !ok || next.Day() != 16 {
+		t.Fatalf("Next = %v, %v, want October 16", next, ok)
+	}
+	if next, ok := rule.Next(start, next); ok {
+		t.Errorf("Next = %v, want the rule to have ended", next)
+	}
+}
+
+func TestParseRRuleErrors(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;BYDAY=MO",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=MONTHLY;COUNT=3",
+		"FREQ=DAILY;UNTIL=tomorrow",
+	} {
+		if rule, err := ParseRRule(value); err == nil {
+			t.Errorf("ParseRRule(%q) = %v, want an error", value, rule)
+		}
+	}
+}
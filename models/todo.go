@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -8,17 +9,122 @@ import (
 
 // Todo represents a task
 type Todo struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Title     string             `bson:"title" json:"title" validate:"required,min=1,max=100"` // Required, min length 1, max length 100
-	Completed bool               `bson:"completed" json:"completed"`
-	UserID    primitive.ObjectID `bson:"user_id" json:"user_id" validate:"required"` // Required User ID
-	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	Title       string              `bson:"title" json:"title" validate:"required,min=1,max=100"`        // Required, min length 1, max length 100
+	Notes       string              `bson:"notes,omitempty" json:"notes,omitempty" validate:"max=20000"` // Optional, Markdown
+	Completed   bool                `bson:"completed" json:"completed"`
+	UserID      primitive.ObjectID  `bson:"user_id" json:"user_id" validate:"required"`       // Required User ID
+	Version     int64               `bson:"version" json:"version"`                           // Counts the changes, sent as the ETag
+	ProjectID   *primitive.ObjectID `bson:"project_id,omitempty" json:"project_id,omitempty"` // Optional, no project means the Inbox
+	ParentID    *primitive.ObjectID `bson:"parent_id,omitempty" json:"parent_id,omitempty"`   // Optional, makes the todo a subtask
+	Priority    Priority            `bson:"priority" json:"priority"`
+	Position    float64             `bson:"position" json:"position"` // Manual order within a priority, lower first
+	Tags        []string            `bson:"tags,omitempty" json:"tags,omitempty"`
+	StartAt     *time.Time          `bson:"start_at,omitempty" json:"start_at,omitempty"`         // Optional, stored in UTC
+	DueAt       *time.Time          `bson:"due_at,omitempty" json:"due_at,omitempty"`             // Optional, stored in UTC
+	Repeat      string              `bson:"repeat,omitempty" json:"repeat,omitempty"`             // Optional RRULE, see RRule
+	RepeatTZ    string              `bson:"repeat_tz,omitempty" json:"repeat_tz,omitempty"`       // Timezone the rule is evaluated in
+	RepeatStart *time.Time          `bson:"repeat_start,omitempty" json:"repeat_start,omitempty"` // Due date the rule was set from, anchors its day of the month
+	SeriesID    *primitive.ObjectID `bson:"series_id,omitempty" json:"series_id,omitempty"`       // First todo of a recurring series
+	Overdue     bool                `bson:"-" json:"overdue"`                                     // Computed, never stored
+	Progress    *Progress           `bson:"-" json:"progress,omitempty"`                          // Computed for todos with subtasks
+	Children    []Todo              `bson:"-" json:"children,omitempty"`                          // Computed, only when fetching a single todo
+	CreatedAt   time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time           `bson:"updated_at" json:"updated_at"`
+	CompletedAt *time.Time          `bson:"completed_at,omitempty" json:"completed_at,omitempty"` // Set while the todo is completed
+	ArchivedAt  *time.Time          `bson:"archived_at,omitempty" json:"archived_at,omitempty"`   // Set once the completed todo is archived
+	DeletedAt   *time.Time          `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`     // Set while the todo is in the trash
+}
+
+// Progress counts the completed subtasks of a todo
+type Progress struct {
+	Done    int    `json:"done"`
+	Total   int    `json:"total"`
+	Summary string `json:"summary"` // e.g. "3/5 done"
+}
+
+// IsOverdue reports whether the todo is still open past its due date
+func (t Todo) IsOverdue(now time.Time) bool {
+	return !t.Completed && t.DueAt != nil && t.DueAt.Before(now)
+}
+
+// CompletionTime returns when the todo was completed. Todos completed before
+// that was recorded fall back to their last update.
+func (t Todo) CompletionTime() time.Time {
+	if t.CompletedAt != nil {
+		return *t.CompletedAt
+	}
+	return t.UpdatedAt
+}
+
+// HasTag reports whether the todo is labelled with tag
+func (t Todo) HasTag(tag string) bool {
+	for _, own := range t.Tags {
+		if own == tag {
+			return true
+		}
+	}
+	return false
 }
 
 // TodoUpdate struct is used to update todo items
 type TodoUpdate struct {
-	Title     string    `json:"title,omitempty"`     // String, optional
-	Completed *bool     `json:"completed,omitempty"` // Pointer to bool, optional
-	UpdatedAt time.Time `json:"updated_at"`
+	Title     string       `json:"title,omitempty"`     // String, optional
+	Notes     *string      `json:"notes,omitempty"`     // Optional, empty clears them
+	Completed *bool        `json:"completed,omitempty"` // Pointer to bool, optional
+	Priority  *Priority    `json:"priority,omitempty"`  // Optional
+	Tags      *[]string    `json:"tags,omitempty"`      // Optional, replaces all tags
+	ProjectID OptionalID   `json:"project_id"`          // Optional, null moves it to the Inbox
+	ParentID  OptionalID   `json:"parent_id"`           // Optional, null turns a subtask into a top level todo
+	StartAt   OptionalTime `json:"start_at"`            // Optional, null clears it
+	DueAt     OptionalTime `json:"due_at"`              // Optional, null clears it
+	Repeat    *string      `json:"repeat,omitempty"`    // Optional, empty stops the todo from repeating
+	RepeatTZ  *string      `json:"repeat_tz,omitempty"` // Optional
+	Archived  *bool        `json:"archived,omitempty"`  // Optional, only completed todos can be archived
+	Version   *int64       `json:"version,omitempty"`   // Optional, the update fails unless the todo is still at this version
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// OptionalTime is a JSON timestamp that tells a missing field (Set is false)
+// apart from an explicit null (Set is true and Time is nil)
+type OptionalTime struct {
+	Set  bool
+	Time *time.Time
+}
+
+// UnmarshalJSON is only called when the field is present in the document
+func (o *OptionalTime) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(data) == "null" {
+		o.Time = nil
+		return nil
+	}
+	var t time.Time
+	if err := json.Unmarshal(data, &t); err != nil {
+		return err
+	}
+	o.Time = &t
+	return nil
+}
+
+// OptionalID is a JSON ObjectID that tells a missing field (Set is false)
+// apart from an explicit null (Set is true and ID is nil)
+type OptionalID struct {
+	Set bool
+	ID  *primitive.ObjectID
+}
+
+// UnmarshalJSON is only called when the field is present in the document
+func (o *OptionalID) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(data) == "null" {
+		o.ID = nil
+		return nil
+	}
+	var id primitive.ObjectID
+	if err := json.Unmarshal(data, &id); err != nil {
+		return err
+	}
+	o.ID = &id
+	return nil
 }
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Token is a login kept server side, one per session. The access tokens
+// issued for it name it in their sid claim, so deleting it revokes them. Its
+// refresh token is only stored as a hash and replaced on every refresh.
+type Token struct {
+	ID          string    `bson:"token" json:"id"` // Session ID, the sid claim of its access tokens
+	UserID      string    `bson:"user_id" json:"user_id"`
+	RefreshHash string    `bson:"refresh_hash" json:"-"`        // SHA-256 of the current refresh token
+	UsedHashes  []string  `bson:"used_hashes" json:"-"`         // SHA-256 of the refresh tokens already traded in, oldest first
+	Exp         int64     `bson:"exp" json:"exp"`               // Unix time the refresh token expires at
+	UserAgent   string    `bson:"user_agent" json:"user_agent"` // Device the session was opened from
+	IP          string    `bson:"ip" json:"ip"`                 // Address the session was last used from
+	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
+	LastUsedAt  time.Time `bson:"last_used_at" json:"last_used_at"`
+	Current     bool      `bson:"-" json:"current"` // Computed, whether the request came with this session
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SavedView is a named todo listing of a user: a filter expression and a sort
+// run together. Built-in views are not stored, they have a Key such as
+// "today" in place of an ID.
+type SavedView struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Key       string             `bson:"-" json:"key,omitempty"`
+	Name      string             `bson:"name" json:"name" validate:"required,min=1,max=100"`
+	Filter    string             `bson:"filter" json:"filter" validate:"max=1000"`
+	Sort      string             `bson:"sort,omitempty" json:"sort,omitempty"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	CreatedAt *time.Time         `bson:"created_at" json:"created_at,omitempty"`
+	UpdatedAt *time.Time         `bson:"updated_at" json:"updated_at,omitempty"`
+}
+
+// SavedViewUpdate struct is used to rename a view or change its query
+type SavedViewUpdate struct {
+	Name      string    `json:"name,omitempty" validate:"max=100"` // Optional
+	Filter    *string   `json:"filter,omitempty"`                  // Optional
+	Sort      *string   `json:"sort,omitempty"`                    // Optional
+	UpdatedAt time.Time `json:"updated_at"`
+}
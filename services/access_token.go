@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"todo-cli/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AccessTokenPrefix starts every personal access token, which tells them
+// apart from the JWTs of sessions and makes them easy to find in leaked code
+const AccessTokenPrefix = "todo_pat_"
+
+var (
+	ErrInvalidAccessToken = errors.New("invalid personal access token")
+	ErrAccessTokenExpired = errors.New("personal access token expired")
+)
+
+// AccessTokenError is returned when a personal access token cannot be
+// created as asked
+type AccessTokenError struct {
+	Reason string
+}
+
+func (e *AccessTokenError) Error() string {
+	return e.Reason
+}
+
+// NewAccessToken is a personal access token just created, the only time the
+// token itself is known
+type NewAccessToken struct {
+	models.AccessToken
+	Token string `json:"token"`
+}
+
+// IsAccessToken reports whether a bearer token is a personal access token
+// rather than the JWT of a session
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, AccessTokenPrefix)
+}
+
+// CreateAccessToken gives the user a new personal access token granting the
+// scopes, which never expires unless expiresAt is set
+func (s *UserService) CreateAccessToken(userId primitive.ObjectID, name string, scopes []string, expiresAt *time.Time) (NewAccessToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return NewAccessToken{}, &AccessTokenError{"a name of up to 100 characters is required"}
+	}
+	if len(scopes) == 0 {
+		return NewAccessToken{}, &AccessTokenError{fmt.Sprintf("at least one scope is required, one of %s", strings.Join(models.Scopes, ", "))}
+	}
+	for _, scope := range scopes {
+		if !knownScope(scope) {
+			return NewAccessToken{}, &AccessTokenError{fmt.Sprintf("unknown scope %q, expected one of %s", scope, strings.Join(models.Scopes, ", "))}
+		}
+	}
+	now := time.Now().UTC()
+	if expiresAt != nil && !expiresAt.After(now) {
+		return NewAccessToken{}, &AccessTokenError{"expires_at must be in the future"}
+	}
+
+	existing, err := s.tokens.FindAccessTokens(ctx, userId)
+	if err != nil {
+		return NewAccessToken{}, err
+	}
+	for _, token := range existing {
+		if strings.EqualFold(token.Name, name) {
+			return NewAccessToken{}, &AccessTokenError{fmt.Sprintf("a token named %q already exists", token.Name)}
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return NewAccessToken{}, err
+	}
+	token := models.AccessToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    userId,
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: now,
+	}
+	if expiresAt != nil {
+		utc := expiresAt.UTC()
+		token.ExpiresAt = &utc
+	}
+	plain := AccessTokenPrefix + token.ID.Hex() + "." + base64.RawURLEncoding.EncodeToString(secret)
+	token.Hash = hashToken(plain)
+	if err := s.tokens.InsertAccessToken(ctx, token); err != nil {
+		return NewAccessToken{}, err
+	}
+	return NewAccessToken{AccessToken: token, Token: plain}, nil
+}
+
+func knownScope(scope string) bool {
+	for _, known := range models.Scopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ListAccessTokens returns the personal access tokens of the user, expired
+// ones included, oldest first
+func (s *UserService) ListAccessTokens(userId primitive.ObjectID) ([]models.AccessToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tokens, err := s.tokens.FindAccessTokens(ctx, userId)
+	if tokens == nil {
+		tokens = []models.AccessToken{}
+	}
+	return tokens, err
+}
+
+// RevokeAccessToken deletes a personal access token of the user, it stops
+// working at once
+func (s *UserService) RevokeAccessToken(userId primitive.ObjectID, id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	return s.tokens.DeleteAccessToken(ctx, objID, userId)
+}
+
+// AccessTokenOf returns the personal access token a request came with
+func AccessTokenOf(ctx context.Context, tokens TokenStore, plain string) (models.AccessToken, error) {
+	id, _, ok := strings.Cut(strings.TrimPrefix(plain, AccessTokenPrefix), ".")
+	objID, err := primitive.ObjectIDFromHex(id)
+	if !ok || !IsAccessToken(plain) || err != nil {
+		return models.AccessToken{}, ErrInvalidAccessToken
+	}
+	token, err := tokens.FindAccessToken(ctx, objID)
+	if errors.Is(err, ErrNotFound) {
+		return models.AccessToken{}, ErrInvalidAccessToken
+	}
+	if err != nil {
+		return models.AccessToken{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(plain)), []byte(token.Hash)) != 1 {
+		return models.AccessToken{}, ErrInvalidAccessToken
+	}
+	if token.Expired(time.Now()) {
+		return models.AccessToken{}, ErrAccessTokenExpired
+	}
+	return token, nil
+}
+
+// TouchAccessToken records that a personal access token was used, at most
+// once per minute
+func TouchAccessToken(ctx context.Context, tokens TokenStore, token models.AccessToken) error {
+	now := time.Now().UTC()
+	if token.LastUsedAt != nil && now.Sub(*token.LastUsedAt) < sessionTouchInterval {
+		return nil
+	}
+	token.LastUsedAt = &now
+	// Revoked since it was looked up
+	err := tokens.ReplaceAccessToken(ctx, token)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
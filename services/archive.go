@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"todo-cli/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrArchiveOpen is returned when archiving a todo that is not completed
+var ErrArchiveOpen = errors.New("only completed todos can be archived")
+
+// Archived todo filters understood by TodoFilter.Archived, by default
+// archived todos are left out
+const (
+	ArchivedOnly = "only"
+	ArchivedAll  = "all"
+)
+
+// autoArchiveInterval is how often completed todos are checked for archiving
+const autoArchiveInterval = time.Hour
+
+// matchArchived reports whether a todo passes the Archived filter
+func matchArchived(todo models.Todo, archived string) bool {
+	switch archived {
+	case ArchivedAll:
+		return true
+	case ArchivedOnly:
+		return todo.ArchivedAt != nil
+	}
+	return todo.ArchivedAt == nil
+}
+
+// archivedQuery returns the Archived condition of a TodoQuery for the
+// Archived filter, nil when archived todos are taken as well
+func archivedQuery(archived string) *bool {
+	var only bool
+	switch archived {
+	case ArchivedAll:
+		return nil
+	case ArchivedOnly:
+		only = true
+	}
+	return &only
+}
+
+// setCompletion records when a todo was completed after an update and
+// archives or unarchives it on request. Reopening a todo unarchives it.
+func setCompletion(todo *models.Todo, wasCompleted bool, archived *bool) error {
+	switch {
+	case todo.Completed && !wasCompleted:
+		completedAt := todo.UpdatedAt
+		todo.CompletedAt = &completedAt
+	case !todo.Completed:
+		todo.CompletedAt = nil
+		todo.ArchivedAt = nil
+	}
+
+	if archived == nil {
+		return nil
+	}
+	if !*archived {
+		todo.ArchivedAt = nil
+		return nil
+	}
+	if !todo.Completed {
+		return ErrArchiveOpen
+	}
+	if todo.ArchivedAt == nil {
+		archivedAt := todo.UpdatedAt
+		todo.ArchivedAt = &archivedAt
+	}
+	return nil
+}
+
+// ArchiveCompleted archives the completed todos of the user that were
+// completed at least olderThan ago and returns how many there were
+func (s *TodoService) ArchiveCompleted(userId primitive.ObjectID, olderThan time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	todos, err := s.store.FindTodos(ctx, userId, TodoQuery{})
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	archived := 0
+	for _, todo := range todos {
+		if !todo.Completed || todo.ArchivedAt != nil || todo.CompletionTime().After(now.Add(-olderThan)) {
+			continue
+		}
+		todo.ArchivedAt = &now
+		todo.Version++
+		if err := s.store.ReplaceTodo(ctx, todo, todo.Version-1); err != nil {
+			return archived, err
+		}
+		archived++
+	}
+	return archived, nil
+}
+
+// AutoArchiveAfter returns how long after their completion todos are archived
+// automatically, from the AUTO_ARCHIVE_DAYS environment variable. 0, the
+// default, leaves archiving to the user.
+func AutoArchiveAfter() time.Duration {
+	days := os.Getenv("AUTO_ARCHIVE_DAYS")
+	if days == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(days)
+	if err != nil || n < 0 {
+		log.Printf("Invalid AUTO_ARCHIVE_DAYS %q, completed todos are not archived automatically", days)
+		return 0
+	}
+	return time.Duration(n) * 24 * time.Hour
+}
+
+// RunAutoArchive archives the todos completed more than after ago, now and
+// then every hour until ctx is done, and records that in their history
+func RunAutoArchive(ctx context.Context, todos TodoStore, events EventStore, after time.Duration) {
+	ticker := time.NewTicker(autoArchiveInterval)
+	defer ticker.Stop()
+
+	for {
+		archiveCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		now := time.Now()
+		archived, err := todos.ArchiveTodos(archiveCtx, now.Add(-after), now)
+		if err != nil {
+			log.Printf("Failed to archive completed todos: %v", err)
+		} else if len(archived) > 0 {
+			recordArchived(archiveCtx, events, archived, now)
+			log.Printf("Archived %d completed todos", len(archived))
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"todo-cli/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxBulkOperations is the most operations one bulk request may carry
+const MaxBulkOperations = 500
+
+// Operations of a bulk request
+const (
+	BulkCreate   = "create"
+	BulkUpdate   = "update"
+	BulkDelete   = "delete"
+	BulkComplete = "complete"
+)
+
+// Outcomes of the operations of a bulk request
+const (
+	BulkOK         = "ok"
+	BulkFailed     = "failed"
+	BulkRolledBack = "rolled_back" // applied, then rolled back because a later operation failed, see Bulk
+	BulkSkipped    = "skipped"     // not tried because an earlier operation failed
+)
+
+// BulkOperation is one change of a bulk request
+type BulkOperation struct {
+	Op     string            // one of BulkCreate, BulkUpdate, BulkDelete or BulkComplete
+	ID     string            // the todo to update, delete or complete
+	Todo   models.Todo       // the todo to create
+	Update models.TodoUpdate // the fields to update
+	// Version makes a delete or complete fail unless the todo is still at
+	// it, updates carry theirs in Update
+	Version *int64
+}
+
+// BulkResult is the outcome of one operation of a bulk request
+type BulkResult struct {
+	Op     string       `json:"op"`
+	ID     string       `json:"id,omitempty"`
+	Status string       `json:"status"`
+	Error  string       `json:"error,omitempty"`
+	Todo   *models.Todo `json:"todo,omitempty"` // the created or updated todo
+}
+
+// Bulk applies the operations in order and reports the outcome of each.
+//
+// When atomic is set the operations run as one transaction: the first
+// failure rolls back every operation before it and skips the rest. Backends
+// without transactions reject atomic requests with ErrNoTransactions before
+// applying any operation.
+func (s *TodoService) Bulk(userId primitive.ObjectID, ops []BulkOperation, atomic bool) ([]BulkResult, error) {
+	results := make([]BulkResult, len(ops))
+	if !atomic {
+		for i, op := range ops {
+			results[i] = s.runBulk(userId, op)
+		}
+		return results, nil
+	}
+
+	failed := -1
+	err := s.inTransaction(func(tx *TodoService) error {
+		failed = -1
+		for i, op := range ops {
+			results[i] = BulkResult{Op: op.Op, ID: op.ID, Status: BulkSkipped}
+		}
+		for i, op := range ops {
+			results[i] = tx.runBulk(userId, op)
+			if results[i].Status == BulkFailed {
+				failed = i
+				return errBulkFailed
+			}
+		}
+		return nil
+	})
+	if failed < 0 {
+		return results, err
+	}
+	for i := range results[:failed] {
+		results[i].Status = BulkRolledBack
+		results[i].Todo = nil
+	}
+	return results, nil
+}
+
+// errBulkFailed rolls back the transaction of an atomic bulk request
+var errBulkFailed = errors.New("bulk operation failed")
+
+// runBulk applies one operation and reports its outcome
+func (s *TodoService) runBulk(userId primitive.ObjectID, op BulkOperation) BulkResult {
+	result := BulkResult{Op: op.Op, ID: op.ID, Status: BulkOK}
+	todo, err := s.applyBulk(userId, op)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		result.Status, result.Error = BulkFailed, "todo not found"
+	case err != nil:
+		result.Status, result.Error = BulkFailed, err.Error()
+	case todo != nil:
+		result.ID = todo.ID.Hex()
+		result.Todo = todo
+	}
+	return result
+}
+
+func (s *TodoService) applyBulk(userId primitive.ObjectID, op BulkOperation) (*models.Todo, error) {
+	var todo models.Todo
+	var err error
+	switch op.Op {
+	case BulkCreate:
+		op.Todo.UserID = userId
+		todo, err = s.AddTodo(op.Todo)
+	case BulkUpdate:
+		todo, err = s.UpdateTodo(op.ID, userId, op.Update)
+	case BulkComplete:
+		completed := true
+		todo, err = s.UpdateTodo(op.ID, userId, models.TodoUpdate{Completed: &completed, Version: op.Version, UpdatedAt: time.Now()})
+	case BulkDelete:
+		return nil, s.DeleteTodo(op.ID, userId, op.Version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
@@ -0,0 +1,144 @@
+package services_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"todo-cli/models"
+	"todo-cli/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// bulk runs a bulk request the way the API does, as one undoable operation
+func bulk(t *testing.T, todos *services.TodoService, userID primitive.ObjectID, ops []services.BulkOperation, atomic bool) ([]services.BulkResult, error) {
+	t.Helper()
+	var results []services.BulkResult
+	err := todos.Undoable(userID, "bulk change", func(todos *services.TodoService) (err error) {
+		results, err = todos.Bulk(userID, ops, atomic)
+		return err
+	})
+	return results, err
+}
+
+func statuses(results []services.BulkResult) []string {
+	var got []string
+	for _, result := range results {
+		got = append(got, result.Status)
+	}
+	return got
+}
+
+func TestBulkAtomic(t *testing.T) {
+	todos := services.NewTodoService(openStores(t))
+	userID := primitive.NewObjectID()
+	added := addTodos(t, todos, userID, models.Todo{Title: "report"}, models.Todo{Title: "taxes"})
+
+	results, err := bulk(t, todos, userID, []services.BulkOperation{
+		{Op: services.BulkComplete, ID: added[0].ID.Hex()},
+		{Op: services.BulkCreate, Todo: models.Todo{ID: primitive.NewObjectID(), Title: "groceries", CreatedAt: time.Now(), UpdatedAt: time.Now()}},
+		{Op: services.BulkDelete, ID: primitive.NewObjectID().Hex()},
+		{Op: services.BulkDelete, ID: added[1].ID.Hex()},
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{services.BulkRolledBack, services.BulkRolledBack, services.BulkFailed, services.BulkSkipped}
+	if got := statuses(results); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Bulk returned %v, want %v", got, want)
+	}
+
+	page, err := todos.GetTodos(userID, services.TodoFilter{}, services.PageRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(page.Todos); !reflect.DeepEqual(got, []string{"report", "taxes"}) {
+		t.Errorf("after the failed request the user has %v, want report and taxes", got)
+	}
+	for _, todo := range page.Todos {
+		if todo.Completed || todo.Version != 1 {
+			t.Errorf("%q was changed to version %d by the failed request", todo.Title, todo.Version)
+		}
+		history, err := todos.GetHistory(todo.ID.Hex(), userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 1 {
+			t.Errorf("%q has %d events, the rolled back ones were kept", todo.Title, len(history))
+		}
+	}
+	if _, err := todos.Undo(userID); !errors.Is(err, services.ErrNothingToUndo) {
+		t.Errorf("Undo after the failed request returned %v, want ErrNothingToUndo", err)
+	}
+}
+
+func TestBulkAtomicUndo(t *testing.T) {
+	todos := services.NewTodoService(openStores(t))
+	userID := primitive.NewObjectID()
+	added := addTodos(t, todos, userID, models.Todo{Title: "report"}, models.Todo{Title: "taxes"})
+
+	results, err := bulk(t, todos, userID, []services.BulkOperation{
+		{Op: services.BulkComplete, ID: added[0].ID.Hex()},
+		{Op: services.BulkDelete, ID: added[1].ID.Hex()},
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := statuses(results); !reflect.DeepEqual(got, []string{services.BulkOK, services.BulkOK}) {
+		t.Fatalf("Bulk returned %v, want both ok", got)
+	}
+	if op, err := todos.Undo(userID); err != nil || len(op.Changes) != 2 {
+		t.Fatalf("Undo returned %d changes, %v, want the 2 of the request", len(op.Changes), err)
+	}
+	page, err := todos.GetTodos(userID, services.TodoFilter{}, services.PageRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(page.Todos); !reflect.DeepEqual(got, []string{"report", "taxes"}) || page.Todos[0].Completed {
+		t.Errorf("after undoing the request the user has %v, want report and taxes open", got)
+	}
+}
+
+func TestBulkNotAtomic(t *testing.T) {
+	todos := services.NewTodoService(openStores(t))
+	userID := primitive.NewObjectID()
+	added := addTodos(t, todos, userID, models.Todo{Title: "report"}, models.Todo{Title: "taxes"})
+
+	results, err := bulk(t, todos, userID, []services.BulkOperation{
+		{Op: services.BulkComplete, ID: added[0].ID.Hex()},
+		{Op: services.BulkDelete, ID: primitive.NewObjectID().Hex()},
+		{Op: services.BulkDelete, ID: added[1].ID.Hex()},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{services.BulkOK, services.BulkFailed, services.BulkOK}
+	if got := statuses(results); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Bulk returned %v, want %v", got, want)
+	}
+	if results[1].Error != "todo not found" {
+		t.Errorf("the failed operation reports %q", results[1].Error)
+	}
+}
+
+func TestBulkAtomicWithoutTransactions(t *testing.T) {
+	stores := openStores(t)
+	stores.Transactions = nil
+	todos := services.NewTodoService(stores)
+	userID := primitive.NewObjectID()
+	added := addTodos(t, todos, userID, models.Todo{Title: "report"})
+
+	_, err := bulk(t, todos, userID, []services.BulkOperation{{Op: services.BulkComplete, ID: added[0].ID.Hex()}}, true)
+	if !errors.Is(err, services.ErrNoTransactions) {
+		t.Fatalf("an atomic request returned %v, want ErrNoTransactions", err)
+	}
+	stored, err := todos.GetTodoByID(added[0].ID.Hex(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Completed {
+		t.Errorf("the rejected request completed the todo")
+	}
+}
@@ -0,0 +1,653 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"todo-cli/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FilterSyntaxError is returned by ParseFilterExpr, Column counts characters
+// of the expression from 1
+type FilterSyntaxError struct {
+	Column  int
+	Message string
+}
+
+func (e *FilterSyntaxError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Column, e.Message)
+}
+
+// FilterExpr is a parsed filter expression, see ParseFilterExpr
+type FilterExpr interface {
+	match(todo models.Todo, env filterEnv) bool
+}
+
+// filterEnv is what a filter expression is evaluated against besides the todo
+type filterEnv struct {
+	now      time.Time
+	location *time.Location
+	projects map[primitive.ObjectID]string // project names by ID
+}
+
+type (
+	andExpr   struct{ left, right FilterExpr }
+	orExpr    struct{ left, right FilterExpr }
+	notExpr   struct{ expr FilterExpr }
+	predicate func(todo models.Todo, env filterEnv) bool
+)
+
+func (e andExpr) match(todo models.Todo, env filterEnv) bool {
+	return e.left.match(todo, env) && e.right.match(todo, env)
+}
+
+func (e orExpr) match(todo models.Todo, env filterEnv) bool {
+	return e.left.match(todo, env) || e.right.match(todo, env)
+}
+
+func (e notExpr) match(todo models.Todo, env filterEnv) bool {
+	return !e.expr.match(todo, env)
+}
+
+func (p predicate) match(todo models.Todo, env filterEnv) bool {
+	return p(todo, env)
+}
+
+// storeCondition is a condition a store can check itself, narrow adds it to
+// the query the todos are fetched with
+type storeCondition interface {
+	narrow(query *TodoQuery, env filterEnv)
+}
+
+type (
+	tagCondition     string
+	doneCondition    bool
+	projectCondition struct {
+		inbox bool
+		id    *primitive.ObjectID
+		name  string
+	}
+)
+
+func (c tagCondition) match(todo models.Todo, env filterEnv) bool {
+	return todo.HasTag(string(c))
+}
+
+func (c tagCondition) narrow(query *TodoQuery, env filterEnv) {
+	// The tags of the query may be shared with the filter it came from
+	query.Tags = append(query.Tags[:len(query.Tags):len(query.Tags)], string(c))
+}
+
+func (c doneCondition) match(todo models.Todo, env filterEnv) bool {
+	return todo.Completed == bool(c)
+}
+
+func (c doneCondition) narrow(query *TodoQuery, env filterEnv) {
+	if query.Completed == nil {
+		done := bool(c)
+		query.Completed = &done
+	}
+}
+
+func (c projectCondition) match(todo models.Todo, env filterEnv) bool {
+	switch {
+	case c.inbox:
+		return todo.ProjectID == nil
+	case c.id != nil:
+		return todo.ProjectID != nil && *todo.ProjectID == *c.id
+	}
+	return todo.ProjectID != nil && strings.EqualFold(env.projects[*todo.ProjectID], c.name)
+}
+
+// narrow looks a project name up among the projects of the user, a name
+// more than one of them has is left to match
+func (c projectCondition) narrow(query *TodoQuery, env filterEnv) {
+	if c.inbox {
+		query.Inbox = true
+		return
+	}
+	id := c.id
+	if id == nil {
+		for projectID, name := range env.projects {
+			if !strings.EqualFold(name, c.name) {
+				continue
+			}
+			if id != nil {
+				return
+			}
+			projectID := projectID
+			id = &projectID
+		}
+	}
+	if id != nil && query.Project == nil {
+		query.Project = id
+	}
+}
+
+// narrowQuery adds the conditions every todo passing expr must pass to
+// query, as far as the store can check them. Conditions under OR or NOT
+// are left to match.
+func narrowQuery(expr FilterExpr, env filterEnv, query *TodoQuery) {
+	switch e := expr.(type) {
+	case andExpr:
+		narrowQuery(e.left, env, query)
+		narrowQuery(e.right, env, query)
+	case storeCondition:
+		e.narrow(query, env)
+	}
+}
+
+// ParseFilterExpr parses a filter expression such as
+//
+//	tag:work AND (priority>=high OR due<today) AND NOT done
+//	due<7d tag:work !done
+//
+// Conditions next to each other must all hold, AND, OR, NOT and parentheses
+// combine them as usual, with ! or - as short forms of NOT. A condition is
+//
+//	tag:name  project:name|id|inbox  title:text  notes:text
+//	priority (none, low, medium, high or urgent)
+//	due, start, created, updated compared with a day: today, tomorrow,
+//	    yesterday, 3d or -2w from today, or YYYY-MM-DD
+//	age, whole days since the todo was created, compared with 30, 30d or 4w
+//	done:true|false  is:done|open|overdue|recurring|subtask|archived
+//	has:due|start|notes|tags|project|parent
+//	done, open, overdue, recurring or archived on their own
+//	any other word or "quoted phrase", found in the title or notes
+//
+// Fields compare with :, =, !=, <, <=, > and >=, where : and = mean the same.
+func ParseFilterExpr(expr string) (FilterExpr, error) {
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	parsed, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.kind != tokEOF {
+		if next.kind == tokRParen {
+			return nil, p.errorAt(next, "unexpected ), there is no ( to close")
+		}
+		return nil, p.errorAt(next, fmt.Sprintf("unexpected %q", next.text))
+	}
+	return parsed, nil
+}
+
+type filterTokenKind int
+
+const (
+	tokEOF filterTokenKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokNot
+	tokAnd
+	tokOr
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+	col  int
+}
+
+// lexFilter splits an expression into tokens. The value after an operator is
+// read up to the next space or parenthesis, so dates and negative offsets
+// such as 2024-10-01 and -3d stay in one piece.
+func lexFilter(expr string) ([]filterToken, error) {
+	runes := []rune(expr)
+	var tokens []filterToken
+	afterOp := false
+	isOpStart := func(i int) bool {
+		switch runes[i] {
+		case ':', '<', '>', '=':
+			return true
+		case '!':
+			return i+1 < len(runes) && runes[i+1] == '='
+		}
+		return false
+	}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		col := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '(':
+			tokens = append(tokens, filterToken{tokLParen, "(", col})
+			i++
+		case r == ')':
+			tokens = append(tokens, filterToken{tokRParen, ")", col})
+			i++
+		case r == '"':
+			var text strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				text.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, &FilterSyntaxError{col, "unterminated quoted string"}
+			}
+			i++
+			tokens = append(tokens, filterToken{tokString, text.String(), col})
+		case afterOp:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' {
+				i++
+			}
+			tokens = append(tokens, filterToken{tokWord, string(runes[start:i]), col})
+		case isOpStart(i):
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' && r != ':' && r != '=' {
+				op += "="
+			}
+			i += len(op)
+			tokens = append(tokens, filterToken{tokOp, op, col})
+			afterOp = true
+			continue
+		case r == '!' || (r == '-' && i+1 < len(runes) && (unicode.IsLetter(runes[i+1]) || runes[i+1] == '(' || runes[i+1] == '"')):
+			tokens = append(tokens, filterToken{tokNot, string(r), col})
+			i++
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune(`()"`, runes[i]) && !isOpStart(i) {
+				i++
+			}
+			if i == start {
+				return nil, &FilterSyntaxError{col, fmt.Sprintf("unexpected %q", string(r))}
+			}
+			word := string(runes[start:i])
+			kind := tokWord
+			switch strings.ToUpper(word) {
+			case "AND":
+				kind = tokAnd
+			case "OR":
+				kind = tokOr
+			case "NOT":
+				kind = tokNot
+			}
+			tokens = append(tokens, filterToken{kind, word, col})
+		}
+		afterOp = false
+	}
+	return append(tokens, filterToken{tokEOF, "", len(runes) + 1}), nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() filterToken { return p.tokens[p.pos] }
+
+func (p *filterParser) next() filterToken {
+	token := p.tokens[p.pos]
+	if token.kind != tokEOF {
+		p.pos++
+	}
+	return token
+}
+
+func (p *filterParser) errorAt(token filterToken, message string) error {
+	return &FilterSyntaxError{Column: token.col, Message: message}
+}
+
+func (p *filterParser) parseOr() (FilterExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (FilterExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek().kind {
+		case tokAnd:
+			p.next()
+		case tokWord, tokString, tokNot, tokLParen:
+			// Conditions next to each other are joined by AND
+		default:
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+}
+
+func (p *filterParser) parseUnary() (FilterExpr, error) {
+	if p.peek().kind == tokNot {
+		p.next()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *filterParser) parsePrimary() (FilterExpr, error) {
+	token := p.next()
+	switch token.kind {
+	case tokLParen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.peek(); closing.kind != tokRParen {
+			return nil, p.errorAt(closing, fmt.Sprintf("expected ) to close the ( at column %d", token.col))
+		}
+		p.next()
+		return expr, nil
+	case tokString:
+		return textPredicate(token.text, true, true), nil
+	case tokWord:
+		if p.peek().kind == tokOp {
+			return p.parseCondition(token)
+		}
+		return p.bareWord(token), nil
+	case tokEOF:
+		return nil, p.errorAt(token, "unexpected end of filter, expected a condition")
+	case tokOp:
+		return nil, p.errorAt(token, fmt.Sprintf("expected a field name before %s", token.text))
+	}
+	return nil, p.errorAt(token, fmt.Sprintf("unexpected %q, expected a condition", token.text))
+}
+
+// bareWord is a word on its own: one of the status words or text to find
+func (p *filterParser) bareWord(token filterToken) FilterExpr {
+	switch strings.ToLower(token.text) {
+	case "done", "completed":
+		return doneCondition(true)
+	case "open":
+		return doneCondition(false)
+	case "overdue":
+		return predicate(func(todo models.Todo, env filterEnv) bool { return todo.IsOverdue(env.now) })
+	case "recurring":
+		return predicate(func(todo models.Todo, env filterEnv) bool { return todo.Repeat != "" })
+	case "archived":
+		return predicate(func(todo models.Todo, env filterEnv) bool { return todo.ArchivedAt != nil })
+	}
+	return textPredicate(token.text, true, true)
+}
+
+// textPredicate matches todos containing text in their title and/or notes, ignoring case
+func textPredicate(text string, title, notes bool) predicate {
+	text = strings.ToLower(text)
+	return func(todo models.Todo, env filterEnv) bool {
+		return (title && strings.Contains(strings.ToLower(todo.Title), text)) ||
+			(notes && strings.Contains(strings.ToLower(todo.Notes), text))
+	}
+}
+
+// parseCondition parses field op value, field being the token just read
+func (p *filterParser) parseCondition(field filterToken) (FilterExpr, error) {
+	op := p.next()
+	value := p.next()
+	if value.kind != tokWord && value.kind != tokString {
+		return nil, &FilterSyntaxError{Column: op.col + len([]rune(op.text)), Message: fmt.Sprintf("expected a value after %s%s", field.text, op.text)}
+	}
+	if op.text == "=" {
+		op.text = ":"
+	}
+
+	name := strings.ToLower(field.text)
+	allowed := ":!="
+	switch name {
+	case "priority", "due", "start", "created", "updated", "age":
+		allowed = ":!=<<=>>="
+	case "is", "has":
+		allowed = ":"
+	case "tag", "project", "title", "notes", "done", "completed":
+	default:
+		return nil, p.errorAt(field, fmt.Sprintf("unknown field %q, expected tag, project, title, notes, priority, due, start, created, updated, age, done, is or has", field.text))
+	}
+	if !containsOp(allowed, op.text) {
+		return nil, p.errorAt(op, fmt.Sprintf("%s cannot be compared with %s", name, op.text))
+	}
+
+	var cond FilterExpr
+	switch name {
+	case "tag":
+		cond = tagCondition(value.text)
+	case "project":
+		cond = projectPredicate(value.text)
+	case "title":
+		cond = textPredicate(value.text, true, false)
+	case "notes":
+		cond = textPredicate(value.text, false, true)
+	case "done", "completed":
+		done, err := strconv.ParseBool(strings.ToLower(value.text))
+		if err != nil {
+			return nil, p.errorAt(value, fmt.Sprintf("invalid %s value %q, expected true or false", name, value.text))
+		}
+		cond = doneCondition(done)
+	case "priority":
+		priority, err := models.ParsePriority(value.text)
+		if err != nil {
+			return nil, p.errorAt(value, err.Error())
+		}
+		cond = predicate(func(todo models.Todo, env filterEnv) bool {
+			return compareWith(op.text, compareInt(int(todo.Priority), int(priority)))
+		})
+	case "due", "start", "created", "updated":
+		day, err := parseFilterDay(value.text)
+		if err != nil {
+			return nil, p.errorAt(value, err.Error())
+		}
+		cond = datePredicate(name, op.text, day)
+	case "age":
+		match := filterAge.FindStringSubmatch(strings.ToLower(value.text))
+		if match == nil {
+			return nil, p.errorAt(value, fmt.Sprintf("invalid age %q, use a number of days such as 30, 30d or 4w", value.text))
+		}
+		days, _ := strconv.Atoi(match[1])
+		if match[2] == "w" {
+			days *= 7
+		}
+		cond = predicate(func(todo models.Todo, env filterEnv) bool {
+			age := int(env.now.Sub(todo.CreatedAt) / (24 * time.Hour))
+			return compareWith(op.text, compareInt(age, days))
+		})
+	case "is":
+		var err error
+		if cond, err = p.isPredicate(value); err != nil {
+			return nil, err
+		}
+	case "has":
+		var err error
+		if cond, err = p.hasPredicate(value); err != nil {
+			return nil, err
+		}
+	}
+
+	if op.text == "!=" {
+		return notExpr{cond}, nil
+	}
+	return cond, nil
+}
+
+func containsOp(allowed, op string) bool {
+	for _, candidate := range []string{":", "!=", "<=", ">=", "<", ">"} {
+		if candidate == op {
+			return strings.Contains(allowed, op)
+		}
+	}
+	return false
+}
+
+// compareWith applies a comparison operator to the result of a three-way compare
+func compareWith(op string, cmp int) bool {
+	switch op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return cmp == 0
+}
+
+// projectPredicate matches the inbox, a project ID or a project name
+func projectPredicate(value string) projectCondition {
+	if strings.EqualFold(value, "inbox") {
+		return projectCondition{inbox: true}
+	}
+	if id, err := primitive.ObjectIDFromHex(value); err == nil {
+		return projectCondition{id: &id}
+	}
+	return projectCondition{name: value}
+}
+
+func (p *filterParser) isPredicate(value filterToken) (FilterExpr, error) {
+	switch strings.ToLower(value.text) {
+	case "done", "completed":
+		return doneCondition(true), nil
+	case "open":
+		return doneCondition(false), nil
+	case "overdue":
+		return predicate(func(todo models.Todo, env filterEnv) bool { return todo.IsOverdue(env.now) }), nil
+	case "recurring":
+		return predicate(func(todo models.Todo, env filterEnv) bool { return todo.Repeat != "" }), nil
+	case "subtask":
+		return predicate(func(todo models.Todo, env filterEnv) bool { return todo.ParentID != nil }), nil
+	case "archived":
+		return predicate(func(todo models.Todo, env filterEnv) bool { return todo.ArchivedAt != nil }), nil
+	}
+	return nil, p.errorAt(value, fmt.Sprintf("invalid is:%s, expected done, open, overdue, recurring, subtask or archived", value.text))
+}
+
+func (p *filterParser) hasPredicate(value filterToken) (predicate, error) {
+	switch strings.ToLower(value.text) {
+	case "due":
+		return func(todo models.Todo, env filterEnv) bool { return todo.DueAt != nil }, nil
+	case "start":
+		return func(todo models.Todo, env filterEnv) bool { return todo.StartAt != nil }, nil
+	case "notes":
+		return func(todo models.Todo, env filterEnv) bool { return strings.TrimSpace(todo.Notes) != "" }, nil
+	case "tags":
+		return func(todo models.Todo, env filterEnv) bool { return len(todo.Tags) > 0 }, nil
+	case "project":
+		return func(todo models.Todo, env filterEnv) bool { return todo.ProjectID != nil }, nil
+	case "parent":
+		return func(todo models.Todo, env filterEnv) bool { return todo.ParentID != nil }, nil
+	}
+	return nil, p.errorAt(value, fmt.Sprintf("invalid has:%s, expected due, start, notes, tags, project or parent", value.text))
+}
+
+// filterDay is a day of a filter, resolved against the current day when the
+// expression is evaluated. Either offset counts days from today or date is set.
+type filterDay struct {
+	offset int
+	date   *time.Time // midnight UTC of the given date
+}
+
+var relativeDay = regexp.MustCompile(`^([+-]?\d+)([dw])$`)
+
+// filterAge is an age in days or weeks, days without a unit
+var filterAge = regexp.MustCompile(`^(\d+)([dw]?)$`)
+
+func parseFilterDay(value string) (filterDay, error) {
+	switch strings.ToLower(value) {
+	case "today":
+		return filterDay{}, nil
+	case "tomorrow":
+		return filterDay{offset: 1}, nil
+	case "yesterday":
+		return filterDay{offset: -1}, nil
+	}
+	if match := relativeDay.FindStringSubmatch(strings.ToLower(value)); match != nil {
+		n, _ := strconv.Atoi(match[1])
+		if match[2] == "w" {
+			n *= 7
+		}
+		return filterDay{offset: n}, nil
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return filterDay{}, fmt.Errorf("invalid date %q, use today, tomorrow, yesterday, 3d, -2w or YYYY-MM-DD", value)
+	}
+	return filterDay{date: &date}, nil
+}
+
+// bounds returns the start of the day and of the day after it in the location of the filter
+func (d filterDay) bounds(env filterEnv) (time.Time, time.Time) {
+	var y int
+	var m time.Month
+	var day int
+	if d.date != nil {
+		y, m, day = d.date.Date()
+	} else {
+		y, m, day = env.now.In(env.location).Date()
+		day += d.offset
+	}
+	start := time.Date(y, m, day, 0, 0, 0, 0, env.location)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// datePredicate compares a date of todos with a whole day: < is before the
+// day, <= up to its end, : within it. Todos without the date never match.
+func datePredicate(field, op string, day filterDay) predicate {
+	return func(todo models.Todo, env filterEnv) bool {
+		var t *time.Time
+		switch field {
+		case "due":
+			t = todo.DueAt
+		case "start":
+			t = todo.StartAt
+		case "created":
+			t = &todo.CreatedAt
+		case "updated":
+			t = &todo.UpdatedAt
+		}
+		if t == nil {
+			return false
+		}
+		start, end := day.bounds(env)
+		switch op {
+		case "<":
+			return t.Before(start)
+		case "<=":
+			return t.Before(end)
+		case ">":
+			return !t.Before(end)
+		case ">=":
+			return !t.Before(start)
+		}
+		return !t.Before(start) && t.Before(end)
+	}
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"todo-cli/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFilterExprMatch(t *testing.T) {
+	now := time.Date(2024, 10, 15, 12, 0, 0, 0, time.UTC)
+	day := func(d int) *time.Time {
+		t := time.Date(2024, 10, d, 9, 0, 0, 0, time.UTC)
+		return &t
+	}
+	home := primitive.NewObjectID()
+	env := filterEnv{now: now, location: time.UTC, projects: map[primitive.ObjectID]string{home: "Home"}}
+
+	todos := map[string]models.Todo{
+		"report":    {Title: "Write report", Tags: []string{"work"}, Priority: models.PriorityHigh, DueAt: day(14), CreatedAt: *day(1)},
+		"groceries": {Title: "Buy groceries", Notes: "milk and eggs", Tags: []string{"home"}, ProjectID: &home, DueAt: day(15), CreatedAt: *day(10)},
+		"taxes":     {Title: "Taxes", Completed: true, Priority: models.PriorityUrgent, CreatedAt: *day(2)},
+		"plants":    {Title: "Water plants", Repeat: "FREQ=WEEKLY", DueAt: day(20), CreatedAt: *day(14)},
+	}
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"tag:work", []string{"report"}},
+		{"TAG:work", []string{"report"}},
+		{"tag!=work", []string{"groceries", "plants", "taxes"}},
+		{"project:home", []string{"groceries"}},
+		{"project:" + home.Hex(), []string{"groceries"}},
+		{"project:inbox", []string{"plants", "report", "taxes"}},
+		{"done", []string{"taxes"}},
+		{"!done", []string{"groceries", "plants", "report"}},
+		{"done:false priority>=high", []string{"report"}},
+		{"priority>=high OR tag:home", []string{"groceries", "report", "taxes"}},
+		{"tag:work AND (priority>=high OR due<today) AND NOT done", []string{"report"}},
+		{"due<today", []string{"report"}},
+		{"due:today", []string{"groceries"}},
+		{"due<=7d", []string{"groceries", "plants", "report"}},
+		{"due>2024-10-15", []string{"plants"}},
+		{"overdue", []string{"groceries", "report"}},
+		{"recurring", []string{"plants"}},
+		{"age>=10", []string{"report", "taxes"}},
+		{"age<1w", []string{"groceries", "plants"}},
+		{"milk", []string{"groceries"}},
+		{`"water plants"`, []string{"plants"}},
+		{"title:milk", nil},
+		{"notes:milk", []string{"groceries"}},
+		{"has:due -has:project", []string{"plants", "report"}},
+		{"is:open is:recurring", []string{"plants"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := ParseFilterExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseFilterExpr(%q) failed: %v", tt.expr, err)
+			}
+			var got []string
+			for _, name := range []string{"groceries", "plants", "report", "taxes"} {
+				if expr.match(todos[name], env) {
+					got = append(got, name)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%q matched %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilterExprErrors(t *testing.T) {
+	tests := []struct {
+		expr   string
+		column int
+		want   string
+	}{
+		{"foo:bar", 1, `unknown field "foo", expected tag, project, title, notes, priority, due, start, created, updated, age, done, is or has`},
+		{"tag:a tag<b", 10, "tag cannot be compared with <"},
+		{"due<someday", 5, `invalid date "someday", use today, tomorrow, yesterday, 3d, -2w or YYYY-MM-DD`},
+		{"priority:", 10, "expected a value after priority:"},
+		{"priority:high is:maybe", 18, "invalid is:maybe, expected done, open, overdue, recurring, subtask or archived"},
+		{`tag:a "unterminated`, 7, "unterminated quoted string"},
+		{"tag:work AND (priority>=high", 29, "expected ) to close the ( at column 14"},
+		{"tag:a )", 7, "unexpected ), there is no ( to close"},
+		{"tag:a AND", 10, "unexpected end of filter, expected a condition"},
+		{"done:maybe", 6, `invalid done value "maybe", expected true or false`},
+		{"age>old", 5, `invalid age "old", use a number of days such as 30, 30d or 4w`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseFilterExpr(tt.expr)
+			var syntaxErr *FilterSyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("ParseFilterExpr(%q) returned %v, want a *FilterSyntaxError", tt.expr, err)
+			}
+			if syntaxErr.Column != tt.column || syntaxErr.Message != tt.want {
+				t.Errorf("ParseFilterExpr(%q) failed at column %d with %q, want column %d with %q",
+					tt.expr, syntaxErr.Column, syntaxErr.Message, tt.column, tt.want)
+			}
+		})
+	}
+}
+
+func TestNarrowQuery(t *testing.T) {
+	home := primitive.NewObjectID()
+	work := primitive.NewObjectID()
+	other := primitive.NewObjectID()
+	projects := map[primitive.ObjectID]string{home: "Home", work: "Work", other: "work"}
+	yes, no := true, false
+
+	tests := []struct {
+		expr string
+		want TodoQuery
+	}{
+		{"tag:a tag:b", TodoQuery{Tags: []string{"a", "b"}}},
+		{"tag:a AND (done OR tag:b)", TodoQuery{Tags: []string{"a"}}},
+		{"tag:a OR tag:b", TodoQuery{}},
+		{"NOT tag:a", TodoQuery{}},
+		{"tag!=a", TodoQuery{}},
+		{"done", TodoQuery{Completed: &yes}},
+		{"is:open priority:high", TodoQuery{Completed: &no}},
+		{"done:false", TodoQuery{Completed: &no}},
+		{"project:home", TodoQuery{Project: &home}},
+		{"project:" + other.Hex(), TodoQuery{Project: &other}},
+		{"project:inbox", TodoQuery{Inbox: true}},
+		// Two projects are called work, either may hold the todos
+		{"project:work", TodoQuery{}},
+		{"project:nowhere", TodoQuery{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := ParseFilterExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseFilterExpr(%q) failed: %v", tt.expr, err)
+			}
+			var query TodoQuery
+			narrowQuery(expr, filterEnv{projects: projects}, &query)
+			if !reflect.DeepEqual(query, tt.want) {
+				t.Errorf("%q narrowed the query to %+v, want %+v", tt.expr, query, tt.want)
+			}
+		})
+	}
+}
+
+func TestNarrowQueryKeepsFilterTags(t *testing.T) {
+	tags := make([]string, 1, 4)
+	tags[0] = "a"
+	expr, err := ParseFilterExpr("tag:b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := TodoFilter{Tags: tags, Expr: expr}.storeQuery()
+	if want := []string{"a", "b"}; !reflect.DeepEqual(query.Tags, want) {
+		t.Errorf("store query has the tags %v, want %v", query.Tags, want)
+	}
+	if got := tags[:2]; got[1] != "" {
+		t.Errorf("the tags of the filter were changed to %v", got)
+	}
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"todo-cli/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Fixture is a JSON document of users and todos to seed a store with.
+// User passwords are given in plain text and hashed while seeding.
+type Fixture struct {
+	Users []models.User `json:"users"`
+	Todos []models.Todo `json:"todos"`
+}
+
+// LoadFixture reads a fixture from a JSON file
+func LoadFixture(path string) (Fixture, error) {
+	var fixture Fixture
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fixture, err
+	}
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return fixture, fmt.Errorf("invalid fixture %s: %v", path, err)
+	}
+	return fixture, nil
+}
+
+// SeedFixture inserts the fixture users and todos into the stores
+func SeedFixture(stores Stores, fixture Fixture) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, user := range fixture.Users {
+		if user.ID.IsZero() {
+			user.ID = primitive.NewObjectID()
+		}
+		passwordHash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		user.Password = string(passwordHash)
+		if err := stores.Users.InsertUser(ctx, user); err != nil {
+			return fmt.Errorf("failed to seed user %s: %v", user.Username, err)
+		}
+	}
+
+	now := time.Now()
+	for _, todo := range fixture.Todos {
+		if todo.ID.IsZero() {
+			todo.ID = primitive.NewObjectID()
+		}
+		if todo.CreatedAt.IsZero() {
+			todo.CreatedAt = now
+		}
+		if todo.UpdatedAt.IsZero() {
+			todo.UpdatedAt = todo.CreatedAt
+		}
+		if todo.Position == 0 {
+			todo.Position = newPosition(todo.CreatedAt)
+		}
+		if err := stores.Todos.InsertTodo(ctx, todo); err != nil {
+			return fmt.Errorf("failed to seed todo %q: %v", todo.Title, err)
+		}
+	}
+	return nil
+}
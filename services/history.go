@@ -0,0 +1,237 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"reflect"
+	"time"
+
+	"todo-cli/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// systemActor is shown as the actor of the changes made by the server itself
+const systemActor = "system"
+
+// auditedTodos records every change made through a TodoStore in the history
+// of the todo. Until todos can be shared, the owner is the one changing them.
+type auditedTodos struct {
+	TodoStore
+	events EventStore
+}
+
+func (s auditedTodos) InsertTodo(ctx context.Context, todo models.Todo) error {
+	if err := s.TodoStore.InsertTodo(ctx, todo); err != nil {
+		return err
+	}
+	return recordEvent(ctx, s.events, nil, todo, &todo.UserID)
+}
+
+func (s auditedTodos) ReplaceTodo(ctx context.Context, todo models.Todo, version int64) error {
+	before, err := s.TodoStore.FindTodo(ctx, todo.ID, todo.UserID)
+	if err != nil {
+		return err
+	}
+	if err := s.TodoStore.ReplaceTodo(ctx, todo, version); err != nil {
+		return err
+	}
+	return recordEvent(ctx, s.events, &before, todo, &todo.UserID)
+}
+
+// DeleteTodo deletes the todo for good, its history is kept and ends with
+// the purge
+func (s auditedTodos) DeleteTodo(ctx context.Context, id, userID primitive.ObjectID) error {
+	before, err := s.TodoStore.FindTodo(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.TodoStore.DeleteTodo(ctx, id, userID); err != nil {
+		return err
+	}
+	return recordPurge(ctx, s.events, before, &userID)
+}
+
+// recordEvent adds the change of a todo from before (nil when it was just
+// created) to after to its history. Nothing is recorded when no field changed.
+func recordEvent(ctx context.Context, events EventStore, before *models.Todo, after models.Todo, actorID *primitive.ObjectID) error {
+	event := models.TodoEvent{
+		ID:      primitive.NewObjectID(),
+		TodoID:  after.ID,
+		UserID:  after.UserID,
+		ActorID: actorID,
+		Action:  models.ActionCreated,
+		At:      time.Now().UTC(),
+	}
+	if before == nil {
+		event.Changes = diffTodos(models.Todo{}, after)
+	} else {
+		event.Changes = diffTodos(*before, after)
+		if len(event.Changes) == 0 {
+			return nil
+		}
+		event.Action = todoAction(*before, after)
+	}
+	return events.InsertEvent(ctx, event)
+}
+
+// recordPurge adds the final entry to the history of a todo deleted for
+// good, with the last value of each of its fields
+func recordPurge(ctx context.Context, events EventStore, todo models.Todo, actorID *primitive.ObjectID) error {
+	return events.InsertEvent(ctx, models.TodoEvent{
+		ID:      primitive.NewObjectID(),
+		TodoID:  todo.ID,
+		UserID:  todo.UserID,
+		ActorID: actorID,
+		Action:  models.ActionPurged,
+		Changes: diffTodos(todo, models.Todo{}),
+		At:      time.Now().UTC(),
+	})
+}
+
+// todoAction names the most significant change between two versions of a todo
+func todoAction(before, after models.Todo) string {
+	switch {
+	case before.DeletedAt == nil && after.DeletedAt != nil:
+		return models.ActionDeleted
+	case before.DeletedAt != nil && after.DeletedAt == nil:
+		return models.ActionRestored
+	case !before.Completed && after.Completed:
+		return models.ActionCompleted
+	case before.Completed && !after.Completed:
+		return models.ActionReopened
+	case before.ArchivedAt == nil && after.ArchivedAt != nil:
+		return models.ActionArchived
+	case before.ArchivedAt != nil && after.ArchivedAt == nil:
+		return models.ActionUnarchived
+	}
+	return models.ActionUpdated
+}
+
+// historyFields are the fields of a todo whose changes are recorded, by their
+// JSON name. Timestamps kept by the server and the manual order, which moving
+// one todo can shift for many, are left out.
+var historyFields = []struct {
+	name  string
+	value func(models.Todo) interface{}
+}{
+	{"title", func(t models.Todo) interface{} { return historyString(t.Title) }},
+	{"notes", func(t models.Todo) interface{} { return historyString(t.Notes) }},
+	{"completed", func(t models.Todo) interface{} { return t.Completed }},
+	{"priority", func(t models.Todo) interface{} { return t.Priority.String() }},
+	{"tags", func(t models.Todo) interface{} {
+		if len(t.Tags) == 0 {
+			return nil
+		}
+		return t.Tags
+	}},
+	{"project_id", func(t models.Todo) interface{} { return historyID(t.ProjectID) }},
+	{"parent_id", func(t models.Todo) interface{} { return historyID(t.ParentID) }},
+	{"start_at", func(t models.Todo) interface{} { return historyTime(t.StartAt) }},
+	{"due_at", func(t models.Todo) interface{} { return historyTime(t.DueAt) }},
+	{"repeat", func(t models.Todo) interface{} { return historyString(t.Repeat) }},
+	{"repeat_tz", func(t models.Todo) interface{} { return historyString(t.RepeatTZ) }},
+	{"archived_at", func(t models.Todo) interface{} { return historyTime(t.ArchivedAt) }},
+	{"deleted_at", func(t models.Todo) interface{} { return historyTime(t.DeletedAt) }},
+}
+
+// diffTodos lists the fields that differ between two versions of a todo
+func diffTodos(before, after models.Todo) []models.FieldChange {
+	var changes []models.FieldChange
+	for _, field := range historyFields {
+		was, now := field.value(before), field.value(after)
+		if reflect.DeepEqual(was, now) {
+			continue
+		}
+		changes = append(changes, models.FieldChange{Field: field.name, Before: was, After: now})
+	}
+	return changes
+}
+
+// historyString, historyID and historyTime turn fields into plain values
+// that read the same from every store, nil when the field is not set
+func historyString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func historyID(id *primitive.ObjectID) interface{} {
+	if id == nil {
+		return nil
+	}
+	return id.Hex()
+}
+
+func historyTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// GetHistory returns the history of a todo of the user, oldest first. The
+// history of todos deleted for good is kept and ends with their purge.
+func (s *TodoService) GetHistory(id string, userId primitive.ObjectID) ([]models.TodoEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	_, findErr := s.trash.FindTodo(ctx, objectID, userId)
+	if findErr != nil && !errors.Is(findErr, ErrNotFound) {
+		return nil, findErr
+	}
+	events, err := s.events.FindEvents(ctx, objectID, userId)
+	if err != nil {
+		return nil, err
+	}
+	// A todo deleted for good is known by its history
+	if findErr != nil && len(events) == 0 {
+		return nil, ErrNotFound
+	}
+
+	actors := map[primitive.ObjectID]string{}
+	history := make([]models.TodoEvent, 0, len(events))
+	for _, event := range events {
+		event.Actor = systemActor
+		if event.ActorID != nil {
+			name, ok := actors[*event.ActorID]
+			if !ok {
+				// A user that is gone by now is shown by ID
+				name = event.ActorID.Hex()
+				if user, err := s.users.FindUserByID(ctx, *event.ActorID); err == nil {
+					name = user.Username
+				}
+				actors[*event.ActorID] = name
+			}
+			event.Actor = name
+		}
+		history = append(history, event)
+	}
+	return history, nil
+}
+
+// recordPurged adds the purge of todos by the server to their history
+func recordPurged(ctx context.Context, events EventStore, purged []models.Todo) {
+	for _, todo := range purged {
+		if err := recordPurge(ctx, events, todo, nil); err != nil {
+			log.Printf("Failed to record the purge of todo %s: %v", todo.ID.Hex(), err)
+		}
+	}
+}
+
+// recordArchived adds the archiving of todos by the server to their history
+func recordArchived(ctx context.Context, events EventStore, archived []models.Todo, archivedAt time.Time) {
+	for _, todo := range archived {
+		after := todo
+		after.ArchivedAt = &archivedAt
+		if err := recordEvent(ctx, events, &todo, after, nil); err != nil {
+			log.Printf("Failed to record the archiving of todo %s: %v", todo.ID.Hex(), err)
+		}
+	}
+}
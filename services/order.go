@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"todo-cli/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidMove is returned when a todo is moved relative to itself or to nothing
+var ErrInvalidMove = errors.New("a todo can only be moved before or after another todo")
+
+// ErrMoveAcrossPriorities is returned when a todo is moved next to a todo of another priority
+var ErrMoveAcrossPriorities = errors.New("a todo can only be moved among todos of the same priority")
+
+// positionSpacing is the gap left between todos when their positions are renumbered
+const positionSpacing = 1024
+
+// newPosition places a new todo at the end of the manual order. It is derived
+// from the creation time instead of the current last position, so concurrent
+// inserts never need to read or shift the positions of other todos.
+func newPosition(createdAt time.Time) float64 {
+	return float64(createdAt.UnixNano() / int64(time.Millisecond))
+}
+
+// sortByPosition orders todos by their manual position, oldest first on ties
+func sortByPosition(todos []models.Todo) {
+	sort.SliceStable(todos, func(i, j int) bool {
+		if todos[i].Position != todos[j].Position {
+			return todos[i].Position < todos[j].Position
+		}
+		return todos[i].CreatedAt.Before(todos[j].CreatedAt)
+	})
+}
+
+// MoveTodo moves a todo right before or right after another todo of the user
+// with the same priority, in the order todos are listed in by default. Only
+// the moved todo gets a new position, halfway between its new neighbours,
+// unless there is no room left between them and the todos of the priority
+// are renumbered.
+func (s *TodoService) MoveTodo(id string, userId primitive.ObjectID, beforeID, afterID string) (models.Todo, error) {
+	targetID := beforeID
+	if targetID == "" {
+		targetID = afterID
+	}
+	if targetID == "" || targetID == id || (beforeID != "" && afterID != "") {
+		return models.Todo{}, ErrInvalidMove
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	todo, err := s.findTodo(ctx, id, userId)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	target, err := s.findTodo(ctx, targetID, userId)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	// Todos are listed by priority first, so another priority is never a neighbour
+	if target.Priority != todo.Priority {
+		return models.Todo{}, ErrMoveAcrossPriorities
+	}
+
+	archived := false
+	listed, err := s.store.FindTodos(ctx, userId, TodoQuery{Archived: &archived, Sort: DefaultTodoSort})
+	if err != nil {
+		return models.Todo{}, err
+	}
+	var todos []models.Todo
+	for _, other := range listed {
+		if other.Priority == todo.Priority && other.ID != todo.ID {
+			todos = append(todos, other)
+		}
+	}
+	insertAt := -1
+	for i, other := range todos {
+		if other.ID == target.ID {
+			insertAt = i
+			break
+		}
+	}
+	if insertAt < 0 {
+		return models.Todo{}, ErrNotFound
+	}
+	if afterID != "" {
+		insertAt++
+	}
+
+	todo.UpdatedAt = time.Now()
+	todo.Version++
+	var prev, next *models.Todo
+	if insertAt > 0 {
+		prev = &todos[insertAt-1]
+	}
+	if insertAt < len(todos) {
+		next = &todos[insertAt]
+	}
+	switch {
+	case prev == nil:
+		todo.Position = next.Position - positionSpacing
+	case next == nil:
+		todo.Position = prev.Position + positionSpacing
+	default:
+		todo.Position = prev.Position + (next.Position-prev.Position)/2
+	}
+
+	if (prev != nil && todo.Position <= prev.Position) || (next != nil && todo.Position >= next.Position) {
+		// No room left between the neighbours, renumber the priority
+		ordered := append(append(append([]models.Todo{}, todos[:insertAt]...), todo), todos[insertAt:]...)
+		err := s.inTransaction(func(tx *TodoService) (err error) {
+			todo, err = tx.renumber(ctx, ordered, insertAt)
+			return err
+		})
+		if errors.Is(err, ErrNoTransactions) {
+			todo, err = s.renumber(ctx, ordered, insertAt)
+		}
+		if err != nil {
+			return models.Todo{}, err
+		}
+		return withComputed(todo, time.Now()), nil
+	}
+
+	if err := s.store.ReplaceTodo(ctx, todo, todo.Version-1); err != nil {
+		return models.Todo{}, err
+	}
+	return withComputed(todo, time.Now()), nil
+}
+
+// renumber stores todos in the given order, evenly spaced above the highest
+// position any of them has, and returns the one at moved, which is at its
+// next version already. The todos are written from the last one to the
+// first, so when a store without transactions fails halfway, the todos
+// written so far come after the others in their new order and the others
+// keep their old one.
+func (s *TodoService) renumber(ctx context.Context, todos []models.Todo, moved int) (models.Todo, error) {
+	// A retried transaction starts over from the todos as they were read
+	todos = append([]models.Todo(nil), todos...)
+	highest := todos[0].Position
+	for _, todo := range todos {
+		highest = math.Max(highest, todo.Position)
+	}
+	for i := len(todos) - 1; i >= 0; i-- {
+		todos[i].Position = highest + float64((i+1)*positionSpacing)
+		if i != moved {
+			todos[i].Version++
+		}
+		if err := s.store.ReplaceTodo(ctx, todos[i], todos[i].Version-1); err != nil {
+			return models.Todo{}, err
+		}
+	}
+	return todos[moved], nil
+}
@@ -0,0 +1,84 @@
+package services_test
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"todo-cli/models"
+	"todo-cli/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// listed returns the titles of the todos of the user in the default order
+func listed(t *testing.T, todos *services.TodoService, userID primitive.ObjectID) []string {
+	t.Helper()
+	page, err := todos.GetTodos(userID, services.TodoFilter{}, services.PageRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return titles(page.Todos)
+}
+
+func TestMoveTodo(t *testing.T) {
+	todos := services.NewTodoService(openStores(t))
+	userID := primitive.NewObjectID()
+	added := addTodos(t, todos, userID,
+		models.Todo{Title: "report", Priority: models.PriorityHigh},
+		models.Todo{Title: "groceries"},
+		models.Todo{Title: "taxes", Priority: models.PriorityHigh},
+		models.Todo{Title: "plants"})
+	if got := listed(t, todos, userID); !reflect.DeepEqual(got, []string{"report", "taxes", "groceries", "plants"}) {
+		t.Fatalf("todos are listed as %v", got)
+	}
+
+	if _, err := todos.MoveTodo(added[2].ID.Hex(), userID, added[0].ID.Hex(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := todos.MoveTodo(added[1].ID.Hex(), userID, "", added[3].ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if got := listed(t, todos, userID); !reflect.DeepEqual(got, []string{"taxes", "report", "plants", "groceries"}) {
+		t.Errorf("after the moves todos are listed as %v", got)
+	}
+
+	if _, err := todos.MoveTodo(added[1].ID.Hex(), userID, added[0].ID.Hex(), ""); !errors.Is(err, services.ErrMoveAcrossPriorities) {
+		t.Errorf("moving next to a todo of another priority returned %v, want ErrMoveAcrossPriorities", err)
+	}
+}
+
+func TestMoveTodoRenumbers(t *testing.T) {
+	for _, transactions := range []bool{true, false} {
+		stores := openStores(t)
+		if !transactions {
+			stores.Transactions = nil
+		}
+		todos := services.NewTodoService(stores)
+		userID := primitive.NewObjectID()
+		// No room is left between the first two todos
+		added := addTodos(t, todos, userID,
+			models.Todo{Title: "report", Position: 1},
+			models.Todo{Title: "taxes", Position: math.Nextafter(1, 2)},
+			models.Todo{Title: "groceries", Position: 2})
+
+		if err := todos.Undoable(userID, "move todo", func(todos *services.TodoService) error {
+			_, err := todos.MoveTodo(added[2].ID.Hex(), userID, "", added[0].ID.Hex())
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if got := listed(t, todos, userID); !reflect.DeepEqual(got, []string{"report", "groceries", "taxes"}) {
+			t.Errorf("with transactions %v, after the move todos are listed as %v", transactions, got)
+		}
+
+		// Undoing the move puts back every renumbered todo
+		if op, err := todos.Undo(userID); err != nil || len(op.Changes) != 3 {
+			t.Fatalf("with transactions %v, Undo returned %d changes, %v, want 3", transactions, len(op.Changes), err)
+		}
+		if got := listed(t, todos, userID); !reflect.DeepEqual(got, []string{"report", "taxes", "groceries"}) {
+			t.Errorf("with transactions %v, after undoing the move todos are listed as %v", transactions, got)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"todo-cli/models"
+)
+
+// Page sizes of GET /todos
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+// ErrInvalidCursor is returned for cursors that were not issued for the requested sort
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// SortKey orders todos by one field
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// TodoSort orders todos by several fields, the first one deciding most
+type TodoSort []SortKey
+
+// DefaultTodoSort lists the most urgent todos first, then in their manual order
+var DefaultTodoSort = TodoSort{{Field: "priority", Desc: true}, {Field: "position"}}
+
+// todoSortFields compares two todos by a field. Todos without a value for the
+// field come last whatever the direction.
+var todoSortFields = map[string]func(a, b models.Todo) (cmp int, missing int){
+	"title": func(a, b models.Todo) (int, int) {
+		return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title)), 0
+	},
+	"completed":    func(a, b models.Todo) (int, int) { return compareBool(a.Completed, b.Completed), 0 },
+	"priority":     func(a, b models.Todo) (int, int) { return compareInt(int(a.Priority), int(b.Priority)), 0 },
+	"position":     func(a, b models.Todo) (int, int) { return compareFloat(a.Position, b.Position), 0 },
+	"created_at":   func(a, b models.Todo) (int, int) { return compareTime(&a.CreatedAt, &b.CreatedAt) },
+	"updated_at":   func(a, b models.Todo) (int, int) { return compareTime(&a.UpdatedAt, &b.UpdatedAt) },
+	"start_at":     func(a, b models.Todo) (int, int) { return compareTime(a.StartAt, b.StartAt) },
+	"due_at":       func(a, b models.Todo) (int, int) { return compareTime(a.DueAt, b.DueAt) },
+	"completed_at": func(a, b models.Todo) (int, int) { return compareTime(a.CompletedAt, b.CompletedAt) },
+	"archived_at":  func(a, b models.Todo) (int, int) { return compareTime(a.ArchivedAt, b.ArchivedAt) },
+}
+
+// ParseTodoSort reads a sort such as "-priority,due_at", a leading - sorts
+// that field in descending order. An empty sort is DefaultTodoSort.
+func ParseTodoSort(spec string) (TodoSort, error) {
+	if strings.TrimSpace(spec) == "" {
+		return DefaultTodoSort, nil
+	}
+	var keys TodoSort
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		key := SortKey{Field: strings.TrimPrefix(field, "-"), Desc: strings.HasPrefix(field, "-")}
+		if _, ok := todoSortFields[key.Field]; !ok {
+			fields := make([]string, 0, len(todoSortFields))
+			for name := range todoSortFields {
+				fields = append(fields, name)
+			}
+			sort.Strings(fields)
+			return nil, fmt.Errorf("invalid sort field %q, expected one of %s", key.Field, strings.Join(fields, ", "))
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// String writes the sort back in the form ParseTodoSort reads
+func (s TodoSort) String() string {
+	fields := make([]string, len(s))
+	for i, key := range s {
+		fields[i] = key.Field
+		if key.Desc {
+			fields[i] = "-" + key.Field
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// Less reports whether a is listed before b. Ties are broken by creation time
+// and then by ID, so every todo has a fixed place to resume a page from.
+func (s TodoSort) Less(a, b models.Todo) bool {
+	for _, key := range s {
+		cmp, missing := todoSortFields[key.Field](a, b)
+		if missing != 0 {
+			return missing < 0
+		}
+		if key.Desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp < 0
+		}
+	}
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ID.Hex() < b.ID.Hex()
+}
+
+// PageRequest selects one page of todos
+type PageRequest struct {
+	Sort   TodoSort
+	Limit  int    // defaults to DefaultPageSize, at most MaxPageSize
+	Cursor string // next_cursor of the previous page, empty for the first one
+}
+
+// TodoPage is one page of todos and the cursor of the page after it
+type TodoPage struct {
+	Todos      []models.Todo `json:"todos"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// pageCursor is what the opaque cursor holds: the sort it was issued for and
+// the sort fields of the last todo on the page
+type pageCursor struct {
+	Sort string      `json:"s"`
+	Last models.Todo `json:"t"`
+}
+
+// encodeCursor returns the cursor resuming after todo
+func encodeCursor(order TodoSort, todo models.Todo) (string, error) {
+	last := models.Todo{
+		ID:          todo.ID,
+		Title:       todo.Title,
+		Completed:   todo.Completed,
+		Priority:    todo.Priority,
+		Position:    todo.Position,
+		StartAt:     todo.StartAt,
+		DueAt:       todo.DueAt,
+		CreatedAt:   todo.CreatedAt,
+		UpdatedAt:   todo.UpdatedAt,
+		CompletedAt: todo.CompletedAt,
+		ArchivedAt:  todo.ArchivedAt,
+	}
+	data, err := json.Marshal(pageCursor{Sort: order.String(), Last: last})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor returns the last todo of the previous page
+func decodeCursor(order TodoSort, cursor string) (models.Todo, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return models.Todo{}, ErrInvalidCursor
+	}
+	var decoded pageCursor
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.Sort != order.String() {
+		return models.Todo{}, ErrInvalidCursor
+	}
+	return decoded.Last, nil
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case !a:
+		return -1
+	}
+	return 1
+}
+
+// compareTime compares two optional times, missing reports which one is unset
+func compareTime(a, b *time.Time) (cmp int, missing int) {
+	switch {
+	case a == nil && b == nil:
+		return 0, 0
+	case a == nil:
+		return 0, 1
+	case b == nil:
+		return 0, -1
+	}
+	switch {
+	case a.Before(*b):
+		return -1, 0
+	case a.After(*b):
+		return 1, 0
+	}
+	return 0, 0
+}
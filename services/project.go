@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"todo-cli/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrProjectNotFound is returned when a todo refers to a project the user does not own
+var ErrProjectNotFound = errors.New("project not found")
+
+// ProjectService implements the project use cases on top of the project store,
+// deleting a project is up to TodoService.DeleteProject as it moves todos
+type ProjectService struct {
+	projects ProjectStore
+}
+
+// NewProjectService returns a ProjectService persisting to the given stores
+func NewProjectService(stores Stores) *ProjectService {
+	return &ProjectService{projects: stores.Projects}
+}
+
+// CreateProject adds a new project for the user
+func (s *ProjectService) CreateProject(userId primitive.ObjectID, name string) (models.Project, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	project := models.Project{
+		ID:        primitive.NewObjectID(),
+		Name:      name,
+		UserID:    userId,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.projects.InsertProject(ctx, project); err != nil {
+		return models.Project{}, err
+	}
+	return project, nil
+}
+
+// GetProjects retrieves the projects of the user, archived ones only on request
+func (s *ProjectService) GetProjects(userId primitive.ObjectID, includeArchived bool) ([]models.Project, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	projects, err := s.projects.FindProjects(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	listed := []models.Project{}
+	for _, project := range projects {
+		if includeArchived || !project.Archived {
+			listed = append(listed, project)
+		}
+	}
+	return listed, nil
+}
+
+// GetProjectByID retrieves a project by its ID
+func (s *ProjectService) GetProjectByID(id string, userId primitive.ObjectID) (models.Project, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.Project{}, ErrNotFound
+	}
+	return s.projects.FindProject(ctx, objectID, userId)
+}
+
+// UpdateProject renames and/or (un)archives a project
+func (s *ProjectService) UpdateProject(id string, userId primitive.ObjectID, update models.ProjectUpdate) (models.Project, error) {
+	project, err := s.GetProjectByID(id, userId)
+	if err != nil {
+		return project, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	project.UpdatedAt = update.UpdatedAt
+	if update.Name != "" {
+		project.Name = update.Name
+	}
+	if update.Archived != nil {
+		project.Archived = *update.Archived
+	}
+	if err := s.projects.ReplaceProject(ctx, project); err != nil {
+		return models.Project{}, err
+	}
+	return project, nil
+}
+
+// DeleteProject deletes a project of the user. Its todos are moved to the
+// trash when cascade is set and to the Inbox otherwise, before the project
+// is deleted, in one transaction where the backend has them.
+func (s *TodoService) DeleteProject(id string, userId primitive.ObjectID, cascade bool) error {
+	err := s.inTransaction(func(tx *TodoService) error {
+		return tx.deleteProject(id, userId, cascade)
+	})
+	if errors.Is(err, ErrNoTransactions) {
+		// The project goes last, so after a failure deleting it again
+		// finishes the job
+		return s.deleteProject(id, userId, cascade)
+	}
+	return err
+}
+
+func (s *TodoService) deleteProject(id string, userId primitive.ObjectID, cascade bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	projectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	project, err := s.projects.FindProject(ctx, projectID, userId)
+	if err != nil {
+		return err
+	}
+	todos, err := s.store.FindTodos(ctx, userId, TodoQuery{Project: &project.ID})
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, todo := range todos {
+		if cascade {
+			deletedAt := now
+			todo.DeletedAt = &deletedAt
+		} else {
+			todo.ProjectID = nil
+			todo.UpdatedAt = now
+		}
+		todo.Version++
+		if err := s.store.ReplaceTodo(ctx, todo, todo.Version-1); err != nil {
+			return err
+		}
+	}
+	return s.projects.DeleteProject(ctx, project.ID, userId)
+}
@@ -0,0 +1,80 @@
+package services_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"todo-cli/models"
+	"todo-cli/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDeleteProject(t *testing.T) {
+	for _, cascade := range []bool{false, true} {
+		stores := openStores(t)
+		projects := services.NewProjectService(stores)
+		todos := services.NewTodoService(stores)
+		userID := primitive.NewObjectID()
+		project, err := projects.CreateProject(userID, "Job")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addTodos(t, todos, userID,
+			models.Todo{Title: "report", ProjectID: &project.ID},
+			models.Todo{Title: "groceries"},
+			models.Todo{Title: "taxes", ProjectID: &project.ID})
+
+		// byProject returns the titles of the todos listed in the project and in the Inbox
+		byProject := func() (inProject, inbox []string) {
+			t.Helper()
+			page, err := todos.GetTodos(userID, services.TodoFilter{}, services.PageRequest{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, todo := range page.Todos {
+				if todo.ProjectID != nil && *todo.ProjectID == project.ID {
+					inProject = append(inProject, todo.Title)
+				} else {
+					inbox = append(inbox, todo.Title)
+				}
+			}
+			return inProject, inbox
+		}
+
+		if err := todos.Undoable(userID, "delete project", func(todos *services.TodoService) error {
+			return todos.DeleteProject(project.ID.Hex(), userID, cascade)
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := projects.GetProjectByID(project.ID.Hex(), userID); !errors.Is(err, services.ErrNotFound) {
+			t.Errorf("GetProjectByID of the deleted project returned %v, want ErrNotFound", err)
+		}
+		wantInbox := []string{"report", "groceries", "taxes"}
+		if cascade {
+			wantInbox = []string{"groceries"}
+		}
+		if got, inbox := byProject(); got != nil || !reflect.DeepEqual(inbox, wantInbox) {
+			t.Errorf("with cascade %v, after the delete %v are in the project and %v in the Inbox, want %v in the Inbox", cascade, got, inbox, wantInbox)
+		}
+
+		// Undoing brings back the project with its todos
+		if _, err := todos.Undo(userID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := projects.GetProjectByID(project.ID.Hex(), userID); err != nil {
+			t.Errorf("with cascade %v, GetProjectByID after the undo returned %v", cascade, err)
+		}
+		if got, inbox := byProject(); !reflect.DeepEqual(got, []string{"report", "taxes"}) || !reflect.DeepEqual(inbox, []string{"groceries"}) {
+			t.Errorf("with cascade %v, after the undo %v are in the project and %v in the Inbox", cascade, got, inbox)
+		}
+
+		if _, err := todos.Redo(userID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := projects.GetProjectByID(project.ID.Hex(), userID); !errors.Is(err, services.ErrNotFound) {
+			t.Errorf("with cascade %v, GetProjectByID after the redo returned %v, want ErrNotFound", cascade, err)
+		}
+	}
+}
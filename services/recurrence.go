@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"todo-cli/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidRepeat is returned for recurrence rules the service cannot follow
+var ErrInvalidRepeat = errors.New("invalid repeat")
+
+// normalizeRepeat stores the recurrence rule in its canonical form and starts
+// a series for todos that begin repeating. The due date anchors the rule
+// unless one was set already.
+func normalizeRepeat(todo *models.Todo) error {
+	if todo.Repeat == "" {
+		todo.RepeatTZ = ""
+		todo.RepeatStart = nil
+		return nil
+	}
+	rule, err := models.ParseRRule(todo.Repeat)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRepeat, err)
+	}
+	if todo.DueAt == nil {
+		return fmt.Errorf("%w: a repeating todo needs a due date", ErrInvalidRepeat)
+	}
+	if todo.RepeatTZ != "" {
+		if _, err := ParseLocation(todo.RepeatTZ); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRepeat, err)
+		}
+	}
+	todo.Repeat = rule.String()
+	if todo.RepeatStart == nil {
+		repeatStart := *todo.DueAt
+		todo.RepeatStart = &repeatStart
+	}
+	if todo.SeriesID == nil {
+		seriesID := todo.ID
+		todo.SeriesID = &seriesID
+	}
+	return nil
+}
+
+// nextOccurrence returns the todo following a completed recurring todo, due
+// at the first occurrence of its rule that is still ahead. It reports false
+// once the rule has ended.
+func nextOccurrence(todo models.Todo, now time.Time) (models.Todo, bool) {
+	rule, err := models.ParseRRule(todo.Repeat)
+	if err != nil || todo.DueAt == nil {
+		return models.Todo{}, false
+	}
+	loc := time.Local
+	if todo.RepeatTZ != "" {
+		if tz, err := ParseLocation(todo.RepeatTZ); err == nil {
+			loc = tz
+		}
+	}
+
+	// Todos that repeat since before the start was kept go on from their due date
+	start := *todo.DueAt
+	if todo.RepeatStart != nil {
+		start = *todo.RepeatStart
+	}
+
+	// Completing a todo late skips the occurrences that are already past
+	dueAt, ok := rule.Next(start, todo.DueAt.In(loc))
+	for ok && dueAt.Before(now) {
+		dueAt, ok = rule.Next(start, dueAt)
+	}
+	if !ok {
+		return models.Todo{}, false
+	}
+
+	next := todo
+	next.ID = primitive.NewObjectID()
+	next.Completed = false
+	next.CompletedAt = nil
+	next.ArchivedAt = nil
+	if todo.StartAt != nil {
+		startAt := dueAt.Add(todo.StartAt.Sub(*todo.DueAt))
+		next.StartAt = &startAt
+	}
+	next.DueAt = &dueAt
+	next.CreatedAt = now
+	next.UpdatedAt = now
+	next.Version = 1
+	next.Position = newPosition(now)
+	return next, true
+}
+
+// scheduleNext creates the next occurrence of a recurring todo that was just
+// completed, unless the series already has an open one
+func (s *TodoService) scheduleNext(ctx context.Context, todo models.Todo) error {
+	if todo.Repeat == "" || !todo.Completed || todo.SeriesID == nil {
+		return nil
+	}
+	// The store leaves out the trash, an open occurrence in it does not count
+	open := false
+	occurrences, err := s.store.FindTodos(ctx, todo.UserID, TodoQuery{Series: todo.SeriesID, Completed: &open, Limit: 1})
+	if err != nil {
+		return err
+	}
+	if len(occurrences) > 0 {
+		return nil
+	}
+
+	next, ok := nextOccurrence(todo, time.Now())
+	if !ok {
+		return nil
+	}
+	if err := normalizeSchedule(&next); err != nil {
+		return err
+	}
+	return s.store.InsertTodo(ctx, next)
+}
@@ -0,0 +1,62 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"todo-cli/models"
+	"todo-cli/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestScheduleNext(t *testing.T) {
+	todos := services.NewTodoService(openStores(t))
+	userID := primitive.NewObjectID()
+	due := time.Now().Add(time.Hour).Truncate(time.Second)
+	first := addTodos(t, todos, userID, models.Todo{Title: "water plants", DueAt: &due, Repeat: "FREQ=DAILY"})[0]
+
+	// openOccurrences returns the open todos of the series outside the trash
+	openOccurrences := func() []models.Todo {
+		t.Helper()
+		page, err := todos.GetTodos(userID, services.TodoFilter{}, services.PageRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var open []models.Todo
+		for _, todo := range page.Todos {
+			if todo.SeriesID != nil && *todo.SeriesID == first.ID && !todo.Completed {
+				open = append(open, todo)
+			}
+		}
+		return open
+	}
+	complete := func(todo models.Todo) {
+		t.Helper()
+		for _, completed := range []bool{false, true} {
+			completed := completed
+			if _, err := todos.UpdateTodo(todo.ID.Hex(), userID, models.TodoUpdate{Completed: &completed, UpdatedAt: time.Now()}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	complete(first)
+	next := openOccurrences()
+	if len(next) != 1 || !next[0].DueAt.Equal(due.AddDate(0, 0, 1)) {
+		t.Fatalf("completing the first occurrence left %d open, want the one due a day later", len(next))
+	}
+	// Completing an older occurrence again leaves the open one the only one
+	complete(first)
+	if open := openOccurrences(); len(open) != 1 || open[0].ID != next[0].ID {
+		t.Fatalf("completing again left %d open occurrences, want the same one", len(open))
+	}
+	// An open occurrence in the trash does not hold up the next one
+	if err := todos.DeleteTodo(next[0].ID.Hex(), userID, nil); err != nil {
+		t.Fatal(err)
+	}
+	complete(first)
+	if open := openOccurrences(); len(open) != 1 || open[0].ID == next[0].ID {
+		t.Errorf("completing after trashing the open occurrence left %d open, want a new one", len(open))
+	}
+}
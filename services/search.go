@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"html"
+	"strings"
+	"time"
+	"unicode"
+
+	"todo-cli/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Number of results of a search
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// maxSearchTerms caps the words of a query that are looked for
+const maxSearchTerms = 10
+
+// ErrEmptySearch is returned for a query without any word to look for
+var ErrEmptySearch = errors.New("the search query needs at least one word")
+
+// SearchResult is a todo found by SearchTodos. Highlights holds the title and
+// fragments of the notes with the matched words wrapped in <mark></mark>,
+// the rest of the text is HTML escaped.
+type SearchResult struct {
+	models.Todo
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
+
+// SearchTerms splits a query into the distinct lower case words to look for
+func SearchTerms(query string) []string {
+	var terms []string
+	seen := map[string]bool{}
+	for _, word := range words(query) {
+		term := strings.ToLower(query[word[0]:word[1]])
+		if !seen[term] && len(terms) < maxSearchTerms {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// CountMatches counts the words of text matching any of the terms
+func CountMatches(text string, terms []string) int {
+	count := 0
+	for _, word := range words(text) {
+		if matchesAny(text[word[0]:word[1]], terms) {
+			count++
+		}
+	}
+	return count
+}
+
+// SearchTodos finds the todos of the user whose title or notes contain the
+// words of the query, best match first. archived selects archived todos the
+// way TodoFilter.Archived does.
+func (s *TodoService) SearchTodos(userId primitive.ObjectID, query string, limit int, archived string) ([]SearchResult, error) {
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return nil, ErrEmptySearch
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Leaving out archived todos in the store keeps them from taking up the limit
+	matches, err := s.store.SearchTodos(ctx, userId, terms, TodoQuery{Archived: archivedQuery(archived)}, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	results := []SearchResult{}
+	for _, match := range matches {
+		result := SearchResult{Todo: withComputed(match.Todo, now), Score: match.Score, Highlights: map[string]string{}}
+		if CountMatches(match.Todo.Title, terms) > 0 {
+			result.Highlights["title"] = highlight(match.Todo.Title, terms)
+		}
+		if fragments := snippet(match.Todo.Notes, terms); fragments != "" {
+			result.Highlights["notes"] = fragments
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// words returns the start and end offsets of the words in text
+func words(text string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case isWord && start < 0:
+			start = i
+		case !isWord && start >= 0:
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+	return spans
+}
+
+// matchesAny reports whether word starts with the stem of one of the terms,
+// so "report" and "reports" both find "reporting"
+func matchesAny(word string, terms []string) bool {
+	word = strings.ToLower(word)
+	for _, term := range terms {
+		if strings.HasPrefix(word, stem(term)) {
+			return true
+		}
+	}
+	return false
+}
+
+// stem strips the most common English suffixes off a search term
+func stem(term string) string {
+	for _, suffix := range []string{"ing", "ed", "es", "s"} {
+		if strings.HasSuffix(term, suffix) && len(term)-len(suffix) >= 3 {
+			return strings.TrimSuffix(term, suffix)
+		}
+	}
+	return term
+}
+
+// highlight escapes text and marks the words matching the terms
+func highlight(text string, terms []string) string {
+	var out strings.Builder
+	last := 0
+	for _, word := range words(text) {
+		if !matchesAny(text[word[0]:word[1]], terms) {
+			continue
+		}
+		out.WriteString(html.EscapeString(text[last:word[0]]))
+		out.WriteString("<mark>" + html.EscapeString(text[word[0]:word[1]]) + "</mark>")
+		last = word[1]
+	}
+	out.WriteString(html.EscapeString(text[last:]))
+	return out.String()
+}
+
+// snippet returns up to two highlighted fragments of text around the words
+// matching the terms, joined by an ellipsis, or "" when nothing matches
+func snippet(text string, terms []string) string {
+	const around = 6 // words shown on either side of a match
+	spans := words(text)
+
+	var windows [][2]int // first and last word index of each fragment
+	for i, word := range spans {
+		if !matchesAny(text[word[0]:word[1]], terms) {
+			continue
+		}
+		from, to := i-around, i+around
+		if from < 0 {
+			from = 0
+		}
+		if to > len(spans)-1 {
+			to = len(spans) - 1
+		}
+		if n := len(windows); n > 0 && from <= windows[n-1][1]+1 {
+			windows[n-1][1] = to
+			continue
+		}
+		if len(windows) == 2 {
+			break
+		}
+		windows = append(windows, [2]int{from, to})
+	}
+
+	var fragments []string
+	for _, window := range windows {
+		fragment := highlight(text[spans[window[0]][0]:spans[window[1]][1]], terms)
+		fragment = strings.Join(strings.Fields(fragment), " ")
+		if window[0] > 0 {
+			fragment = "…" + fragment
+		}
+		if window[1] < len(spans)-1 {
+			fragment += "…"
+		}
+		fragments = append(fragments, fragment)
+	}
+	return strings.Join(fragments, " ")
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"todo-cli/models"
+
+	"github.com/dgrijalva/jwt-go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Lifetimes of the tokens unless ACCESS_TOKEN_TTL and REFRESH_TOKEN_TTL say otherwise
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// maxUsedRefreshTokens is how many traded in refresh tokens a session
+// remembers, to notice when one of them is presented again
+const maxUsedRefreshTokens = 100
+
+// sessionTouchInterval is how stale the last use of a session may get before
+// a request records it again
+const sessionTouchInterval = time.Minute
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used, the session is revoked")
+)
+
+// TokenPair is handed out by logging in and by refreshing a session
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // Seconds the access token is valid for
+}
+
+// AccessTokenTTL returns how long access tokens are valid, from the
+// ACCESS_TOKEN_TTL environment variable, e.g. 15m
+func AccessTokenTTL() time.Duration {
+	return durationEnv("ACCESS_TOKEN_TTL", DefaultAccessTokenTTL)
+}
+
+// RefreshTokenTTL returns how long a session lasts without being refreshed,
+// from the REFRESH_TOKEN_TTL environment variable, e.g. 720h
+func RefreshTokenTTL() time.Duration {
+	return durationEnv("REFRESH_TOKEN_TTL", DefaultRefreshTokenTTL)
+}
+
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid %s %q, using %s", name, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+// newRefreshToken returns a random refresh token for a session, which names
+// the session so it can be looked up, and the hash it is stored as
+func newRefreshToken(sessionID string) (token, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	token = sessionID + "." + base64.RawURLEncoding.EncodeToString(secret)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens signs a new access token for the session and replaces its
+// refresh token, returning the session as it is to be stored. The refresh
+// token replaced is remembered as used.
+func issueTokens(session models.Token, ip string) (models.Token, TokenPair, error) {
+	var jwtSecret = []byte(os.Getenv("SECRET_KEY"))
+	now := time.Now()
+
+	refreshToken, hash, err := newRefreshToken(session.ID)
+	if err != nil {
+		return session, TokenPair{}, err
+	}
+	if session.RefreshHash != "" {
+		used := append([]string{}, session.UsedHashes...)
+		used = append(used, session.RefreshHash)
+		if len(used) > maxUsedRefreshTokens {
+			used = used[len(used)-maxUsedRefreshTokens:]
+		}
+		session.UsedHashes = used
+	}
+	session.RefreshHash = hash
+	session.Exp = now.Add(RefreshTokenTTL()).Unix()
+	session.IP = ip
+	session.LastUsedAt = now.UTC()
+
+	ttl := AccessTokenTTL()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": session.UserID,
+		"sid":     session.ID,
+		"exp":     now.Add(ttl).Unix(),
+	})
+	accessToken, err := token.SignedString(jwtSecret)
+	if err != nil {
+		return session, TokenPair{}, err
+	}
+	return session, TokenPair{AccessToken: accessToken, RefreshToken: refreshToken, ExpiresIn: int64(ttl.Seconds())}, nil
+}
+
+// startSession opens a session for a user who just logged in from the
+// device userAgent names, at ip
+func (s *UserService) startSession(ctx context.Context, userID primitive.ObjectID, userAgent, ip string) (TokenPair, error) {
+	session := models.Token{
+		ID:        primitive.NewObjectID().Hex(),
+		UserID:    userID.Hex(),
+		UserAgent: userAgent,
+		CreatedAt: time.Now().UTC(),
+	}
+	session, pair, err := issueTokens(session, ip)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if err := s.tokens.InsertToken(ctx, session); err != nil {
+		return TokenPair{}, err
+	}
+	return pair, nil
+}
+
+// RefreshSession trades a refresh token for a new access token and a new
+// refresh token. A refresh token is good for one use only: presenting one
+// that was already traded in means it leaked, so the session is revoked.
+// Any other token that does not match is turned down, leaving the session
+// alone, or knowing a session ID would be enough to end it.
+func (s *UserService) RefreshSession(refreshToken, ip string) (TokenPair, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sessionID, _, ok := strings.Cut(refreshToken, ".")
+	if !ok {
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+	session, err := s.tokens.FindToken(ctx, sessionID)
+	if errors.Is(err, ErrNotFound) {
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	hash := hashToken(refreshToken)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(session.RefreshHash)) != 1 {
+		if usedBefore(session, hash) {
+			return TokenPair{}, s.revokeReused(ctx, sessionID)
+		}
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+	if time.Now().Unix() > session.Exp {
+		if err := s.tokens.DeleteToken(ctx, sessionID); err != nil {
+			return TokenPair{}, err
+		}
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	session, pair, err := issueTokens(session, ip)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	// Another refresh with the same token got there first
+	err = s.tokens.RotateToken(ctx, session, hash)
+	if errors.Is(err, ErrNotFound) {
+		return TokenPair{}, s.revokeReused(ctx, sessionID)
+	}
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return pair, nil
+}
+
+// usedBefore reports whether a refresh token hashed as hash was already
+// traded in for another one of the session
+func usedBefore(session models.Token, hash string) bool {
+	for _, used := range session.UsedHashes {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(used)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// revokeReused ends a session whose refresh token was used twice
+func (s *UserService) revokeReused(ctx context.Context, sessionID string) error {
+	log.Printf("Refresh token of session %s was reused, revoking the session", sessionID)
+	if err := s.tokens.DeleteToken(ctx, sessionID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// SessionOf returns the user and session an access token was issued for,
+// after checking its signature. Expired tokens are accepted with
+// allowExpired, e.g. to log out.
+func SessionOf(tokenString string, allowExpired bool) (userID, sessionID string, err error) {
+	var jwtSecret = []byte(os.Getenv("SECRET_KEY"))
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return jwtSecret, nil
+	})
+	var validationErr *jwt.ValidationError
+	if err != nil && !(allowExpired && errors.As(err, &validationErr) && validationErr.Errors == jwt.ValidationErrorExpired) {
+		return "", "", err
+	}
+	userID, _ = claims["user_id"].(string)
+	sessionID, _ = claims["sid"].(string)
+	if userID == "" || sessionID == "" {
+		return "", "", errors.New("token names no session")
+	}
+	return userID, sessionID, nil
+}
+
+// TouchSession records that a session was used from ip, at most once per
+// minute from the same address
+func TouchSession(ctx context.Context, tokens TokenStore, session models.Token, ip string) error {
+	now := time.Now().UTC()
+	if session.IP == ip && now.Sub(session.LastUsedAt) < sessionTouchInterval {
+		return nil
+	}
+	session.IP = ip
+	session.LastUsedAt = now
+	// A refresh at the same time records the use as well
+	err := tokens.RotateToken(ctx, session, session.RefreshHash)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// ListSessions returns the open sessions of the user, most recently used
+// first, marking the one with the ID current
+func (s *UserService) ListSessions(userId primitive.ObjectID, current string) ([]models.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	all, err := s.tokens.FindTokens(ctx, userId.Hex())
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	sessions := []models.Token{}
+	for _, session := range all {
+		if session.Exp < now {
+			continue
+		}
+		session.Current = session.ID == current
+		sessions = append(sessions, session)
+	}
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt) })
+	return sessions, nil
+}
+
+// RevokeSession ends a session of the user, its tokens stop working at once
+func (s *UserService) RevokeSession(userId primitive.ObjectID, id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	session, err := s.tokens.FindToken(ctx, id)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userId.Hex() {
+		return ErrNotFound
+	}
+	return s.tokens.DeleteToken(ctx, id)
+}
+
+// RevokeAllSessions logs the user out everywhere
+func (s *UserService) RevokeAllSessions(userId primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return s.tokens.DeleteTokens(ctx, userId.Hex())
+}
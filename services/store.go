@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"todo-cli/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrNotFound is returned by the stores when no document matches a lookup
+var ErrNotFound = errors.New("not found")
+
+// ErrUsernameTaken is returned by InsertUser when another user has the username
+var ErrUsernameTaken = errors.New("username is already taken")
+
+// TodoStore persists todos. Every lookup is scoped to the owning user.
+type TodoStore interface {
+	InsertTodo(ctx context.Context, todo models.Todo) error
+	// FindTodos returns the todos of the user passing the query, in its sort
+	// order when it has one
+	FindTodos(ctx context.Context, userID primitive.ObjectID, query TodoQuery) ([]models.Todo, error)
+	// ScanTodos calls fn for every todo owned by the user without loading them
+	// all at once. fn must not use the store, and an error from it stops the scan.
+	ScanTodos(ctx context.Context, userID primitive.ObjectID, fn func(models.Todo) error) error
+	// SearchTodos returns the todos of the user passing the query whose title
+	// or notes match any of the lower case terms, best match first
+	SearchTodos(ctx context.Context, userID primitive.ObjectID, terms []string, query TodoQuery, limit int) ([]TodoMatch, error)
+	FindTodo(ctx context.Context, id, userID primitive.ObjectID) (models.Todo, error)
+	// ReplaceTodo overwrites a stored todo as long as it is still at
+	// version, the version it was read at, in the same step. It returns a
+	// *VersionMismatchError when the todo was changed in the meantime.
+	ReplaceTodo(ctx context.Context, todo models.Todo, version int64) error
+	DeleteTodo(ctx context.Context, id, userID primitive.ObjectID) error
+	// PurgeTodos deletes the todos of every user that were moved to the trash
+	// before the given time and returns them. Their history is kept.
+	PurgeTodos(ctx context.Context, before time.Time) ([]models.Todo, error)
+	// ArchiveTodos archives the todos of every user that were completed before
+	// the given time and are neither archived nor in the trash yet, and
+	// returns them as they were before
+	ArchiveTodos(ctx context.Context, completedBefore, archivedAt time.Time) ([]models.Todo, error)
+}
+
+// TodoQuery narrows down the todos a store looks at, the zero value takes
+// every todo in the order they were stored
+type TodoQuery struct {
+	Trashed   *bool // Todos in the trash only when true, none when false
+	Archived  *bool // Archived todos only when true, none when false
+	Completed *bool
+	Project   *primitive.ObjectID
+	Inbox     bool                 // only todos without a project
+	Tags      []string             // todos must carry every one of these tags
+	Parents   []primitive.ObjectID // only subtasks of these todos, when set
+	Series    *primitive.ObjectID  // only occurrences of this recurring series
+	Created   TimeRange
+	Updated   TimeRange
+
+	// Sort orders the todos the way TodoSort.Less does, After leaves out
+	// the todos up to and including the given one in that order and Limit
+	// returns at most that many, 0 for no limit
+	Sort  TodoSort
+	After *models.Todo
+	Limit int
+}
+
+// TimeRange holds the times in [After, Before), either bound may be nil
+type TimeRange struct {
+	After  *time.Time // inclusive
+	Before *time.Time // exclusive
+}
+
+// Contains reports whether t is in the range
+func (r TimeRange) Contains(t time.Time) bool {
+	return (r.After == nil || !t.Before(*r.After)) && (r.Before == nil || t.Before(*r.Before))
+}
+
+// Match reports whether a todo passes the conditions of the query, for
+// stores that check it one todo at a time
+func (q TodoQuery) Match(todo models.Todo) bool {
+	if q.Trashed != nil && *q.Trashed != (todo.DeletedAt != nil) {
+		return false
+	}
+	if q.Archived != nil && *q.Archived != (todo.ArchivedAt != nil) {
+		return false
+	}
+	if q.Completed != nil && *q.Completed != todo.Completed {
+		return false
+	}
+	if q.Inbox && todo.ProjectID != nil {
+		return false
+	}
+	if q.Project != nil && (todo.ProjectID == nil || *todo.ProjectID != *q.Project) {
+		return false
+	}
+	for _, tag := range q.Tags {
+		if !todo.HasTag(tag) {
+			return false
+		}
+	}
+	if q.Parents != nil && (todo.ParentID == nil || !containsID(q.Parents, *todo.ParentID)) {
+		return false
+	}
+	if q.Series != nil && (todo.SeriesID == nil || *todo.SeriesID != *q.Series) {
+		return false
+	}
+	return q.Created.Contains(todo.CreatedAt) && q.Updated.Contains(todo.UpdatedAt)
+}
+
+// Ordered reports whether the query asks for the todos in sort order
+func (q TodoQuery) Ordered() bool {
+	return len(q.Sort) > 0 || q.After != nil
+}
+
+// Select runs the query on todos, for stores that keep them in memory
+func (q TodoQuery) Select(todos []models.Todo) []models.Todo {
+	selected := []models.Todo{}
+	for _, todo := range todos {
+		if q.Match(todo) && (q.After == nil || q.Sort.Less(*q.After, todo)) {
+			selected = append(selected, todo)
+		}
+	}
+	if q.Ordered() {
+		sort.SliceStable(selected, func(i, j int) bool { return q.Sort.Less(selected[i], selected[j]) })
+	}
+	if q.Limit > 0 && len(selected) > q.Limit {
+		selected = selected[:q.Limit]
+	}
+	return selected
+}
+
+func containsID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, own := range ids {
+		if own == id {
+			return true
+		}
+	}
+	return false
+}
+
+// TodoMatch is a todo found by a full-text search, a higher score is a better match
+type TodoMatch struct {
+	Todo  models.Todo
+	Score float64
+}
+
+// ProjectStore persists projects. Every lookup is scoped to the owning user.
+type ProjectStore interface {
+	InsertProject(ctx context.Context, project models.Project) error
+	FindProjects(ctx context.Context, userID primitive.ObjectID) ([]models.Project, error)
+	FindProject(ctx context.Context, id, userID primitive.ObjectID) (models.Project, error)
+	ReplaceProject(ctx context.Context, project models.Project) error
+	DeleteProject(ctx context.Context, id, userID primitive.ObjectID) error
+}
+
+// ViewStore persists the saved views of users. Every lookup is scoped to the owning user.
+type ViewStore interface {
+	InsertView(ctx context.Context, view models.SavedView) error
+	FindViews(ctx context.Context, userID primitive.ObjectID) ([]models.SavedView, error)
+	FindView(ctx context.Context, id, userID primitive.ObjectID) (models.SavedView, error)
+	ReplaceView(ctx context.Context, view models.SavedView) error
+	DeleteView(ctx context.Context, id, userID primitive.ObjectID) error
+}
+
+// EventStore persists the history of todos. Every lookup is scoped to the owning user.
+type EventStore interface {
+	InsertEvent(ctx context.Context, event models.TodoEvent) error
+	// FindEvents returns the history of a todo, oldest first
+	FindEvents(ctx context.Context, todoID, userID primitive.ObjectID) ([]models.TodoEvent, error)
+}
+
+// OperationStore persists the undo log of users. Every lookup is scoped to the owning user.
+type OperationStore interface {
+	InsertOperation(ctx context.Context, op models.Operation) error
+	// FindOperations returns the logged operations of the user, oldest first
+	FindOperations(ctx context.Context, userID primitive.ObjectID) ([]models.Operation, error)
+	ReplaceOperation(ctx context.Context, op models.Operation) error
+	DeleteOperation(ctx context.Context, id, userID primitive.ObjectID) error
+}
+
+// UserStore persists registered users
+type UserStore interface {
+	InsertUser(ctx context.Context, user models.User) error
+	FindUserByID(ctx context.Context, id primitive.ObjectID) (models.User, error)
+	FindUserByUsername(ctx context.Context, username string) (models.User, error)
+}
+
+// TokenStore persists the sessions logins open, so they can be refreshed
+// and revoked, and the personal access tokens of users
+type TokenStore interface {
+	InsertToken(ctx context.Context, token models.Token) error
+	FindToken(ctx context.Context, id string) (models.Token, error)
+	// RotateToken replaces a stored token as long as its refresh token is
+	// still the one hashed as refreshHash, ErrNotFound otherwise
+	RotateToken(ctx context.Context, token models.Token, refreshHash string) error
+	// FindTokens returns every session of the user
+	FindTokens(ctx context.Context, userID string) ([]models.Token, error)
+	DeleteToken(ctx context.Context, id string) error
+	// DeleteTokens ends every session of the user
+	DeleteTokens(ctx context.Context, userID string) error
+
+	InsertAccessToken(ctx context.Context, token models.AccessToken) error
+	// FindAccessToken returns an access token whoever owns it, to
+	// authenticate the request it came with
+	FindAccessToken(ctx context.Context, id primitive.ObjectID) (models.AccessToken, error)
+	// FindAccessTokens returns the access tokens of the user, oldest first
+	FindAccessTokens(ctx context.Context, userID primitive.ObjectID) ([]models.AccessToken, error)
+	ReplaceAccessToken(ctx context.Context, token models.AccessToken) error
+	DeleteAccessToken(ctx context.Context, id, userID primitive.ObjectID) error
+}
+
+// Stores bundles the storage backends the services and API run on
+type Stores struct {
+	Todos      TodoStore
+	Projects   ProjectStore
+	Views      ViewStore
+	Events     EventStore
+	Operations OperationStore
+	Users      UserStore
+	Tokens     TokenStore
+	// Transactions runs changes to the stores as one transaction, nil when
+	// the backend cannot
+	Transactions Transactor
+}
+
+// ErrNoTransactions is returned by InTransaction when the backend cannot run
+// changes as one transaction, e.g. a MongoDB server that is not a replica set
+var ErrNoTransactions = errors.New("the storage backend does not support transactions")
+
+// Transactor runs changes to the stores as one transaction
+type Transactor interface {
+	// InTransaction calls fn with stores whose changes are all kept when fn
+	// returns nil and all discarded when it returns an error. fn must only
+	// use the stores it is given, which are not safe for concurrent use.
+	InTransaction(ctx context.Context, fn func(ctx context.Context, stores Stores) error) error
+}
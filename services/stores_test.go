@@ -0,0 +1,21 @@
+package services_test
+
+import (
+	"testing"
+
+	"todo-cli/db"
+	"todo-cli/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// openStores opens an in-memory store of its own for the test, named
+// stores live as long as the process does
+func openStores(t *testing.T) services.Stores {
+	t.Helper()
+	store, err := db.Open("memory://" + t.Name() + "/" + primitive.NewObjectID().Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store.Stores()
+}
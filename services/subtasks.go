@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"todo-cli/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidParent is returned when a subtask would end up below itself
+var ErrInvalidParent = errors.New("a todo cannot be a subtask of itself or of its own subtasks")
+
+// ErrParentNotFound is returned when a subtask refers to a todo the user does not own
+var ErrParentNotFound = errors.New("parent todo not found")
+
+// checkParent makes sure a subtask refers to a todo of its owner and that the
+// hierarchy stays a tree
+func (s *TodoService) checkParent(ctx context.Context, todo models.Todo) error {
+	for parentID := todo.ParentID; parentID != nil; {
+		if *parentID == todo.ID {
+			return ErrInvalidParent
+		}
+		parent, err := s.store.FindTodo(ctx, *parentID, todo.UserID)
+		if errors.Is(err, ErrNotFound) {
+			return ErrParentNotFound
+		}
+		if err != nil {
+			return err
+		}
+		parentID = parent.ParentID
+	}
+	return nil
+}
+
+// childrenOf groups todos by their parent
+func childrenOf(todos []models.Todo) map[primitive.ObjectID][]models.Todo {
+	children := map[primitive.ObjectID][]models.Todo{}
+	for _, todo := range todos {
+		if todo.ParentID != nil {
+			children[*todo.ParentID] = append(children[*todo.ParentID], todo)
+		}
+	}
+	return children
+}
+
+// progressOf counts how many of the subtasks are completed
+func progressOf(children []models.Todo) *models.Progress {
+	if len(children) == 0 {
+		return nil
+	}
+	progress := models.Progress{Total: len(children)}
+	for _, child := range children {
+		if child.Completed {
+			progress.Done++
+		}
+	}
+	return summarize(&progress)
+}
+
+// countSubtask adds a todo to the progress of its parent
+func countSubtask(progress map[primitive.ObjectID]*models.Progress, todo models.Todo) {
+	if todo.ParentID == nil {
+		return
+	}
+	counted, ok := progress[*todo.ParentID]
+	if !ok {
+		counted = &models.Progress{}
+		progress[*todo.ParentID] = counted
+	}
+	counted.Total++
+	if todo.Completed {
+		counted.Done++
+	}
+}
+
+// summarize fills in the summary of counted progress, nil stays nil
+func summarize(progress *models.Progress) *models.Progress {
+	if progress == nil {
+		return nil
+	}
+	summarized := *progress
+	summarized.Summary = fmt.Sprintf("%d/%d done", summarized.Done, summarized.Total)
+	return &summarized
+}
+
+// descendantsOf returns the IDs of all subtasks below id, deepest last
+func descendantsOf(children map[primitive.ObjectID][]models.Todo, id primitive.ObjectID) []primitive.ObjectID {
+	var ids []primitive.ObjectID
+	for _, child := range children[id] {
+		ids = append(ids, child.ID)
+		ids = append(ids, descendantsOf(children, child.ID)...)
+	}
+	return ids
+}
+
+// autoCompleteParents reports whether completing the last open subtask also
+// completes its parent, set AUTO_COMPLETE_PARENTS=false to turn it off
+func autoCompleteParents() bool {
+	return os.Getenv("AUTO_COMPLETE_PARENTS") != "false"
+}
+
+// completeParents completes the ancestors of a just completed subtask whose
+// subtasks are now all completed
+func (s *TodoService) completeParents(ctx context.Context, todo models.Todo) error {
+	if !autoCompleteParents() || !todo.Completed || todo.ParentID == nil {
+		return nil
+	}
+
+	open := false
+	for parentID := todo.ParentID; parentID != nil; {
+		parent, err := s.store.FindTodo(ctx, *parentID, todo.UserID)
+		if err != nil {
+			return err
+		}
+		if parent.Completed {
+			return nil
+		}
+		children, err := s.store.FindTodos(ctx, todo.UserID, TodoQuery{Parents: []primitive.ObjectID{parent.ID}, Completed: &open})
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if child.ID != todo.ID {
+				return nil
+			}
+		}
+
+		parent.Completed = true
+		parent.UpdatedAt = todo.UpdatedAt
+		parent.CompletedAt = &parent.UpdatedAt
+		parent.Version++
+		if err := s.store.ReplaceTodo(ctx, parent, parent.Version-1); err != nil {
+			return err
+		}
+		// The completed parent may in turn be the last open subtask of its parent
+		todo = parent
+		parentID = parent.ParentID
+	}
+	return nil
+}
+
+// withChildren fills in the direct subtasks of a todo and their progress
+func (s *TodoService) withChildren(ctx context.Context, todo models.Todo, now time.Time) (models.Todo, error) {
+	children, err := s.store.FindTodos(ctx, todo.UserID, TodoQuery{Parents: []primitive.ObjectID{todo.ID}})
+	if err != nil {
+		return todo, err
+	}
+	// Only the subtasks of the children are counted for their progress
+	subtasks := map[primitive.ObjectID]*models.Progress{}
+	if len(children) > 0 {
+		ids := make([]primitive.ObjectID, len(children))
+		for i, child := range children {
+			ids[i] = child.ID
+		}
+		grandchildren, err := s.store.FindTodos(ctx, todo.UserID, TodoQuery{Parents: ids})
+		if err != nil {
+			return todo, err
+		}
+		for _, grandchild := range grandchildren {
+			countSubtask(subtasks, grandchild)
+		}
+	}
+
+	todo.Children = nil
+	for _, child := range children {
+		child = withComputed(child, now)
+		child.Progress = summarize(subtasks[child.ID])
+		todo.Children = append(todo.Children, child)
+	}
+	sortByPosition(todo.Children)
+	todo.Progress = progressOf(children)
+	return todo, nil
+}
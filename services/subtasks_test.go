@@ -0,0 +1,75 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"todo-cli/models"
+	"todo-cli/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSubtaskProgress(t *testing.T) {
+	todos := services.NewTodoService(openStores(t))
+	userID := primitive.NewObjectID()
+	parent := addTodos(t, todos, userID, models.Todo{Title: "move"})[0]
+	children := addTodos(t, todos, userID,
+		models.Todo{Title: "pack", ParentID: &parent.ID},
+		models.Todo{Title: "clean", ParentID: &parent.ID, Completed: true},
+		models.Todo{Title: "forgotten", ParentID: &parent.ID})
+	addTodos(t, todos, userID,
+		models.Todo{Title: "books", ParentID: &children[0].ID, Completed: true},
+		models.Todo{Title: "dishes", ParentID: &children[0].ID})
+	// Subtasks in the trash do not count
+	if err := todos.DeleteTodo(children[2].ID.Hex(), userID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := todos.GetTodoByID(parent.ID.Hex(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Progress == nil || got.Progress.Summary != "1/2 done" {
+		t.Errorf("parent progress is %+v, want 1/2 done", got.Progress)
+	}
+	progress := map[string]*models.Progress{}
+	for _, child := range got.Children {
+		progress[child.Title] = child.Progress
+	}
+	if len(got.Children) != 2 {
+		t.Fatalf("parent has %d children, want pack and clean", len(got.Children))
+	}
+	if progress["pack"] == nil || progress["pack"].Summary != "1/2 done" || progress["clean"] != nil {
+		t.Errorf("children progress is %+v and %+v, want 1/2 done and none", progress["pack"], progress["clean"])
+	}
+}
+
+func TestCompleteParents(t *testing.T) {
+	t.Setenv("AUTO_COMPLETE_PARENTS", "")
+	todos := services.NewTodoService(openStores(t))
+	userID := primitive.NewObjectID()
+	parent := addTodos(t, todos, userID, models.Todo{Title: "move"})[0]
+	children := addTodos(t, todos, userID,
+		models.Todo{Title: "pack", ParentID: &parent.ID},
+		models.Todo{Title: "forgotten", ParentID: &parent.ID})
+	subtask := addTodos(t, todos, userID, models.Todo{Title: "books", ParentID: &children[0].ID})[0]
+	if err := todos.DeleteTodo(children[1].ID.Hex(), userID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	done := true
+	if _, err := todos.UpdateTodo(subtask.ID.Hex(), userID, models.TodoUpdate{Completed: &done, UpdatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	// The open subtask in the trash does not keep the parent open
+	for _, todo := range []models.Todo{children[0], parent} {
+		stored, err := todos.GetTodoByID(todo.ID.Hex(), userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !stored.Completed {
+			t.Errorf("%q is still open after its last subtask was completed", todo.Title)
+		}
+	}
+}
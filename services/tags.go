@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"todo-cli/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidTag is returned for an empty tag name
+var ErrInvalidTag = errors.New("tag must not be empty")
+
+// TagCount is a tag with the number of todos carrying it
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// normalizeTags trims the tags and drops empty and repeated ones
+func normalizeTags(tags []string) []string {
+	var normalized []string
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// ListTags returns every tag of the user's todos with its usage count, by name
+func (s *TodoService) ListTags(userId primitive.ObjectID) ([]TagCount, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	todos, err := s.store.FindTodos(ctx, userId, TodoQuery{})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{}
+	for _, todo := range todos {
+		for _, tag := range todo.Tags {
+			counts[tag]++
+		}
+	}
+	tags := []TagCount{}
+	for tag, count := range counts {
+		tags = append(tags, TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Tag < tags[j].Tag })
+	return tags, nil
+}
+
+// RenameTag renames a tag on all of the user's todos, merging it into newName
+// where a todo already carries both. It returns the number of todos changed.
+func (s *TodoService) RenameTag(userId primitive.ObjectID, oldName, newName string) (int, error) {
+	newName = strings.TrimSpace(newName)
+	if newName == "" {
+		return 0, ErrInvalidTag
+	}
+	return s.retag(userId, oldName, func(tags []string) []string {
+		renamed := make([]string, len(tags))
+		for i, tag := range tags {
+			if tag == oldName {
+				tag = newName
+			}
+			renamed[i] = tag
+		}
+		return normalizeTags(renamed)
+	})
+}
+
+// DeleteTag removes a tag from all of the user's todos and returns the number of todos changed
+func (s *TodoService) DeleteTag(userId primitive.ObjectID, name string) (int, error) {
+	return s.retag(userId, name, func(tags []string) []string {
+		return removeTag(tags, name)
+	})
+}
+
+// retag rewrites the tags of every todo of the user carrying tag
+func (s *TodoService) retag(userId primitive.ObjectID, tag string, rewrite func([]string) []string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	todos, err := s.store.FindTodos(ctx, userId, TodoQuery{})
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	now := time.Now()
+	for _, todo := range todos {
+		if !todo.HasTag(tag) {
+			continue
+		}
+		todo.Tags = rewrite(todo.Tags)
+		todo.UpdatedAt = now
+		todo.Version++
+		if err := s.store.ReplaceTodo(ctx, todo, todo.Version-1); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// AddTags labels a todo with more tags
+func (s *TodoService) AddTags(id string, userId primitive.ObjectID, tags []string) (models.Todo, error) {
+	todo, err := s.GetTodoByID(id, userId)
+	if err != nil {
+		return todo, err
+	}
+	merged := normalizeTags(append(todo.Tags, tags...))
+	return s.UpdateTodo(id, userId, models.TodoUpdate{Tags: &merged, UpdatedAt: time.Now()})
+}
+
+// RemoveTags takes tags off a todo
+func (s *TodoService) RemoveTags(id string, userId primitive.ObjectID, tags []string) (models.Todo, error) {
+	todo, err := s.GetTodoByID(id, userId)
+	if err != nil {
+		return todo, err
+	}
+	remaining := todo.Tags
+	for _, tag := range tags {
+		remaining = removeTag(remaining, tag)
+	}
+	return s.UpdateTodo(id, userId, models.TodoUpdate{Tags: &remaining, UpdatedAt: time.Now()})
+}
+
+func removeTag(tags []string, name string) []string {
+	var kept []string
+	for _, tag := range tags {
+		if tag != name {
+			kept = append(kept, tag)
+		}
+	}
+	return kept
+}
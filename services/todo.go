@@ -2,112 +2,509 @@ package services
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
 	"time"
 
-	"todo-cli/db"
 	"todo-cli/models"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// AddTodo adds a new todo to the MongoDB
-func AddTodo(todo models.Todo) (*mongo.InsertOneResult, error) {
+// ErrInvalidSchedule is returned when a todo would start after it is due
+var ErrInvalidSchedule = errors.New("start_at must not be after due_at")
 
-	collection := db.GetCollection("go-todo-db", "todos")
+// maxNotesLength matches the validate tag of models.Todo.Notes
+const maxNotesLength = 20000
+
+// ErrNotesTooLong is returned when the notes of a todo exceed maxNotesLength
+var ErrNotesTooLong = fmt.Errorf("notes must not be longer than %d characters", maxNotesLength)
+
+// Due date filters understood by TodoFilter.Due
+const (
+	DueOverdue = "overdue"
+	DueToday   = "today"
+)
+
+// TodoFilter narrows down the todos returned by GetTodos
+type TodoFilter struct {
+	Due      string         // "", DueOverdue or DueToday
+	Location *time.Location // timezone "today" is evaluated in, defaults to the server's
+	Tags     []string       // todos must carry every one of these tags
+	Project  *primitive.ObjectID
+	Inbox    bool   // only todos without a project
+	Archived string // "" leaves archived todos out, ArchivedOnly or ArchivedAll
+
+	Completed     *bool
+	CreatedAfter  *time.Time // inclusive
+	CreatedBefore *time.Time // exclusive
+	UpdatedAfter  *time.Time // inclusive
+	UpdatedBefore *time.Time // exclusive
+
+	Expr     FilterExpr                    // from ParseFilterExpr, nil for none
+	projects map[primitive.ObjectID]string // project names the expression may refer to
+}
+
+// Match reports whether the todo passes the filter at the given time
+func (f TodoFilter) Match(todo models.Todo, now time.Time) bool {
+	if !matchArchived(todo, f.Archived) {
+		return false
+	}
+	if f.Inbox && todo.ProjectID != nil {
+		return false
+	}
+	if f.Project != nil && (todo.ProjectID == nil || *todo.ProjectID != *f.Project) {
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !todo.HasTag(tag) {
+			return false
+		}
+	}
+	if f.Completed != nil && todo.Completed != *f.Completed {
+		return false
+	}
+	if !(TimeRange{f.CreatedAfter, f.CreatedBefore}).Contains(todo.CreatedAt) || !(TimeRange{f.UpdatedAfter, f.UpdatedBefore}).Contains(todo.UpdatedAt) {
+		return false
+	}
+	if f.Expr != nil && !f.Expr.match(todo, filterEnv{now: now, location: f.location(), projects: f.projects}) {
+		return false
+	}
+
+	switch f.Due {
+	case DueOverdue:
+		return todo.IsOverdue(now)
+	case DueToday:
+		if todo.DueAt == nil {
+			return false
+		}
+		loc := f.location()
+		y, m, d := now.In(loc).Date()
+		startOfDay := time.Date(y, m, d, 0, 0, 0, 0, loc)
+		return !todo.DueAt.Before(startOfDay) && todo.DueAt.Before(startOfDay.AddDate(0, 0, 1))
+	}
+	return true
+}
+
+// location returns the timezone days are evaluated in
+func (f TodoFilter) location() *time.Location {
+	if f.Location == nil {
+		return time.Local
+	}
+	return f.Location
+}
+
+// storeQuery returns the conditions of the filter a store can check itself,
+// along with the tag, project and done conditions the whole expression
+// depends on. The due date and the rest of the expression are left to Match.
+func (f TodoFilter) storeQuery() TodoQuery {
+	query := TodoQuery{
+		Archived:  archivedQuery(f.Archived),
+		Completed: f.Completed,
+		Project:   f.Project,
+		Inbox:     f.Inbox,
+		Tags:      f.Tags,
+		Created:   TimeRange{f.CreatedAfter, f.CreatedBefore},
+		Updated:   TimeRange{f.UpdatedAfter, f.UpdatedBefore},
+	}
+	if f.Expr != nil {
+		narrowQuery(f.Expr, filterEnv{projects: f.projects}, &query)
+	}
+	return query
+}
+
+// ParseLocation accepts an IANA zone name (Europe/Berlin) or a UTC offset (+02:00)
+func ParseLocation(tz string) (*time.Location, error) {
+	if offset, err := time.Parse("-07:00", tz); err == nil {
+		_, seconds := offset.Zone()
+		return time.FixedZone(tz, seconds), nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tz %q", tz)
+	}
+	return loc, nil
+}
+
+// normalizeSchedule stores the schedule in UTC and checks it is in order
+func normalizeSchedule(todo *models.Todo) error {
+	if todo.StartAt != nil {
+		startAt := todo.StartAt.UTC()
+		todo.StartAt = &startAt
+	}
+	if todo.DueAt != nil {
+		dueAt := todo.DueAt.UTC()
+		todo.DueAt = &dueAt
+	}
+	if todo.StartAt != nil && todo.DueAt != nil && todo.StartAt.After(*todo.DueAt) {
+		return ErrInvalidSchedule
+	}
+	return nil
+}
+
+// withComputed fills in the fields derived at read time
+func withComputed(todo models.Todo, now time.Time) models.Todo {
+	todo.Overdue = todo.IsOverdue(now)
+	return todo
+}
+
+// TodoService implements the todo use cases on top of a TodoStore
+type TodoService struct {
+	store    TodoStore // the todos that are not in the trash
+	trash    TodoStore // every todo, including the ones in the trash
+	projects ProjectStore
+	events   EventStore
+	users    UserStore
+
+	operations OperationStore
+	undoDepth  int             // how many operations each user can undo, 0 logs none
+	recorder   *recordingTodos // set while the changes are recorded, see recording
+
+	transactions Transactor
+}
+
+// NewTodoService returns a TodoService persisting to the given stores
+func NewTodoService(stores Stores) *TodoService {
+	todos := auditedTodos{stores.Todos, stores.Events}
+	return &TodoService{
+		store:    liveTodos{todos},
+		trash:    todos,
+		projects: stores.Projects,
+		events:   stores.Events,
+		users:    stores.Users,
+
+		operations: stores.Operations,
+		undoDepth:  UndoDepth(),
+
+		transactions: stores.Transactions,
+	}
+}
+
+// inTransaction runs fn with a copy of the service whose changes are either
+// all stored, when fn succeeds, or none are. The changes are recorded for
+// undo once they are stored.
+func (s *TodoService) inTransaction(fn func(*TodoService) error) error {
+	if s.transactions == nil {
+		return ErrNoTransactions
+	}
+	// Long enough for the largest bulk request
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var recorder *recordingTodos
+	err := s.transactions.InTransaction(ctx, func(ctx context.Context, stores Stores) error {
+		scoped := NewTodoService(stores)
+		scoped.undoDepth = s.undoDepth
+		// The transaction may be retried, only the last attempt counts
+		recorder = nil
+		if s.recorder != nil {
+			scoped, recorder = scoped.recording()
+		}
+		return fn(scoped)
+	})
+	if err == nil && recorder != nil {
+		for _, id := range recorder.order {
+			change := recorder.changes[id]
+			s.recorder.record(id, change.Before, change.After)
+		}
+		s.recorder.projects = append(s.recorder.projects, recorder.projects...)
+	}
+	return err
+}
+
+// checkProject makes sure a todo only refers to a project of its owner
+func (s *TodoService) checkProject(ctx context.Context, todo models.Todo) error {
+	if todo.ProjectID == nil {
+		return nil
+	}
+	_, err := s.projects.FindProject(ctx, *todo.ProjectID, todo.UserID)
+	if errors.Is(err, ErrNotFound) {
+		return ErrProjectNotFound
+	}
+	return err
+}
+
+// AddTodo adds a new todo to the store
+func (s *TodoService) AddTodo(todo models.Todo) (models.Todo, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	result, err := collection.InsertOne(ctx, todo)
-	if err != nil {
-		log.Fatal(err)
-		return nil, err
+	if err := normalizeSchedule(&todo); err != nil {
+		return models.Todo{}, err
 	}
-	return result, nil
+	if err := normalizeRepeat(&todo); err != nil {
+		return models.Todo{}, err
+	}
+	if todo.Position == 0 {
+		todo.Position = newPosition(todo.CreatedAt)
+	}
+	todo.Version = 1
+	todo.Tags = normalizeTags(todo.Tags)
+	if err := s.checkProject(ctx, todo); err != nil {
+		return models.Todo{}, err
+	}
+	if err := s.checkParent(ctx, todo); err != nil {
+		return models.Todo{}, err
+	}
+	if err := s.store.InsertTodo(ctx, todo); err != nil {
+		return models.Todo{}, err
+	}
+	return withComputed(todo, time.Now()), nil
 }
 
-// GetTodos retrieves all todos from MongoDB
-func GetTodos(userId primitive.ObjectID) ([]models.Todo, error) {
-	collection := db.GetCollection("go-todo-db", "todos")
+// GetTodos retrieves one page of the todos of the user matching the filter.
+// The store sorts the todos and resumes after the cursor, so only the page
+// being built is read, and more is only read while conditions it cannot
+// check leave the page short.
+func (s *TodoService) GetTodos(userId primitive.ObjectID, filter TodoFilter, page PageRequest) (TodoPage, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	filter := bson.M{"user_id": userId}
+	order := page.Sort
+	if len(order) == 0 {
+		order = DefaultTodoSort
+	}
+	limit := page.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	var after *models.Todo
+	if page.Cursor != "" {
+		last, err := decodeCursor(order, page.Cursor)
+		if err != nil {
+			return TodoPage{}, err
+		}
+		after = &last
+	}
+
+	if filter.Expr != nil {
+		// The expression may name projects rather than give their ID
+		projects, err := s.projects.FindProjects(ctx, userId)
+		if err != nil {
+			return TodoPage{}, err
+		}
+		filter.projects = make(map[primitive.ObjectID]string, len(projects))
+		for _, project := range projects {
+			filter.projects[project.ID] = project.Name
+		}
+	}
+
+	now := time.Now()
+	// One more todo than the page holds tells whether there is a next page
+	query := filter.storeQuery()
+	query.Sort, query.After, query.Limit = order, after, limit+1
+	found := []models.Todo{}
+	for len(found) <= limit {
+		batch, err := s.store.FindTodos(ctx, userId, query)
+		if err != nil {
+			return TodoPage{}, err
+		}
+		for _, todo := range batch {
+			if filter.Match(todo, now) {
+				found = append(found, todo)
+			}
+		}
+		if len(batch) < query.Limit {
+			break
+		}
+		query.After = &batch[len(batch)-1]
+	}
 
-	cursor, err := collection.Find(ctx, filter)
-	if err != nil {
-		log.Fatal(err)
-		return nil, err
+	result := TodoPage{Todos: found}
+	if len(result.Todos) > limit {
+		result.Todos = result.Todos[:limit]
+		var err error
+		if result.NextCursor, err = encodeCursor(order, result.Todos[limit-1]); err != nil {
+			return TodoPage{}, err
+		}
 	}
-	defer cursor.Close(ctx)
 
-	var todos []models.Todo
-	for cursor.Next(ctx) {
-		var todo models.Todo
-		err := cursor.Decode(&todo)
+	// Only the subtasks of the todos on the page are counted
+	parents := make([]primitive.ObjectID, len(result.Todos))
+	for i, todo := range result.Todos {
+		parents[i] = todo.ID
+	}
+	subtasks := map[primitive.ObjectID]*models.Progress{}
+	if len(parents) > 0 {
+		children, err := s.store.FindTodos(ctx, userId, TodoQuery{Parents: parents})
 		if err != nil {
-			log.Fatal(err)
-			return nil, err
+			return TodoPage{}, err
+		}
+		for _, child := range children {
+			countSubtask(subtasks, child)
 		}
-		todos = append(todos, todo)
 	}
-	return todos, nil
+	for i, todo := range result.Todos {
+		result.Todos[i] = withComputed(todo, now)
+		result.Todos[i].Progress = summarize(subtasks[todo.ID])
+	}
+	return result, nil
 }
 
-// GetTodoByID retrieves a todo by its ID
-func GetTodoByID(id string, userId primitive.ObjectID) (models.Todo, error) {
-	collection := db.GetCollection("go-todo-db", "todos")
+// findTodo looks up a todo of the user by its hex ID
+func (s *TodoService) findTodo(ctx context.Context, id string, userId primitive.ObjectID) (models.Todo, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.Todo{}, ErrNotFound
+	}
+	return s.store.FindTodo(ctx, objectID, userId)
+}
+
+// GetTodoByID retrieves a todo by its ID along with its direct subtasks
+func (s *TodoService) GetTodoByID(id string, userId primitive.ObjectID) (models.Todo, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	objectID, _ := primitive.ObjectIDFromHex(id)
-	var todo models.Todo
-	err := collection.FindOne(ctx, bson.M{"_id": objectID, "user_id": userId}).Decode(&todo)
+	todo, err := s.findTodo(ctx, id, userId)
 	if err != nil {
 		return todo, err
 	}
-	return todo, nil
+	now := time.Now()
+	return s.withChildren(ctx, withComputed(todo, now), now)
 }
 
-// UpdateTodo updates an existing todo in MongoDB
-func UpdateTodo(id string, userId primitive.ObjectID, updatedTodo models.TodoUpdate) (*mongo.UpdateResult, error) {
-	collection := db.GetCollection("go-todo-db", "todos")
+// UpdateTodo updates an existing todo and returns the stored result. With a
+// version set it fails unless the todo is still at that version when it is
+// written, otherwise a change made in the meantime is updated in turn.
+func (s *TodoService) UpdateTodo(id string, userId primitive.ObjectID, updatedTodo models.TodoUpdate) (models.Todo, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	objectID, _ := primitive.ObjectIDFromHex(id)
-	filter := bson.M{"_id": objectID, "user_id": userId}
-	updateFields := bson.M{
-		"updated_at": updatedTodo.UpdatedAt,
+	var todo models.Todo
+	var wasCompleted bool
+	var err error
+	for attempt := 1; ; attempt++ {
+		todo, wasCompleted, err = s.applyUpdate(ctx, id, userId, updatedTodo)
+		var mismatch *VersionMismatchError
+		if updatedTodo.Version == nil && errors.As(err, &mismatch) && attempt < maxUpdateAttempts {
+			continue
+		}
+		if err != nil {
+			return models.Todo{}, err
+		}
+		break
 	}
-	if updatedTodo.Title != "" {
-		updateFields["title"] = updatedTodo.Title
+
+	if !wasCompleted && todo.Completed {
+		// Completing one occurrence of a recurring todo schedules the next one
+		if err := s.scheduleNext(ctx, todo); err != nil {
+			return models.Todo{}, err
+		}
 	}
 	if updatedTodo.Completed != nil {
-		updateFields["completed"] = *updatedTodo.Completed // Dereference the pointer to get the actual bool value
+		if err := s.completeParents(ctx, todo); err != nil {
+			return models.Todo{}, err
+		}
 	}
+	return withComputed(todo, time.Now()), nil
+}
 
-	update := bson.M{"$set": updateFields}
-
-	result, err := collection.UpdateOne(ctx, filter, update)
+// applyUpdate stores the update of a todo, as long as the todo is not
+// changed between reading and writing it, and returns the stored result and
+// whether the todo was completed before
+func (s *TodoService) applyUpdate(ctx context.Context, id string, userId primitive.ObjectID, updatedTodo models.TodoUpdate) (models.Todo, bool, error) {
+	todo, err := s.findTodo(ctx, id, userId)
 	if err != nil {
-		return nil, err
+		return todo, false, err
 	}
-	return result, nil
+	if err := checkVersion(todo, updatedTodo.Version); err != nil {
+		return models.Todo{}, false, err
+	}
+
+	wasCompleted := todo.Completed
+	version := todo.Version
+	todo.UpdatedAt = updatedTodo.UpdatedAt
+	todo.Version++
+	if updatedTodo.Title != "" {
+		todo.Title = updatedTodo.Title
+	}
+	if updatedTodo.Notes != nil {
+		if len([]rune(*updatedTodo.Notes)) > maxNotesLength {
+			return models.Todo{}, false, ErrNotesTooLong
+		}
+		todo.Notes = *updatedTodo.Notes
+	}
+	if updatedTodo.Completed != nil {
+		todo.Completed = *updatedTodo.Completed // Dereference the pointer to get the actual bool value
+	}
+	if updatedTodo.Priority != nil {
+		todo.Priority = *updatedTodo.Priority
+	}
+	if updatedTodo.Tags != nil {
+		todo.Tags = normalizeTags(*updatedTodo.Tags)
+	}
+	if updatedTodo.ProjectID.Set {
+		todo.ProjectID = updatedTodo.ProjectID.ID
+	}
+	if updatedTodo.ParentID.Set {
+		todo.ParentID = updatedTodo.ParentID.ID
+	}
+	if updatedTodo.StartAt.Set {
+		todo.StartAt = updatedTodo.StartAt.Time
+	}
+	if updatedTodo.DueAt.Set {
+		todo.DueAt = updatedTodo.DueAt.Time
+	}
+	if updatedTodo.Repeat != nil {
+		todo.Repeat = *updatedTodo.Repeat
+	}
+	// A new rule or due date starts the series again from the due date
+	if updatedTodo.Repeat != nil || updatedTodo.DueAt.Set {
+		todo.RepeatStart = nil
+	}
+	if updatedTodo.RepeatTZ != nil {
+		todo.RepeatTZ = *updatedTodo.RepeatTZ
+	}
+	if err := setCompletion(&todo, wasCompleted, updatedTodo.Archived); err != nil {
+		return models.Todo{}, false, err
+	}
+	if err := normalizeSchedule(&todo); err != nil {
+		return models.Todo{}, false, err
+	}
+	if err := normalizeRepeat(&todo); err != nil {
+		return models.Todo{}, false, err
+	}
+	if err := s.checkProject(ctx, todo); err != nil {
+		return models.Todo{}, false, err
+	}
+	if updatedTodo.ParentID.Set {
+		if err := s.checkParent(ctx, todo); err != nil {
+			return models.Todo{}, false, err
+		}
+	}
+
+	if err := s.store.ReplaceTodo(ctx, todo, version); err != nil {
+		return models.Todo{}, false, err
+	}
+	return todo, wasCompleted, nil
 }
 
-// DeleteTodo deletes a todo by its ID from MongoDB
-func DeleteTodo(id string, userId primitive.ObjectID) (*mongo.DeleteResult, error) {
-	collection := db.GetCollection("go-todo-db", "todos")
+// DeleteTodo moves a todo by its ID together with its subtasks to the trash.
+// With a version set it fails unless the todo is still at that version.
+func (s *TodoService) DeleteTodo(id string, userId primitive.ObjectID, version *int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	objectID, _ := primitive.ObjectIDFromHex(id)
-	result, err := collection.DeleteOne(ctx, bson.M{"_id": objectID, "user_id": userId})
+	todo, err := s.findTodo(ctx, id, userId)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return result, nil
+	todos, err := s.store.FindTodos(ctx, userId, TodoQuery{})
+	if err != nil {
+		return err
+	}
+	// Checked against the todos as they are written back, each only if
+	// still unchanged
+	for _, other := range todos {
+		if other.ID == todo.ID {
+			todo = other
+		}
+	}
+	if err := checkVersion(todo, version); err != nil {
+		return err
+	}
+	return trashTodos(ctx, s.store, todos, todo.ID, time.Now())
 }
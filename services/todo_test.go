@@ -0,0 +1,254 @@
+package services_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"todo-cli/models"
+	"todo-cli/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// addTodos adds todos for the user, each created a minute after the one before
+func addTodos(t *testing.T, todos *services.TodoService, userID primitive.ObjectID, add ...models.Todo) []models.Todo {
+	t.Helper()
+	created := time.Date(2024, 10, 1, 9, 0, 0, 0, time.UTC)
+	var added []models.Todo
+	for i, todo := range add {
+		todo.ID = primitive.NewObjectID()
+		todo.UserID = userID
+		todo.CreatedAt = created.Add(time.Duration(i) * time.Minute)
+		todo.UpdatedAt = todo.CreatedAt
+		stored, err := todos.AddTodo(todo)
+		if err != nil {
+			t.Fatalf("AddTodo(%q) failed: %v", todo.Title, err)
+		}
+		added = append(added, stored)
+	}
+	return added
+}
+
+func titles(todos []models.Todo) []string {
+	var names []string
+	for _, todo := range todos {
+		names = append(names, todo.Title)
+	}
+	return names
+}
+
+func TestGetTodos(t *testing.T) {
+	stores := openStores(t)
+	todos := services.NewTodoService(stores)
+	userID := primitive.NewObjectID()
+	home, err := services.NewProjectService(stores).CreateProject(userID, "Home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTodos(t, todos, userID,
+		models.Todo{Title: "report", Tags: []string{"work"}, Priority: models.PriorityHigh},
+		models.Todo{Title: "groceries", Tags: []string{"errand"}, ProjectID: &home.ID},
+		models.Todo{Title: "taxes", Tags: []string{"work", "money"}, Priority: models.PriorityUrgent},
+		models.Todo{Title: "plants", ProjectID: &home.ID, Priority: models.PriorityLow},
+	)
+	// Todos of other users are never found
+	addTodos(t, todos, primitive.NewObjectID(), models.Todo{Title: "someone else's", Tags: []string{"work"}})
+
+	yes := true
+	tests := []struct {
+		name   string
+		filter services.TodoFilter
+		sort   string
+		want   []string
+	}{
+		{"most urgent first", services.TodoFilter{}, "", []string{"taxes", "report", "plants", "groceries"}},
+		{"by priority", services.TodoFilter{}, "-priority", []string{"taxes", "report", "plants", "groceries"}},
+		{"by title", services.TodoFilter{}, "title", []string{"groceries", "plants", "report", "taxes"}},
+		{"tag", services.TodoFilter{Tags: []string{"work"}}, "", []string{"taxes", "report"}},
+		{"every tag", services.TodoFilter{Tags: []string{"work", "money"}}, "", []string{"taxes"}},
+		{"project", services.TodoFilter{Project: &home.ID}, "", []string{"plants", "groceries"}},
+		{"inbox", services.TodoFilter{Inbox: true}, "", []string{"taxes", "report"}},
+		{"completed", services.TodoFilter{Completed: &yes}, "", nil},
+		{"expression", services.TodoFilter{Expr: mustParse(t, "tag:work priority>=urgent")}, "", []string{"taxes"}},
+		{"expression naming a project", services.TodoFilter{Expr: mustParse(t, "project:home OR tag:work")}, "title", []string{"groceries", "plants", "report", "taxes"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := services.ParseTodoSort(tt.sort)
+			if err != nil {
+				t.Fatal(err)
+			}
+			page, err := todos.GetTodos(userID, tt.filter, services.PageRequest{Sort: order})
+			if err != nil {
+				t.Fatalf("GetTodos failed: %v", err)
+			}
+			if got := titles(page.Todos); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetTodos returned %v, want %v", got, tt.want)
+			}
+			if page.NextCursor != "" {
+				t.Errorf("GetTodos returned a next page for a complete one")
+			}
+		})
+	}
+}
+
+func mustParse(t *testing.T, expr string) services.FilterExpr {
+	t.Helper()
+	parsed, err := services.ParseFilterExpr(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestGetTodosPages(t *testing.T) {
+	todos := services.NewTodoService(openStores(t))
+	userID := primitive.NewObjectID()
+	var add []models.Todo
+	for _, title := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		todo := models.Todo{Title: title, Priority: models.PriorityLow}
+		if title < "d" {
+			todo.Tags = []string{"odd"}
+			todo.Priority = models.PriorityHigh
+		}
+		add = append(add, todo)
+	}
+	addTodos(t, todos, userID, add...)
+
+	order, err := services.ParseTodoSort("priority,-title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		filter services.TodoFilter
+		want   []string
+	}{
+		{services.TodoFilter{}, []string{"g", "f", "e", "d", "c", "b", "a"}},
+		{services.TodoFilter{Tags: []string{"odd"}}, []string{"c", "b", "a"}},
+		// Only Go can check a text condition, so pages are filled from more than one read
+		{services.TodoFilter{Expr: mustParse(t, "NOT b NOT e")}, []string{"g", "f", "d", "c", "a"}},
+	} {
+		var got []string
+		cursor := ""
+		for pages := 0; ; pages++ {
+			if pages > len(tt.want) {
+				t.Fatalf("GetTodos keeps returning pages")
+			}
+			page, err := todos.GetTodos(userID, tt.filter, services.PageRequest{Sort: order, Limit: 2, Cursor: cursor})
+			if err != nil {
+				t.Fatalf("GetTodos failed: %v", err)
+			}
+			if len(page.Todos) > 2 {
+				t.Fatalf("GetTodos returned %d todos on a page of 2", len(page.Todos))
+			}
+			got = append(got, titles(page.Todos)...)
+			if cursor = page.NextCursor; cursor == "" {
+				break
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("paging through %+v returned %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestGetTodosProgress(t *testing.T) {
+	todos := services.NewTodoService(openStores(t))
+	userID := primitive.NewObjectID()
+	parent := addTodos(t, todos, userID, models.Todo{Title: "parent"})[0]
+	children := addTodos(t, todos, userID,
+		models.Todo{Title: "one", ParentID: &parent.ID},
+		models.Todo{Title: "two", ParentID: &parent.ID},
+	)
+	done := true
+	if _, err := todos.UpdateTodo(children[0].ID.Hex(), userID, models.TodoUpdate{Completed: &done, UpdatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := todos.GetTodos(userID, services.TodoFilter{}, services.PageRequest{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Todos) != 1 || page.Todos[0].Progress == nil {
+		t.Fatalf("GetTodos returned %+v, want the parent with its progress", page.Todos)
+	}
+	if got := *page.Todos[0].Progress; got.Done != 1 || got.Total != 2 {
+		t.Errorf("parent progress is %+v, want 1 of 2 done", got)
+	}
+}
+
+func TestUpdateTodoVersion(t *testing.T) {
+	todos := services.NewTodoService(openStores(t))
+	userID := primitive.NewObjectID()
+	todo := addTodos(t, todos, userID, models.Todo{Title: "report"})[0]
+	if todo.Version != 1 {
+		t.Fatalf("new todo is at version %d, want 1", todo.Version)
+	}
+	version := func(v int64) *int64 { return &v }
+
+	tests := []struct {
+		name        string
+		version     *int64
+		wantVersion int64
+		wantCurrent int64 // of the mismatch, 0 when the update goes through
+	}{
+		{"at the current version", version(1), 2, 0},
+		{"at an old version", version(1), 0, 2},
+		{"at a future version", version(5), 0, 2},
+		{"without a version", nil, 3, 0},
+		{"at the version after that", version(3), 4, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated, err := todos.UpdateTodo(todo.ID.Hex(), userID, models.TodoUpdate{Title: tt.name, Version: tt.version, UpdatedAt: time.Now()})
+			var mismatch *services.VersionMismatchError
+			if tt.wantCurrent != 0 {
+				if !errors.As(err, &mismatch) {
+					t.Fatalf("UpdateTodo returned %v, want a *VersionMismatchError", err)
+				}
+				if mismatch.Expected != *tt.version || mismatch.Current != tt.wantCurrent {
+					t.Errorf("mismatch is %+v, want the todo at version %d", mismatch, tt.wantCurrent)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UpdateTodo failed: %v", err)
+			}
+			if updated.Version != tt.wantVersion || updated.Title != tt.name {
+				t.Errorf("UpdateTodo stored %q at version %d, want %q at version %d", updated.Title, updated.Version, tt.name, tt.wantVersion)
+			}
+		})
+	}
+
+	stored, err := todos.GetTodoByID(todo.ID.Hex(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Title != "at the version after that" || stored.Version != 4 {
+		t.Errorf("stored todo is %q at version %d, a failed update changed it", stored.Title, stored.Version)
+	}
+}
+
+func TestDeleteTodoVersion(t *testing.T) {
+	todos := services.NewTodoService(openStores(t))
+	userID := primitive.NewObjectID()
+	todo := addTodos(t, todos, userID, models.Todo{Title: "report"})[0]
+	if _, err := todos.UpdateTodo(todo.ID.Hex(), userID, models.TodoUpdate{Title: "changed", UpdatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := int64(1)
+	var mismatch *services.VersionMismatchError
+	if err := todos.DeleteTodo(todo.ID.Hex(), userID, &stale); !errors.As(err, &mismatch) || mismatch.Current != 2 {
+		t.Fatalf("DeleteTodo at a stale version returned %v, want a mismatch with version 2", err)
+	}
+	current := int64(2)
+	if err := todos.DeleteTodo(todo.ID.Hex(), userID, &current); err != nil {
+		t.Fatalf("DeleteTodo at the current version failed: %v", err)
+	}
+	if _, err := todos.GetTodoByID(todo.ID.Hex(), userID); !errors.Is(err, services.ErrNotFound) {
+		t.Errorf("GetTodoByID after the delete returned %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"todo-cli/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultTrashRetention is how long deleted todos stay in the trash unless
+// TRASH_RETENTION_DAYS says otherwise
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// trashPurgeInterval is how often the trash is checked for expired todos
+const trashPurgeInterval = time.Hour
+
+// TrashRetention returns how long deleted todos are kept, from the
+// TRASH_RETENTION_DAYS environment variable. 0 keeps them until the trash
+// is emptied.
+func TrashRetention() time.Duration {
+	days := os.Getenv("TRASH_RETENTION_DAYS")
+	if days == "" {
+		return DefaultTrashRetention
+	}
+	n, err := strconv.Atoi(days)
+	if err != nil || n < 0 {
+		log.Printf("Invalid TRASH_RETENTION_DAYS %q, keeping deleted todos for %d days", days, int(DefaultTrashRetention.Hours()/24))
+		return DefaultTrashRetention
+	}
+	return time.Duration(n) * 24 * time.Hour
+}
+
+// RunTrashPurge deletes the todos that have been in the trash for longer
+// than retention, now and then every hour until ctx is done
+func RunTrashPurge(ctx context.Context, todos TodoStore, events EventStore, retention time.Duration) {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purgeCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		purged, err := todos.PurgeTodos(purgeCtx, time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("Failed to purge the trash: %v", err)
+		} else if len(purged) > 0 {
+			recordPurged(purgeCtx, events, purged)
+			log.Printf("Purged %d todos from the trash", len(purged))
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// liveTodos hides the todos in the trash from the lookups of a TodoStore
+type liveTodos struct {
+	TodoStore
+}
+
+// FindTodos leaves the trash out in the store, so it does not take up the limit
+func (s liveTodos) FindTodos(ctx context.Context, userID primitive.ObjectID, query TodoQuery) ([]models.Todo, error) {
+	trashed := false
+	query.Trashed = &trashed
+	return s.TodoStore.FindTodos(ctx, userID, query)
+}
+
+func (s liveTodos) ScanTodos(ctx context.Context, userID primitive.ObjectID, fn func(models.Todo) error) error {
+	return s.TodoStore.ScanTodos(ctx, userID, func(todo models.Todo) error {
+		if todo.DeletedAt != nil {
+			return nil
+		}
+		return fn(todo)
+	})
+}
+
+// SearchTodos leaves the trash out in the store, so it does not take up the limit
+func (s liveTodos) SearchTodos(ctx context.Context, userID primitive.ObjectID, terms []string, query TodoQuery, limit int) ([]TodoMatch, error) {
+	trashed := false
+	query.Trashed = &trashed
+	return s.TodoStore.SearchTodos(ctx, userID, terms, query, limit)
+}
+
+func (s liveTodos) FindTodo(ctx context.Context, id, userID primitive.ObjectID) (models.Todo, error) {
+	todo, err := s.TodoStore.FindTodo(ctx, id, userID)
+	if err == nil && todo.DeletedAt != nil {
+		return models.Todo{}, ErrNotFound
+	}
+	return todo, err
+}
+
+// trashTodos moves the todo with the given ID and its subtasks among todos to
+// the trash, all at the same time so they can be restored together
+func trashTodos(ctx context.Context, store TodoStore, todos []models.Todo, id primitive.ObjectID, now time.Time) error {
+	trashed := map[primitive.ObjectID]bool{id: true}
+	for _, childID := range descendantsOf(childrenOf(todos), id) {
+		trashed[childID] = true
+	}
+	for _, todo := range todos {
+		if !trashed[todo.ID] {
+			continue
+		}
+		todo.DeletedAt = &now
+		todo.Version++
+		if err := store.ReplaceTodo(ctx, todo, todo.Version-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTrash lists the todos of the user in the trash, the last deleted first
+func (s *TodoService) GetTrash(userId primitive.ObjectID) ([]models.Todo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	trashed := []models.Todo{}
+	err := s.trash.ScanTodos(ctx, userId, func(todo models.Todo) error {
+		if todo.DeletedAt != nil {
+			trashed = append(trashed, todo)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(trashed, func(i, j int) bool {
+		return trashed[i].DeletedAt.After(*trashed[j].DeletedAt)
+	})
+	return trashed, nil
+}
+
+// RestoreTodo takes a todo out of the trash along with the subtasks that
+// were deleted with it. A todo whose parent or project is gone by now is
+// restored to the top level or the Inbox.
+func (s *TodoService) RestoreTodo(id string, userId primitive.ObjectID) (models.Todo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.Todo{}, ErrNotFound
+	}
+	todo, err := s.trash.FindTodo(ctx, objectID, userId)
+	if err != nil {
+		return todo, err
+	}
+	if todo.DeletedAt == nil {
+		return models.Todo{}, ErrNotFound
+	}
+
+	todos, err := s.trash.FindTodos(ctx, userId, TodoQuery{})
+	if err != nil {
+		return models.Todo{}, err
+	}
+	byID := make(map[primitive.ObjectID]models.Todo, len(todos))
+	for _, other := range todos {
+		byID[other.ID] = other
+	}
+
+	deletedAt := *todo.DeletedAt
+	now := time.Now()
+	for _, restoreID := range append([]primitive.ObjectID{todo.ID}, descendantsOf(childrenOf(todos), todo.ID)...) {
+		restored := byID[restoreID]
+		if restored.DeletedAt == nil || !restored.DeletedAt.Equal(deletedAt) {
+			// Deleted on its own before its parent, it stays in the trash
+			continue
+		}
+		restored.DeletedAt = nil
+		restored.UpdatedAt = now
+		restored.Version++
+		if restored.ID == todo.ID && restored.ParentID != nil {
+			if parent, ok := byID[*restored.ParentID]; !ok || parent.DeletedAt != nil {
+				restored.ParentID = nil
+			}
+		}
+		if err := s.checkProject(ctx, restored); errors.Is(err, ErrProjectNotFound) {
+			restored.ProjectID = nil
+		} else if err != nil {
+			return models.Todo{}, err
+		}
+		if err := s.trash.ReplaceTodo(ctx, restored, restored.Version-1); err != nil {
+			return models.Todo{}, err
+		}
+		if restored.ID == todo.ID {
+			todo = restored
+		}
+	}
+	return withComputed(todo, now), nil
+}
+
+// EmptyTrash deletes the todos of the user in the trash for good and returns how many there were
+func (s *TodoService) EmptyTrash(userId primitive.ObjectID) (int, error) {
+	trashed, err := s.GetTrash(userId)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, todo := range trashed {
+		if err := s.trash.DeleteTodo(ctx, todo.ID, userId); err != nil {
+			return 0, err
+		}
+	}
+	return len(trashed), nil
+}
@@ -0,0 +1,361 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"todo-cli/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultUndoDepth is how many operations each user can undo unless
+// UNDO_DEPTH says otherwise
+const DefaultUndoDepth = 20
+
+var (
+	ErrNothingToUndo = errors.New("nothing to undo")
+	ErrNothingToRedo = errors.New("nothing to redo")
+)
+
+// UndoConflictError is returned when a todo changed after the operation
+// being undone or redone. The operation is dropped from the undo log.
+type UndoConflictError struct {
+	Operation string
+	TodoID    primitive.ObjectID
+	Title     string
+	Redo      bool
+}
+
+func (e *UndoConflictError) Error() string {
+	verb := "undone"
+	if e.Redo {
+		verb = "redone"
+	}
+	return fmt.Sprintf("todo %q was changed after %s, so it can no longer be %s", e.Title, e.Operation, verb)
+}
+
+// UndoDepth returns how many operations each user can undo, from the
+// UNDO_DEPTH environment variable. 0 turns undo off.
+func UndoDepth() int {
+	depth := os.Getenv("UNDO_DEPTH")
+	if depth == "" {
+		return DefaultUndoDepth
+	}
+	n, err := strconv.Atoi(depth)
+	if err != nil || n < 0 {
+		log.Printf("Invalid UNDO_DEPTH %q, keeping the last %d operations", depth, DefaultUndoDepth)
+		return DefaultUndoDepth
+	}
+	return n
+}
+
+// recordingTodos collects the todos changed through a TodoStore, as they
+// were before the first and after the last change
+type recordingTodos struct {
+	TodoStore
+	order    []primitive.ObjectID
+	changes  map[primitive.ObjectID]*models.TodoChange
+	projects []models.ProjectChange // the projects deleted, see recordingProjects
+}
+
+func (s *recordingTodos) record(id primitive.ObjectID, before, after *models.Todo) {
+	if change, ok := s.changes[id]; ok {
+		change.After = after
+		return
+	}
+	s.changes[id] = &models.TodoChange{TodoID: id, Before: before, After: after}
+	s.order = append(s.order, id)
+}
+
+func (s *recordingTodos) InsertTodo(ctx context.Context, todo models.Todo) error {
+	if err := s.TodoStore.InsertTodo(ctx, todo); err != nil {
+		return err
+	}
+	s.record(todo.ID, nil, &todo)
+	return nil
+}
+
+func (s *recordingTodos) ReplaceTodo(ctx context.Context, todo models.Todo, version int64) error {
+	before, err := s.TodoStore.FindTodo(ctx, todo.ID, todo.UserID)
+	if err != nil {
+		return err
+	}
+	if err := s.TodoStore.ReplaceTodo(ctx, todo, version); err != nil {
+		return err
+	}
+	s.record(todo.ID, &before, &todo)
+	return nil
+}
+
+func (s *recordingTodos) DeleteTodo(ctx context.Context, id, userID primitive.ObjectID) error {
+	before, err := s.TodoStore.FindTodo(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.TodoStore.DeleteTodo(ctx, id, userID); err != nil {
+		return err
+	}
+	s.record(id, &before, nil)
+	return nil
+}
+
+// recordingProjects adds the projects deleted through a ProjectStore to the
+// changes a recordingTodos collects
+type recordingProjects struct {
+	ProjectStore
+	recorder *recordingTodos
+}
+
+func (s recordingProjects) DeleteProject(ctx context.Context, id, userID primitive.ObjectID) error {
+	before, err := s.ProjectStore.FindProject(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.ProjectStore.DeleteProject(ctx, id, userID); err != nil {
+		return err
+	}
+	s.recorder.projects = append(s.recorder.projects, models.ProjectChange{ProjectID: id, Before: &before})
+	return nil
+}
+
+// recorded returns the changes in the order the todos were first changed,
+// leaving out the todos that ended up as they started
+func (s *recordingTodos) recorded() []models.TodoChange {
+	var changes []models.TodoChange
+	for _, id := range s.order {
+		change := s.changes[id]
+		if change.Before == nil && change.After == nil {
+			continue
+		}
+		if change.Before != nil && change.After != nil && sameTodo(*change.Before, *change.After) {
+			continue
+		}
+		changes = append(changes, *change)
+	}
+	return changes
+}
+
+// sameTodo reports whether two versions of a todo would be stored alike,
+// which ignores the precision the stores drop from timestamps, apart from
+// their version number
+func sameTodo(a, b models.Todo) bool {
+	a.Version, b.Version = 0, 0
+	dataA, errA := bson.Marshal(a)
+	dataB, errB := bson.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(dataA, dataB)
+}
+
+// recording returns a copy of the service that records the todos it changes
+func (s *TodoService) recording() (*TodoService, *recordingTodos) {
+	recorder := &recordingTodos{TodoStore: s.trash, changes: map[primitive.ObjectID]*models.TodoChange{}}
+	scoped := *s
+	scoped.store = liveTodos{recorder}
+	scoped.trash = recorder
+	scoped.projects = recordingProjects{s.projects, recorder}
+	scoped.recorder = recorder
+	return &scoped, recorder
+}
+
+// putBack stores target as the todo of a change, or deletes the todo when
+// target is nil. exists tells whether the todo is stored at the moment. The
+// version keeps counting up, so clients notice the todo changed.
+func (s *TodoService) putBack(ctx context.Context, userId primitive.ObjectID, change models.TodoChange, target *models.Todo, exists bool) error {
+	if target == nil {
+		return s.trash.DeleteTodo(ctx, change.TodoID, userId)
+	}
+	todo := *target
+	if !exists {
+		todo.Version++
+		return s.trash.InsertTodo(ctx, todo)
+	}
+	current, err := s.trash.FindTodo(ctx, change.TodoID, userId)
+	if err != nil {
+		return err
+	}
+	todo.Version = current.Version + 1
+	return s.trash.ReplaceTodo(ctx, todo, current.Version)
+}
+
+// restoreProjects stores the projects an operation deleted again, unless
+// they are back already
+func (s *TodoService) restoreProjects(ctx context.Context, userId primitive.ObjectID, changes []models.ProjectChange) error {
+	for _, change := range changes {
+		_, err := s.projects.FindProject(ctx, change.ProjectID, userId)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if err := s.projects.InsertProject(ctx, *change.Before); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Undoable runs fn with a TodoService that logs the changes it makes as one
+// operation of the user, named name, which can then be undone. Logging a new
+// operation forgets the undone ones that could have been redone.
+func (s *TodoService) Undoable(userId primitive.ObjectID, name string, fn func(*TodoService) error) error {
+	if s.undoDepth == 0 {
+		return fn(s)
+	}
+
+	scoped, recorder := s.recording()
+	err := fn(scoped)
+
+	// What was changed before an error can be undone as well
+	if changes := recorder.recorded(); len(changes) > 0 || len(recorder.projects) > 0 {
+		if logErr := s.logOperation(userId, name, changes, recorder.projects); logErr != nil && err == nil {
+			err = logErr
+		}
+	}
+	return err
+}
+
+// logOperation adds an operation to the undo log of the user and trims the
+// log to the undo depth
+func (s *TodoService) logOperation(userId primitive.ObjectID, name string, changes []models.TodoChange, projects []models.ProjectChange) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ops, err := s.operations.FindOperations(ctx, userId)
+	if err != nil {
+		return err
+	}
+	var kept []models.Operation
+	for _, op := range ops {
+		if op.Undone {
+			if err := s.operations.DeleteOperation(ctx, op.ID, userId); err != nil {
+				return err
+			}
+			continue
+		}
+		kept = append(kept, op)
+	}
+	for len(kept) >= s.undoDepth {
+		if err := s.operations.DeleteOperation(ctx, kept[0].ID, userId); err != nil {
+			return err
+		}
+		kept = kept[1:]
+	}
+
+	return s.operations.InsertOperation(ctx, models.Operation{
+		ID:       primitive.NewObjectID(),
+		UserID:   userId,
+		Name:     name,
+		Changes:  changes,
+		Projects: projects,
+		At:       time.Now().UTC(),
+	})
+}
+
+// Undo reverts the most recent operation of the user that is not undone yet
+func (s *TodoService) Undo(userId primitive.ObjectID) (models.Operation, error) {
+	return s.replay(userId, false)
+}
+
+// Redo applies the most recently undone operation of the user again
+func (s *TodoService) Redo(userId primitive.ObjectID) (models.Operation, error) {
+	return s.replay(userId, true)
+}
+
+// replay undoes or redoes an operation, after checking that every todo it
+// changed is still as the operation left it
+func (s *TodoService) replay(userId primitive.ObjectID, redo bool) (models.Operation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ops, err := s.operations.FindOperations(ctx, userId)
+	if err != nil {
+		return models.Operation{}, err
+	}
+	// Undone operations always follow the others, the first one was undone last
+	var op *models.Operation
+	for i := range ops {
+		if !ops[i].Undone {
+			if !redo {
+				op = &ops[i]
+			}
+			continue
+		}
+		if redo {
+			op = &ops[i]
+			break
+		}
+	}
+	if op == nil && redo {
+		return models.Operation{}, ErrNothingToRedo
+	}
+	if op == nil {
+		return models.Operation{}, ErrNothingToUndo
+	}
+
+	changes := make([]models.TodoChange, len(op.Changes))
+	copy(changes, op.Changes)
+	if !redo {
+		for i, j := 0, len(changes)-1; i < j; i, j = i+1, j-1 {
+			changes[i], changes[j] = changes[j], changes[i]
+		}
+	}
+
+	// Nothing is written unless every todo can be put back
+	exists := make([]bool, len(changes))
+	for i, change := range changes {
+		expected := change.After
+		if redo {
+			expected = change.Before
+		}
+		current, err := s.trash.FindTodo(ctx, change.TodoID, userId)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return *op, err
+		}
+		exists[i] = err == nil
+		if expected == nil && !exists[i] || expected != nil && exists[i] && sameTodo(current, *expected) {
+			continue
+		}
+		if err := s.operations.DeleteOperation(ctx, op.ID, userId); err != nil {
+			return *op, err
+		}
+		return *op, &UndoConflictError{Operation: op.Name, TodoID: change.TodoID, Title: change.Title(), Redo: redo}
+	}
+
+	// Deleted projects come back before their todos and go after them
+	if !redo {
+		if err := s.restoreProjects(ctx, userId, op.Projects); err != nil {
+			return *op, err
+		}
+	}
+	for i, change := range changes {
+		target := change.Before
+		if redo {
+			target = change.After
+		}
+		if err := s.putBack(ctx, userId, change, target, exists[i]); err != nil {
+			return *op, err
+		}
+	}
+	if redo {
+		for _, change := range op.Projects {
+			err := s.projects.DeleteProject(ctx, change.ProjectID, userId)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return *op, err
+			}
+		}
+	}
+
+	op.Undone = !redo
+	if err := s.operations.ReplaceOperation(ctx, *op); err != nil {
+		return *op, err
+	}
+	return *op, nil
+}
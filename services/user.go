@@ -3,16 +3,11 @@ package services
 import (
 	"context"
 	"errors"
-	"os"
 	"time"
 
-	"todo-cli/db"
 	"todo-cli/models"
 
-	"github.com/dgrijalva/jwt-go"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -22,9 +17,19 @@ type UserResponse struct {
 	Email    string `json:"email"`
 }
 
-// RegisterUser adds a new user to MongoDB
-func RegisterUser(username, password, email string) (*mongo.InsertOneResult, error) {
-	collection := db.GetCollection("go-todo-db", "users")
+// UserService implements registration and authentication on top of the user and token stores
+type UserService struct {
+	users  UserStore
+	tokens TokenStore
+}
+
+// NewUserService returns a UserService persisting to the given stores
+func NewUserService(users UserStore, tokens TokenStore) *UserService {
+	return &UserService{users: users, tokens: tokens}
+}
+
+// RegisterUser adds a new user to the store
+func (s *UserService) RegisterUser(username, password, email string) (UserResponse, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -38,71 +43,58 @@ func RegisterUser(username, password, email string) (*mongo.InsertOneResult, err
 		Email:    email,
 	}
 
-	result, err := collection.InsertOne(ctx, user)
-	if err != nil {
-		return nil, err
+	if err := s.users.InsertUser(ctx, user); err != nil {
+		return UserResponse{}, err
 	}
-	return result, nil
+	return UserResponse{ID: user.ID.Hex(), Username: user.Username, Email: user.Email}, nil
 }
 
-// AuthenticateUser authenticates a user and returns a JWT token
-func AuthenticateUser(username, password string) (string, error) {
-	collection := db.GetCollection("go-todo-db", "users")
+// AuthenticateUser authenticates a user and opens a session for the device
+// userAgent names, at ip, returning a short-lived access token and the
+// refresh token to renew it with
+func (s *UserService) AuthenticateUser(username, password, userAgent, ip string) (TokenPair, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	var jwtSecret = []byte(os.Getenv("SECRET_KEY"))
 
-	var user models.User
-	err := collection.FindOne(ctx, bson.M{"username": username}).Decode(&user)
+	user, err := s.users.FindUserByUsername(ctx, username)
 	if err != nil {
-		return "", errors.New("invalid username or password")
+		return TokenPair{}, errors.New("invalid username or password")
 	}
 
 	// Check password
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if err != nil {
-		return "", errors.New("invalid username or password")
-	}
-
-	// Generate JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID.Hex(),
-		"exp":     time.Now().Add(time.Hour * 72).Unix(),
-	})
-	tokenString, err := token.SignedString(jwtSecret)
-	if err != nil {
-		return "", err
+		return TokenPair{}, errors.New("invalid username or password")
 	}
-	// Store the token in MongoDB for future validation (optional, used for logout)
-	tokensCollection := db.GetCollection("go-todo-db", "tokens")
-	tokensCollection.InsertOne(ctx, bson.M{"user_id": user.ID.Hex(),
-		"token": tokenString,
-		"exp":   time.Now().Add(time.Hour * 72).Unix()})
 
-	return tokenString, nil
+	return s.startSession(ctx, user.ID, userAgent, ip)
 }
 
-// LogoutUser invalidates the JWT token by deleting it from MongoDB
-func LogoutUser(tokenString string) error {
-	collection := db.GetCollection("go-todo-db", "tokens")
+// LogoutUser ends the session an access token was issued for, which revokes
+// its refresh token as well. An expired access token still does.
+func (s *UserService) LogoutUser(tokenString string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	_, err := collection.DeleteOne(ctx, bson.M{"token": tokenString})
-	return err
+	_, sessionID, err := SessionOf(tokenString, true)
+	if err != nil {
+		return err
+	}
+	return s.tokens.DeleteToken(ctx, sessionID)
 }
 
-// GetTodoByID retrieves a todo by its ID
-func GetUserDetails(id string) (UserResponse, error) {
-	collection := db.GetCollection("go-todo-db", "users")
+// GetUserDetails retrieves a user by its ID
+func (s *UserService) GetUserDetails(id string) (UserResponse, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	objectID, _ := primitive.ObjectIDFromHex(id)
-	var user UserResponse
-	err := collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&user)
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return UserResponse{}, ErrNotFound
+	}
+	user, err := s.users.FindUserByID(ctx, objectID)
 	if err != nil {
-		return user, err
+		return UserResponse{}, err
 	}
-	return user, nil
+	return UserResponse{ID: user.ID.Hex(), Username: user.Username, Email: user.Email}, nil
 }
@@ -0,0 +1,199 @@
+package services_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"todo-cli/services"
+)
+
+// newUserService returns a UserService on an in-memory store with alice registered
+func newUserService(t *testing.T) *services.UserService {
+	t.Helper()
+	t.Setenv("SECRET_KEY", "test secret")
+	stores := openStores(t)
+	users := services.NewUserService(stores.Users, stores.Tokens)
+	if _, err := users.RegisterUser("alice", "pw1", "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	return users
+}
+
+func TestRegisterUser(t *testing.T) {
+	users := newUserService(t)
+	tests := []struct {
+		username string
+		wantErr  error
+	}{
+		{"bob", nil},
+		{"alice", services.ErrUsernameTaken},
+		{"bob", services.ErrUsernameTaken},
+		{"Alice", nil},
+	}
+	for _, tt := range tests {
+		_, err := users.RegisterUser(tt.username, "pw", tt.username+"@example.com")
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("RegisterUser(%q) returned %v, want %v", tt.username, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAuthenticateUser(t *testing.T) {
+	users := newUserService(t)
+	tests := []struct {
+		username, password string
+		ok                 bool
+	}{
+		{"alice", "pw1", true},
+		{"alice", "pw2", false},
+		{"bob", "pw1", false},
+	}
+	for _, tt := range tests {
+		pair, err := users.AuthenticateUser(tt.username, tt.password, "test", "127.0.0.1")
+		if tt.ok != (err == nil) {
+			t.Errorf("AuthenticateUser(%q, %q) returned %v", tt.username, tt.password, err)
+			continue
+		}
+		if tt.ok && (pair.AccessToken == "" || pair.RefreshToken == "") {
+			t.Errorf("AuthenticateUser(%q, %q) returned no tokens", tt.username, tt.password)
+		}
+	}
+}
+
+func TestRefreshSessionRotates(t *testing.T) {
+	users := newUserService(t)
+	login, err := users.AuthenticateUser("alice", "pw1", "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refreshToken := login.RefreshToken
+	for i := 0; i < 3; i++ {
+		pair, err := users.RefreshSession(refreshToken, "127.0.0.1")
+		if err != nil {
+			t.Fatalf("refresh %d failed: %v", i+1, err)
+		}
+		if pair.RefreshToken == refreshToken {
+			t.Fatalf("refresh %d handed out the same refresh token again", i+1)
+		}
+		if sessionID(pair.RefreshToken) != sessionID(login.RefreshToken) {
+			t.Fatalf("refresh %d moved to another session", i+1)
+		}
+		refreshToken = pair.RefreshToken
+	}
+}
+
+func TestRefreshSessionReuse(t *testing.T) {
+	users := newUserService(t)
+	login, err := users.AuthenticateUser("alice", "pw1", "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := users.RefreshSession(login.RefreshToken, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := users.RefreshSession(first.RefreshToken, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		// Replaying a token traded in already ends the session, for whoever
+		// holds its current token as well
+		{"the token of the login", login.RefreshToken, services.ErrRefreshTokenReused},
+		{"the current token", second.RefreshToken, services.ErrInvalidRefreshToken},
+		{"the token of the first refresh", first.RefreshToken, services.ErrInvalidRefreshToken},
+	}
+	for _, tt := range tests {
+		if _, err := users.RefreshSession(tt.token, "127.0.0.1"); !errors.Is(err, tt.wantErr) {
+			t.Errorf("refreshing with %s returned %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRefreshSessionConcurrent(t *testing.T) {
+	users := newUserService(t)
+	login, err := users.AuthenticateUser("alice", "pw1", "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 2)
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := users.RefreshSession(login.RefreshToken, "127.0.0.1")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	// Whichever refresh comes second sees the token used already
+	var succeeded, reused int
+	for err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, services.ErrRefreshTokenReused):
+			reused++
+		default:
+			t.Errorf("refresh returned %v", err)
+		}
+	}
+	if succeeded != 1 || reused != 1 {
+		t.Errorf("%d refreshes succeeded and %d saw the token reused, want one each", succeeded, reused)
+	}
+}
+
+func TestRefreshSessionForged(t *testing.T) {
+	users := newUserService(t)
+	login, err := users.AuthenticateUser("alice", "pw1", "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, forged := range []string{
+		"",
+		"no-session",
+		sessionID(login.RefreshToken),
+		sessionID(login.RefreshToken) + ".guessed",
+		"000000000000000000000000." + strings.SplitN(login.RefreshToken, ".", 2)[1],
+	} {
+		if _, err := users.RefreshSession(forged, "127.0.0.1"); !errors.Is(err, services.ErrInvalidRefreshToken) {
+			t.Errorf("refreshing with %q returned %v, want ErrInvalidRefreshToken", forged, err)
+		}
+	}
+	// Knowing the session ID is not enough to end the session
+	if _, err := users.RefreshSession(login.RefreshToken, "127.0.0.1"); err != nil {
+		t.Errorf("refreshing with the real token after forged ones failed: %v", err)
+	}
+}
+
+func TestLogoutEndsRefresh(t *testing.T) {
+	users := newUserService(t)
+	login, err := users.AuthenticateUser("alice", "pw1", "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.LogoutUser(login.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.RefreshSession(login.RefreshToken, "127.0.0.1"); !errors.Is(err, services.ErrInvalidRefreshToken) {
+		t.Errorf("refreshing after logging out returned %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+// sessionID returns the session a refresh token names
+func sessionID(refreshToken string) string {
+	return strings.SplitN(refreshToken, ".", 2)[0]
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"fmt"
+
+	"todo-cli/models"
+)
+
+// maxUpdateAttempts is how often an update that asked for no version is
+// tried when the todo keeps changing between reading and writing it
+const maxUpdateAttempts = 3
+
+// VersionMismatchError is returned when a change is based on a version of a
+// todo that is no longer the current one
+type VersionMismatchError struct {
+	Expected int64
+	Current  int64
+}
+
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("the todo was changed since version %d and is at version %d now", e.Expected, e.Current)
+}
+
+// checkVersion makes sure the todo is at the expected version, if one is given
+func checkVersion(todo models.Todo, expected *int64) error {
+	if expected != nil && *expected != todo.Version {
+		return &VersionMismatchError{Expected: *expected, Current: todo.Version}
+	}
+	return nil
+}
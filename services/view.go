@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"todo-cli/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Errors returned for saved views that cannot be stored as given
+var (
+	ErrBuiltInView = errors.New("built-in views cannot be changed")
+	ErrViewExists  = errors.New("a view with this name already exists")
+)
+
+// BuiltInViews are the views every user has without saving them
+var BuiltInViews = []models.SavedView{
+	{Key: "today", Name: "Today", Filter: "open (due:today OR overdue)", Sort: "due_at,-priority"},
+	{Key: "upcoming", Name: "Upcoming", Filter: "open due>today due<=7d", Sort: "due_at,-priority"},
+	{Key: "overdue", Name: "Overdue", Filter: "overdue", Sort: "due_at,-priority"},
+}
+
+// ViewService implements the saved view use cases, running them with the todo service
+type ViewService struct {
+	views ViewStore
+	todos *TodoService
+}
+
+// NewViewService returns a ViewService persisting to the given stores
+func NewViewService(stores Stores) *ViewService {
+	return &ViewService{views: stores.Views, todos: NewTodoService(stores)}
+}
+
+// checkView verifies the filter and sort of a view can be run
+func checkView(view models.SavedView) error {
+	if strings.TrimSpace(view.Filter) != "" {
+		if _, err := ParseFilterExpr(view.Filter); err != nil {
+			return fmt.Errorf("invalid filter: %w", err)
+		}
+	}
+	_, err := ParseTodoSort(view.Sort)
+	return err
+}
+
+// checkViewName makes sure no other view of the user, built-in views
+// included, already goes by the name
+func (s *ViewService) checkViewName(ctx context.Context, view models.SavedView) error {
+	views, err := s.views.FindViews(ctx, view.UserID)
+	if err != nil {
+		return err
+	}
+	for _, other := range append(BuiltInViews, views...) {
+		if other.ID != view.ID && strings.EqualFold(other.Name, view.Name) {
+			return ErrViewExists
+		}
+	}
+	return nil
+}
+
+// CreateView saves a new view for the user
+func (s *ViewService) CreateView(userId primitive.ObjectID, name, filter, sort string) (models.SavedView, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	view := models.SavedView{
+		ID:        primitive.NewObjectID(),
+		Name:      strings.TrimSpace(name),
+		Filter:    filter,
+		Sort:      sort,
+		UserID:    userId,
+		CreatedAt: &now,
+		UpdatedAt: &now,
+	}
+	if err := checkView(view); err != nil {
+		return models.SavedView{}, err
+	}
+	if err := s.checkViewName(ctx, view); err != nil {
+		return models.SavedView{}, err
+	}
+	if err := s.views.InsertView(ctx, view); err != nil {
+		return models.SavedView{}, err
+	}
+	return view, nil
+}
+
+// GetViews lists the built-in views followed by the ones the user saved
+func (s *ViewService) GetViews(userId primitive.ObjectID) ([]models.SavedView, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	saved, err := s.views.FindViews(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	views := make([]models.SavedView, 0, len(BuiltInViews)+len(saved))
+	for _, view := range BuiltInViews {
+		view.UserID = userId
+		views = append(views, view)
+	}
+	return append(views, saved...), nil
+}
+
+// GetViewByID retrieves a view by its ID, or a built-in view by its key
+func (s *ViewService) GetViewByID(id string, userId primitive.ObjectID) (models.SavedView, error) {
+	for _, view := range BuiltInViews {
+		if view.Key == strings.ToLower(id) {
+			view.UserID = userId
+			return view, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.SavedView{}, ErrNotFound
+	}
+	return s.views.FindView(ctx, objectID, userId)
+}
+
+// UpdateView renames a saved view and/or changes its filter or sort
+func (s *ViewService) UpdateView(id string, userId primitive.ObjectID, update models.SavedViewUpdate) (models.SavedView, error) {
+	view, err := s.GetViewByID(id, userId)
+	if err != nil {
+		return view, err
+	}
+	if view.Key != "" {
+		return models.SavedView{}, ErrBuiltInView
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	view.UpdatedAt = &update.UpdatedAt
+	if name := strings.TrimSpace(update.Name); name != "" {
+		view.Name = name
+	}
+	if update.Filter != nil {
+		view.Filter = *update.Filter
+	}
+	if update.Sort != nil {
+		view.Sort = *update.Sort
+	}
+	if err := checkView(view); err != nil {
+		return models.SavedView{}, err
+	}
+	if err := s.checkViewName(ctx, view); err != nil {
+		return models.SavedView{}, err
+	}
+	if err := s.views.ReplaceView(ctx, view); err != nil {
+		return models.SavedView{}, err
+	}
+	return view, nil
+}
+
+// DeleteView deletes a saved view, the todos it lists are left alone
+func (s *ViewService) DeleteView(id string, userId primitive.ObjectID) error {
+	view, err := s.GetViewByID(id, userId)
+	if err != nil {
+		return err
+	}
+	if view.Key != "" {
+		return ErrBuiltInView
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return s.views.DeleteView(ctx, view.ID, userId)
+}
+
+// RunView retrieves one page of the todos listed by a view. Days in its
+// filter are evaluated in loc. A sort in page overrides the one of the view.
+func (s *ViewService) RunView(id string, userId primitive.ObjectID, loc *time.Location, page PageRequest) (TodoPage, error) {
+	view, err := s.GetViewByID(id, userId)
+	if err != nil {
+		return TodoPage{}, err
+	}
+
+	filter := TodoFilter{Location: loc}
+	if strings.TrimSpace(view.Filter) != "" {
+		if filter.Expr, err = ParseFilterExpr(view.Filter); err != nil {
+			return TodoPage{}, fmt.Errorf("invalid filter: %w", err)
+		}
+	}
+	if len(page.Sort) == 0 {
+		if page.Sort, err = ParseTodoSort(view.Sort); err != nil {
+			return TodoPage{}, err
+		}
+	}
+	return s.todos.GetTodos(userId, filter, page)
+}